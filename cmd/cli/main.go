@@ -116,6 +116,9 @@ Commands:
       text:"Title" size:32 align:center weight:bold - Text with properties
       feed:2                          - Feed N lines
       cut                             - Cut paper
+      cut mode:partial                - Partial cut (leaves a small bridge)
+      drawer                          - Open the cash drawer
+      drawer pin:5                    - Open the drawer on kick-out pin 5
       divider                         - Add divider line
       divider style:solid|dashed|dotted|double - Divider with style
       image:"/path/to/image.png"      - Print image from path
@@ -123,9 +126,12 @@ Commands:
       barcode:"123456" format:CODE128 height:50 - Barcode with options
       qrcode:"https://example.com"    - Print QR code
       qrcode:"data" error_correction:L|M|Q|H - QR code with error correction
+      pdf417:"data" ecc_level:0-8 size:2   - PDF417 (also datamatrix:, aztec:)
       
     Note: Use align as a property of text commands, not as a standalone command
     Note: Add --repeat N after the receipt / compose to print multiple times
+    Note: Add --priority N to print ahead of lower-priority jobs
+    Note: Add --idempotency-key K so a retried submission returns the original job
       
   server status|stop|restart
     Server lifecycle commands (stop/restart affect the running server process)
@@ -139,6 +145,27 @@ Commands:
   printer rename <id> <name>
     Set a custom name for a printer
     
+  printer pause|resume <id>
+    Hold or resume a printer's queued jobs
+    
+  printer completion <id> <fire_and_forget|status|process_id>
+    Choose whether jobs complete once sent or once the printer confirms them
+    
+  printer output <id> <raster|native>
+    Send receipts as one image or as native ESC/POS text, barcodes and QR codes
+    
+  printer flow-control <id> <none|status|xonxoff>
+    Wait for the printer (DLE EOT or XON/XOFF) between bands of large images
+    
+  printer drawer <id> [2|5]
+    Open the cash drawer on a printer's kick-out pin (default 2) without printing
+    
+  printer profile <id> <name|auto>
+    Set a printer's capability profile (width, cutter, code pages), or detect it
+    
+  printer profiles
+    List known printer capability profiles
+    
   job list
     List all print jobs
     
@@ -146,7 +173,13 @@ Commands:
     Get status of a specific job
     
   job clear
-    Clear completed jobs from the queue
+    Clear completed and cancelled jobs from the queue
+    
+  job cancel <id>
+    Cancel a queued job
+    
+  job priority <id> <n>
+    Change the priority of a queued job
     
   detect
     Detect/scan for printers
@@ -442,7 +475,7 @@ func createComposedReceiptJSON(composeArgs []string) ([]byte, error) {
 func isCommandStart(arg string) bool {
 	// Check for command types: text:, feed:, cut, divider, etc.
 	// Note: align is not a standalone command; use it as a property (e.g. text:"Hi" align:center)
-	knownCommands := []string{"text:", "feed:", "cut", "divider", "image:", "barcode:", "qrcode:"}
+	knownCommands := []string{"text:", "feed:", "cut", "drawer", "divider", "image:", "barcode:", "qrcode:", "pdf417:", "datamatrix:", "aztec:"}
 	for _, cmd := range knownCommands {
 		if strings.HasPrefix(arg, cmd) || arg == strings.TrimSuffix(cmd, ":") {
 			return true
@@ -481,7 +514,7 @@ func parseComposeCommandStart(arg string) (map[string]interface{}, error) {
 		cmd["lines"] = lines
 	case "image":
 		cmd["path"] = strings.Trim(firstValue, `"'`)
-	case "barcode", "qrcode":
+	case "barcode", "qrcode", "pdf417", "datamatrix", "aztec":
 		cmd["value"] = strings.Trim(firstValue, `"'`)
 	default:
 		// For unknown command types, treat first value as a generic value
@@ -8,11 +8,14 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/thereceipt/receipt-engine/internal/api"
+	"github.com/thereceipt/receipt-engine/internal/imagecache"
 	"github.com/thereceipt/receipt-engine/internal/printer"
+	"github.com/thereceipt/receipt-engine/internal/renderer"
 	"github.com/thereceipt/receipt-engine/internal/tui"
 )
 
@@ -35,11 +38,28 @@ func main() {
 		log.Printf("Warning: printer detection failed: %v", err)
 	}
 
+	// Keep downloaded images next to the registry
+	imagecache.SetDefault(imagecache.New(filepath.Join(filepath.Dir(registryPath), "image_cache"), imagecache.Options{}))
+
+	// Fonts for characters the bundled font lacks, e.g. CJK or Arabic
+	renderer.SetFallbackFonts(getFallbackFonts())
+
 	// Create connection pool
 	pool := printer.NewConnectionPool()
 
-	// Create print queue with 3 retries
-	queue := printer.NewPrintQueue(pool, manager, 3)
+	// Create print queue with 5 backed-off retries, journaled next to the registry
+	queue, err := printer.NewPrintQueue(pool, manager, printer.QueueOptions{
+		MaxRetries:        5,
+		RetryBaseDelay:    2 * time.Second,
+		RetryMaxDelay:     time.Minute,
+		JournalPath:       filepath.Join(filepath.Dir(registryPath), "print_queue.journal"),
+		Retention:         getJobRetention(),
+		IdempotencyWindow: getIdempotencyWindow(),
+		BandHeight:        getBandHeight(),
+	})
+	if err != nil {
+		log.Fatalf("Failed to create print queue: %v", err)
+	}
 	defer queue.Stop()
 
 	// Start printer monitor
@@ -73,6 +93,23 @@ func main() {
 
 	// Create API server
 	server := api.NewServer(manager, pool, queue)
+	queue.OnJobProgress(server.BroadcastJobProgress)
+
+	// Poll printers for paper out, cover open, etc.
+	statusMonitor := printer.NewStatusMonitor(manager, pool, printer.StatusOptions{
+		Interval:       5 * time.Second,
+		AutoStatusBack: os.Getenv("PRINTER_AUTO_STATUS_BACK") == "1",
+	})
+
+	manager.OnPrinterStatusChanged(func(id string, status printer.PrinterStatus) {
+		server.BroadcastPrinterStatus(id, status)
+		if problem := status.Problem(); problem != "" {
+			tuiApp.AddLog(fmt.Sprintf("⚠️  Printer %s: %s", id, problem), "warning")
+		}
+	})
+
+	statusMonitor.Start()
+	defer statusMonitor.Stop()
 
 	// Start server in goroutine
 	serverErrChan := make(chan error, 1)
@@ -110,15 +147,66 @@ func main() {
 	case <-sigChan:
 		// Signal received, shutdown gracefully
 		tuiApp.AddLog("🛑 Shutting down...", "info")
+		queue.Stop()
 		pool.DisconnectAll()
 		os.Exit(0)
 	case <-tuiDone:
 		// TUI quit, shutdown gracefully
+		queue.Stop()
 		pool.DisconnectAll()
 		os.Exit(0)
 	}
 }
 
+// getJobRetention returns how long completed jobs are kept in the queue.
+// Set JOB_RETENTION to a Go duration (e.g. "2h"); "0" keeps them until cleared.
+func getJobRetention() time.Duration {
+	if value := os.Getenv("JOB_RETENTION"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+		log.Printf("Warning: invalid JOB_RETENTION %q, using default", value)
+	}
+
+	return 24 * time.Hour
+}
+
+// getIdempotencyWindow returns how long idempotency keys are remembered.
+// Set IDEMPOTENCY_WINDOW to a Go duration (e.g. "1h").
+func getIdempotencyWindow() time.Duration {
+	if value := os.Getenv("IDEMPOTENCY_WINDOW"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Warning: invalid IDEMPOTENCY_WINDOW %q, using default", value)
+	}
+
+	return printer.DefaultIdempotencyWindow
+}
+
+// getBandHeight returns how many rows of a raster image are sent at a time.
+// Set RASTER_BAND_HEIGHT to a smaller number for printers with small buffers.
+func getBandHeight() int {
+	if value := os.Getenv("RASTER_BAND_HEIGHT"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("Warning: invalid RASTER_BAND_HEIGHT %q, using default", value)
+	}
+
+	return printer.DefaultBandHeight
+}
+
+// getFallbackFonts returns font files to draw characters that receipt fonts
+// don't have. Set FONT_FALLBACKS to a list of paths separated like PATH.
+func getFallbackFonts() []string {
+	value := os.Getenv("FONT_FALLBACKS")
+	if value == "" {
+		return nil
+	}
+	return filepath.SplitList(value)
+}
+
 func getPort() string {
 	if port := os.Getenv("SERVER_PORT"); port != "" {
 		return port
@@ -2,6 +2,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/thereceipt/receipt-engine/internal/command"
 	"github.com/thereceipt/receipt-engine/internal/parser"
 	"github.com/thereceipt/receipt-engine/internal/printer"
+	"github.com/thereceipt/receipt-engine/internal/profile"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
@@ -59,9 +61,22 @@ func (s *Server) setupRoutes() {
 	s.router.GET("/printers", s.handleGetPrinters)
 	s.router.POST("/printer/:id/name", s.handleSetPrinterName)
 	s.router.POST("/printer/network", s.handleAddNetworkPrinter)
+	s.router.POST("/printer/:id/pause", s.handlePausePrinter)
+	s.router.POST("/printer/:id/resume", s.handleResumePrinter)
+	s.router.POST("/printer/:id/completion", s.handleSetCompletionMode)
+	s.router.POST("/printer/:id/output", s.handleSetOutputMode)
+	s.router.POST("/printer/:id/drawer", s.handleOpenDrawer)
+	s.router.POST("/printer/:id/profile", s.handleSetProfile)
+	s.router.POST("/printer/:id/flow-control", s.handleSetFlowControl)
+	s.router.GET("/profiles", s.handleGetProfiles)
 	s.router.POST("/print", s.handlePrint)
 	s.router.GET("/jobs", s.handleGetJobs)
+	s.router.GET("/jobs/dead", s.handleGetDeadJobs)
 	s.router.GET("/job/:id", s.handleGetJob)
+	s.router.POST("/job/:id/requeue", s.handleRequeueJob)
+	s.router.POST("/job/:id/discard", s.handleDiscardJob)
+	s.router.POST("/job/:id/priority", s.handleSetJobPriority)
+	s.router.DELETE("/job/:id", s.handleCancelJob)
 
 	// Command endpoint
 	s.router.POST("/command", s.handleCommand)
@@ -75,12 +90,38 @@ func (s *Server) setupRoutes() {
 	})
 }
 
+// printerWithStatus adds the last reported status and per-printer settings to a printer's fields
+type printerWithStatus struct {
+	*printer.Printer
+	Status         *printer.PrinterStatus `json:",omitempty"`
+	CompletionMode string
+	Output         string
+	FlowControl    string
+	Profile        string `json:",omitempty"`
+}
+
 // handleGetPrinters returns all detected printers
 func (s *Server) handleGetPrinters(c *gin.Context) {
 	printers := s.manager.GetAllPrinters()
 
+	result := make([]printerWithStatus, len(printers))
+	for i, p := range printers {
+		result[i] = printerWithStatus{
+			Printer:        p,
+			CompletionMode: s.manager.GetCompletionMode(p.ID),
+			Output:         s.manager.GetOutputMode(p.ID),
+			FlowControl:    s.manager.GetFlowControl(p.ID),
+		}
+		if prof := s.manager.GetProfile(p.ID); prof != nil {
+			result[i].Profile = prof.Name
+		}
+		if status, ok := s.manager.GetPrinterStatus(p.ID); ok {
+			result[i].Status = &status
+		}
+	}
+
 	c.JSON(200, gin.H{
-		"printers": printers,
+		"printers": result,
 	})
 }
 
@@ -107,6 +148,190 @@ func (s *Server) handleSetPrinterName(c *gin.Context) {
 	c.JSON(200, gin.H{"success": true})
 }
 
+// handlePausePrinter holds a printer's queued jobs until it is resumed
+func (s *Server) handlePausePrinter(c *gin.Context) {
+	printerID := c.Param("id")
+
+	if s.manager.GetPrinter(printerID) == nil {
+		c.JSON(404, gin.H{"error": "printer not found"})
+		return
+	}
+
+	s.queue.PausePrinter(printerID)
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleResumePrinter resumes printing a paused printer's jobs
+func (s *Server) handleResumePrinter(c *gin.Context) {
+	printerID := c.Param("id")
+
+	if s.manager.GetPrinter(printerID) == nil {
+		c.JSON(404, gin.H{"error": "printer not found"})
+		return
+	}
+
+	s.queue.ResumePrinter(printerID)
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleOpenDrawer kicks the cash drawer connected to a printer without printing
+func (s *Server) handleOpenDrawer(c *gin.Context) {
+	printerID := c.Param("id")
+
+	// The body is optional; an empty one uses the default pulse on pin 2
+	var req struct {
+		Pin     int `json:"pin"`
+		OnTime  int `json:"on_time"`
+		OffTime int `json:"off_time"`
+	}
+
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+	}
+
+	if req.Pin != 0 && req.Pin != 2 && req.Pin != 5 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid pin: %d (use 2 or 5)", req.Pin)})
+		return
+	}
+	if req.OnTime < 0 || req.OnTime > 510 || req.OffTime < 0 || req.OffTime > 510 {
+		c.JSON(400, gin.H{"error": "on_time and off_time must be between 0 and 510 ms"})
+		return
+	}
+
+	p := s.manager.GetPrinter(printerID)
+	if p == nil {
+		c.JSON(404, gin.H{"error": "printer not found"})
+		return
+	}
+
+	if err := s.pool.OpenDrawer(p, req.Pin, req.OnTime, req.OffTime); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleSetCompletionMode sets how a printer's jobs are confirmed as printed
+func (s *Server) handleSetCompletionMode(c *gin.Context) {
+	printerID := c.Param("id")
+
+	var req struct {
+		Mode string `json:"mode" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "mode is required"})
+		return
+	}
+
+	if !printer.ValidCompletionMode(req.Mode) {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid mode: %s (use %s, %s or %s)", req.Mode,
+			printer.CompletionFireAndForget, printer.CompletionStatus, printer.CompletionProcessID)})
+		return
+	}
+
+	if !s.manager.SetCompletionMode(printerID, req.Mode) {
+		c.JSON(404, gin.H{"error": "printer not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleSetFlowControl sets how a printer is waited for between raster bands
+func (s *Server) handleSetFlowControl(c *gin.Context) {
+	printerID := c.Param("id")
+
+	var req struct {
+		Mode string `json:"mode" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "mode is required"})
+		return
+	}
+
+	if !printer.ValidFlowControl(req.Mode) {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid mode: %s (use %s, %s or %s)", req.Mode,
+			printer.FlowNone, printer.FlowStatus, printer.FlowXonXoff)})
+		return
+	}
+
+	if !s.manager.SetFlowControl(printerID, req.Mode) {
+		c.JSON(404, gin.H{"error": "printer not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleSetOutputMode sets whether receipts are sent to a printer as an image or as native ESC/POS
+func (s *Server) handleSetOutputMode(c *gin.Context) {
+	printerID := c.Param("id")
+
+	var req struct {
+		Mode string `json:"mode" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "mode is required"})
+		return
+	}
+
+	if !printer.ValidOutputMode(req.Mode) {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid mode: %s (use %s or %s)", req.Mode,
+			printer.OutputRaster, printer.OutputNative)})
+		return
+	}
+
+	if !s.manager.SetOutputMode(printerID, req.Mode) {
+		c.JSON(404, gin.H{"error": "printer not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleSetProfile sets a printer's capability profile. An empty profile
+// detects it from the printer's USB IDs or model name again.
+func (s *Server) handleSetProfile(c *gin.Context) {
+	printerID := c.Param("id")
+
+	var req struct {
+		Profile string `json:"profile"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	if req.Profile != "" && profile.Find(req.Profile) == nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("unknown profile: %s", req.Profile)})
+		return
+	}
+
+	if !s.manager.SetProfile(printerID, req.Profile) {
+		c.JSON(404, gin.H{"error": "printer not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleGetProfiles returns the known printer capability profiles
+func (s *Server) handleGetProfiles(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"profiles": profile.All(),
+	})
+}
+
 // handleAddNetworkPrinter manually adds a network printer
 func (s *Server) handleAddNetworkPrinter(c *gin.Context) {
 	var req struct {
@@ -191,6 +416,8 @@ func (s *Server) handlePrint(c *gin.Context) {
 		ReceiptURL        string                              `json:"receipt_url"`
 		VariableData      map[string]interface{}              `json:"variableData"`
 		VariableArrayData map[string][]map[string]interface{} `json:"variableArrayData"`
+		Priority          int                                 `json:"priority"`
+		IdempotencyKey    string                              `json:"idempotency_key"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -198,6 +425,21 @@ func (s *Server) handlePrint(c *gin.Context) {
 		return
 	}
 
+	// The Idempotency-Key header takes precedence over the body field
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if idempotencyKey == "" {
+		idempotencyKey = req.IdempotencyKey
+	}
+
+	// A retried submission gets its original job without rendering again
+	if jobID, ok := s.queue.JobForKey(idempotencyKey); ok {
+		c.JSON(200, gin.H{
+			"success": true,
+			"job_id":  jobID,
+		})
+		return
+	}
+
 	// Load receipt from path/URL if provided, otherwise use direct receipt
 	var receipt *receiptformat.Receipt
 	var err error
@@ -248,15 +490,22 @@ func (s *Server) handlePrint(c *gin.Context) {
 		p.SetVariableArrayData(req.VariableArrayData)
 	}
 
-	// Execute
-	img, err := p.Execute()
+	// Execute as an image or native ESC/POS, depending on the printer and receipt
+	payload, err := printer.RenderReceipt(p, s.manager.GetOutputMode(req.PrinterID), s.manager.GetProfile(req.PrinterID))
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("failed to render receipt: %v", err)})
 		return
 	}
 
 	// Enqueue print job
-	jobID := s.queue.Enqueue(req.PrinterID, img)
+	jobID, err := s.queue.EnqueuePayload(req.PrinterID, payload, printer.JobOptions{
+		Priority:       req.Priority,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("failed to queue print job: %v", err)})
+		return
+	}
 
 	c.JSON(200, gin.H{
 		"success": true,
@@ -264,23 +513,52 @@ func (s *Server) handlePrint(c *gin.Context) {
 	})
 }
 
+// jobData converts a print job to a JSON-safe format
+func jobData(job *printer.PrintJob) map[string]interface{} {
+	data := map[string]interface{}{
+		"id":         job.ID,
+		"printer_id": job.PrinterID,
+		"status":     job.Status,
+		"retries":    job.Retries,
+		"priority":   job.Priority,
+		"created_at": job.CreatedAt,
+	}
+	if job.Error != nil {
+		data["error"] = job.Error.Error()
+	}
+	if !job.NextAttemptAt.IsZero() {
+		data["next_attempt_at"] = job.NextAttemptAt
+	}
+	if job.IdempotencyKey != "" {
+		data["idempotency_key"] = job.IdempotencyKey
+	}
+	if job.BandsTotal > 0 {
+		data["bands_sent"] = job.BandsSent
+		data["bands_total"] = job.BandsTotal
+	}
+
+	return data
+}
+
 // handleGetJobs returns all print jobs
 func (s *Server) handleGetJobs(c *gin.Context) {
 	jobs := s.queue.GetAllJobs()
 
-	// Convert to JSON-safe format
 	jobsData := make([]map[string]interface{}, len(jobs))
 	for i, job := range jobs {
-		jobsData[i] = map[string]interface{}{
-			"id":         job.ID,
-			"printer_id": job.PrinterID,
-			"status":     job.Status,
-			"retries":    job.Retries,
-			"created_at": job.CreatedAt,
-		}
-		if job.Error != nil {
-			jobsData[i]["error"] = job.Error.Error()
-		}
+		jobsData[i] = jobData(job)
+	}
+
+	c.JSON(200, gin.H{"jobs": jobsData})
+}
+
+// handleGetDeadJobs returns the jobs in the dead-letter state
+func (s *Server) handleGetDeadJobs(c *gin.Context) {
+	jobs := s.queue.GetDeadJobs()
+
+	jobsData := make([]map[string]interface{}, len(jobs))
+	for i, job := range jobs {
+		jobsData[i] = jobData(job)
 	}
 
 	c.JSON(200, gin.H{"jobs": jobsData})
@@ -296,18 +574,64 @@ func (s *Server) handleGetJob(c *gin.Context) {
 		return
 	}
 
-	jobData := map[string]interface{}{
-		"id":         job.ID,
-		"printer_id": job.PrinterID,
-		"status":     job.Status,
-		"retries":    job.Retries,
-		"created_at": job.CreatedAt,
+	c.JSON(200, jobData(job))
+}
+
+// handleRequeueJob moves a dead job back into the queue
+func (s *Server) handleRequeueJob(c *gin.Context) {
+	if err := s.queue.Requeue(c.Param("id")); err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
 	}
-	if job.Error != nil {
-		jobData["error"] = job.Error.Error()
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleDiscardJob removes a dead job
+func (s *Server) handleDiscardJob(c *gin.Context) {
+	if err := s.queue.Discard(c.Param("id")); err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(200, jobData)
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleCancelJob cancels a queued or dead job
+func (s *Server) handleCancelJob(c *gin.Context) {
+	if err := s.queue.Cancel(c.Param("id")); err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// handleSetJobPriority changes the priority of a queued job
+func (s *Server) handleSetJobPriority(c *gin.Context) {
+	var req struct {
+		Priority *int `json:"priority" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "priority is required"})
+		return
+	}
+
+	if err := s.queue.SetPriority(c.Param("id"), *req.Priority); err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+// jobErrorStatus maps a queue error to an HTTP status code
+func jobErrorStatus(err error) int {
+	if errors.Is(err, printer.ErrJobNotFound) {
+		return 404
+	}
+	return 409
 }
 
 // handleCommand handles command execution requests
@@ -17,6 +17,8 @@ const (
 	EventPrint          = "print"
 	EventPrinterAdded   = "printer_added"
 	EventPrinterRemoved = "printer_removed"
+	EventPrinterStatus  = "printer_status"
+	EventJobProgress    = "job_progress"
 	EventResponse       = "response"
 	EventError          = "error"
 )
@@ -88,6 +90,24 @@ func (c *WSClient) handlePrintEvent(data map[string]interface{}) {
 		return
 	}
 
+	// Optional priority (JSON numbers decode as float64) and idempotency key
+	var opts printer.JobOptions
+	if priority, ok := data["priority"].(float64); ok {
+		opts.Priority = int(priority)
+	}
+	if key, ok := data["idempotency_key"].(string); ok {
+		opts.IdempotencyKey = key
+	}
+
+	// A retried submission gets its original job without rendering again
+	if jobID, ok := c.server.queue.JobForKey(opts.IdempotencyKey); ok {
+		c.sendResponse(map[string]interface{}{
+			"success": true,
+			"job_id":  jobID,
+		})
+		return
+	}
+
 	// Load receipt from path/URL if provided, otherwise use direct receipt
 	var receipt *receiptformat.Receipt
 	var err error
@@ -171,15 +191,19 @@ func (c *WSClient) handlePrintEvent(data map[string]interface{}) {
 		p.SetVariableArrayData(variableArrayData)
 	}
 
-	// Execute
-	img, err := p.Execute()
+	// Execute as an image or native ESC/POS, depending on the printer and receipt
+	payload, err := printer.RenderReceipt(p, c.server.manager.GetOutputMode(printerID), c.server.manager.GetProfile(printerID))
 	if err != nil {
 		c.sendError(fmt.Sprintf("failed to render receipt: %v", err))
 		return
 	}
 
 	// Enqueue print job
-	jobID := c.server.queue.Enqueue(printerID, img)
+	jobID, err := c.server.queue.EnqueuePayload(printerID, payload, opts)
+	if err != nil {
+		c.sendError(fmt.Sprintf("failed to queue print job: %v", err))
+		return
+	}
 
 	c.sendResponse(map[string]interface{}{
 		"success": true,
@@ -292,3 +316,48 @@ func (s *Server) BroadcastPrinterRemoved(printerID string) {
 
 	// Broadcast printer removed - handled by callbacks
 }
+
+// BroadcastPrinterStatus broadcasts a printer status change to all connected clients
+func (s *Server) BroadcastPrinterStatus(printerID string, status printer.PrinterStatus) {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+
+	message := WSMessage{
+		Event: EventPrinterStatus,
+		Data: map[string]interface{}{
+			"id":     printerID,
+			"status": status,
+		},
+	}
+
+	for client := range clients {
+		select {
+		case client.send <- message:
+		default:
+			// Client send buffer full, skip
+		}
+	}
+}
+
+// BroadcastJobProgress broadcasts how many raster bands of a job have been sent
+func (s *Server) BroadcastJobProgress(jobID string, sent, total int) {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+
+	message := WSMessage{
+		Event: EventJobProgress,
+		Data: map[string]interface{}{
+			"job_id": jobID,
+			"sent":   sent,
+			"total":  total,
+		},
+	}
+
+	for client := range clients {
+		select {
+		case client.send <- message:
+		default:
+			// Client send buffer full, skip
+		}
+	}
+}
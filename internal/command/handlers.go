@@ -12,18 +12,20 @@ import (
 	"time"
 
 	"github.com/thereceipt/receipt-engine/internal/parser"
+	"github.com/thereceipt/receipt-engine/internal/printer"
+	"github.com/thereceipt/receipt-engine/internal/profile"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
 // handlePrint handles print commands
-// Usage: print <printer-id> <receipt-path> [--repeat N] [--var key=value] [--var-array key=value1,value2]
+// Usage: print <printer-id> <receipt-path> [--repeat N] [--priority N] [--idempotency-key K] [--var key=value] [--var-array key=value1,value2]
 //
-//	print <printer-id> --compose <commands...> [--repeat N] [--var key=value] [--var-array key=value1,value2]
+//	print <printer-id> --compose <commands...> [--repeat N] [--priority N] [--idempotency-key K] [--var key=value] [--var-array key=value1,value2]
 func (e *Executor) handlePrint(args []string) *Result {
 	if len(args) < 2 {
 		return &Result{
 			Success: false,
-			Error:   "usage: print <printer-id> <receipt-path> [--repeat N] [--var key=value] [--var-array key=value1,value2]",
+			Error:   "usage: print <printer-id> <receipt-path> [--repeat N] [--priority N] [--idempotency-key K] [--var key=value] [--var-array key=value1,value2]",
 		}
 	}
 
@@ -31,8 +33,7 @@ func (e *Executor) handlePrint(args []string) *Result {
 	receiptArg := args[1]
 
 	// Check if printer exists
-	printer := e.manager.GetPrinter(printerID)
-	if printer == nil {
+	if e.manager.GetPrinter(printerID) == nil {
 		return &Result{
 			Success: false,
 			Error:   fmt.Sprintf("printer not found: %s", printerID),
@@ -50,7 +51,7 @@ func (e *Executor) handlePrint(args []string) *Result {
 	// Case 1: TUI / raw command string: print <printer-id> --compose <commands...> [flags...]
 	if receiptArg == "--compose" {
 		if len(args) < 3 {
-			return &Result{Success: false, Error: "usage: print <printer-id> --compose <commands...> [--repeat N] [--var key=value] [--var-array key=value1,value2]"}
+			return &Result{Success: false, Error: "usage: print <printer-id> --compose <commands...> [--repeat N] [--priority N] [--idempotency-key K] [--var key=value] [--var-array key=value1,value2]"}
 		}
 
 		composeArgs := []string{}
@@ -62,7 +63,7 @@ func (e *Executor) handlePrint(args []string) *Result {
 			composeArgs = append(composeArgs, args[i])
 		}
 		if len(composeArgs) == 0 {
-			return &Result{Success: false, Error: "usage: print <printer-id> --compose <commands...> [--repeat N] [--var key=value] [--var-array key=value1,value2]"}
+			return &Result{Success: false, Error: "usage: print <printer-id> --compose <commands...> [--repeat N] [--priority N] [--idempotency-key K] [--var key=value] [--var-array key=value1,value2]"}
 		}
 
 		receiptJSON, composeErr := createComposedReceiptJSON(composeArgs)
@@ -113,6 +114,8 @@ func (e *Executor) handlePrint(args []string) *Result {
 	varData := make(map[string]interface{})
 	varArrayData := make(map[string][]map[string]interface{})
 	repeat := 1
+	priority := 0
+	idempotencyKey := ""
 
 	for i := optionsIdx; i < len(args); i++ {
 		arg := args[i]
@@ -140,6 +143,43 @@ func (e *Executor) handlePrint(args []string) *Result {
 			continue
 		}
 
+		// --priority N / --priority=N
+		if arg == "--priority" {
+			if i+1 >= len(args) {
+				return &Result{Success: false, Error: "usage: --priority <number>"}
+			}
+			n, convErr := strconv.Atoi(args[i+1])
+			if convErr != nil {
+				return &Result{Success: false, Error: fmt.Sprintf("invalid --priority value: %s", args[i+1])}
+			}
+			priority = n
+			i++
+			continue
+		}
+		if strings.HasPrefix(arg, "--priority=") {
+			nStr := strings.TrimPrefix(arg, "--priority=")
+			n, convErr := strconv.Atoi(nStr)
+			if convErr != nil {
+				return &Result{Success: false, Error: fmt.Sprintf("invalid --priority value: %s", nStr)}
+			}
+			priority = n
+			continue
+		}
+
+		// --idempotency-key K / --idempotency-key=K
+		if arg == "--idempotency-key" {
+			if i+1 >= len(args) {
+				return &Result{Success: false, Error: "usage: --idempotency-key <key>"}
+			}
+			idempotencyKey = args[i+1]
+			i++
+			continue
+		}
+		if strings.HasPrefix(arg, "--idempotency-key=") {
+			idempotencyKey = strings.TrimPrefix(arg, "--idempotency-key=")
+			continue
+		}
+
 		// --var key=value / --var=key=value
 		if arg == "--var" {
 			if i+1 >= len(args) {
@@ -224,8 +264,8 @@ func (e *Executor) handlePrint(args []string) *Result {
 		p.SetVariableArrayData(varArrayData)
 	}
 
-	// Execute
-	img, err := p.Execute()
+	// Execute as an image or native ESC/POS, depending on the printer and receipt
+	payload, err := printer.RenderReceipt(p, e.manager.GetOutputMode(printerID), e.manager.GetProfile(printerID))
 	if err != nil {
 		return &Result{
 			Success: false,
@@ -236,7 +276,19 @@ func (e *Executor) handlePrint(args []string) *Result {
 	// Enqueue print job(s)
 	jobIDs := make([]string, 0, repeat)
 	for i := 0; i < repeat; i++ {
-		jobIDs = append(jobIDs, e.queue.Enqueue(printerID, img))
+		opts := printer.JobOptions{Priority: priority, IdempotencyKey: idempotencyKey}
+		// Each copy needs its own key, otherwise repeats collapse into one job
+		if idempotencyKey != "" && i > 0 {
+			opts.IdempotencyKey = fmt.Sprintf("%s#%d", idempotencyKey, i+1)
+		}
+		jobID, err := e.queue.EnqueuePayload(printerID, payload, opts)
+		if err != nil {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("failed to queue print job: %v", err),
+			}
+		}
+		jobIDs = append(jobIDs, jobID)
 	}
 
 	// Get printer name for better message
@@ -297,12 +349,12 @@ func (e *Executor) handleServer(args []string) *Result {
 }
 
 // handlePrinter handles printer commands
-// Usage: printer list | add-network <host> [port] | rename <id> <name>
+// Usage: printer list | add-network <host> [port] | rename <id> <name> | pause <id> | resume <id> | completion <id> <mode> | output <id> <mode> | drawer <id> [pin] | profile <id> <name> | profiles | flow-control <id> <mode>
 func (e *Executor) handlePrinter(args []string) *Result {
 	if len(args) == 0 {
 		return &Result{
 			Success: false,
-			Error:   "usage: printer <list|add-network|rename>",
+			Error:   "usage: printer <list|add-network|rename|pause|resume|completion|output|drawer|profile|profiles|flow-control>",
 		}
 	}
 
@@ -318,6 +370,16 @@ func (e *Executor) handlePrinter(args []string) *Result {
 				"type":        p.Type,
 				"description": p.Description,
 				"name":        p.Name,
+				"paused":      e.queue.IsPrinterPaused(p.ID),
+				"completion":  e.manager.GetCompletionMode(p.ID),
+				"output":      e.manager.GetOutputMode(p.ID),
+				"flow":        e.manager.GetFlowControl(p.ID),
+			}
+			if prof := e.manager.GetProfile(p.ID); prof != nil {
+				printerList[i]["profile"] = prof.Name
+			}
+			if status, ok := e.manager.GetPrinterStatus(p.ID); ok {
+				printerList[i]["status"] = status
 			}
 			if p.Type == "network" {
 				printerList[i]["host"] = p.Host
@@ -415,21 +477,253 @@ func (e *Executor) handlePrinter(args []string) *Result {
 			},
 		}
 
+	case "pause", "resume":
+		if len(args) < 2 {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("usage: printer %s <id>", subcommand),
+			}
+		}
+		printerID := args[1]
+		if e.manager.GetPrinter(printerID) == nil {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("printer not found: %s", printerID),
+			}
+		}
+		message := fmt.Sprintf("Paused printer %s", printerID)
+		if subcommand == "pause" {
+			e.queue.PausePrinter(printerID)
+		} else {
+			e.queue.ResumePrinter(printerID)
+			message = fmt.Sprintf("Resumed printer %s", printerID)
+		}
+		return &Result{
+			Success: true,
+			Message: message,
+			Data: map[string]interface{}{
+				"printer_id": printerID,
+				"paused":     subcommand == "pause",
+			},
+		}
+
+	case "drawer":
+		if len(args) < 2 {
+			return &Result{
+				Success: false,
+				Error:   "usage: printer drawer <id> [2|5]",
+			}
+		}
+		printerID := args[1]
+		pin := 2
+		if len(args) > 2 {
+			if _, err := fmt.Sscanf(args[2], "%d", &pin); err != nil || (pin != 2 && pin != 5) {
+				return &Result{
+					Success: false,
+					Error:   fmt.Sprintf("invalid drawer pin: %s (use: 2, 5)", args[2]),
+				}
+			}
+		}
+		p := e.manager.GetPrinter(printerID)
+		if p == nil {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("printer not found: %s", printerID),
+			}
+		}
+		if err := e.pool.OpenDrawer(p, pin, 0, 0); err != nil {
+			return &Result{
+				Success: false,
+				Error:   err.Error(),
+			}
+		}
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Opened cash drawer on printer %s", printerID),
+			Data: map[string]interface{}{
+				"printer_id": printerID,
+				"pin":        pin,
+			},
+		}
+
+	case "completion":
+		if len(args) < 3 {
+			return &Result{
+				Success: false,
+				Error:   "usage: printer completion <id> <fire_and_forget|status|process_id>",
+			}
+		}
+		printerID := args[1]
+		mode := args[2]
+		if !printer.ValidCompletionMode(mode) {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("invalid completion mode: %s (use: fire_and_forget, status, process_id)", mode),
+			}
+		}
+		if !e.manager.SetCompletionMode(printerID, mode) {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("printer not found: %s", printerID),
+			}
+		}
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Printer %s now uses %s completion", printerID, mode),
+			Data: map[string]interface{}{
+				"printer_id": printerID,
+				"completion": mode,
+			},
+		}
+
+	case "flow-control":
+		if len(args) < 3 {
+			return &Result{
+				Success: false,
+				Error:   "usage: printer flow-control <id> <none|status|xonxoff>",
+			}
+		}
+		printerID := args[1]
+		mode := args[2]
+		if !printer.ValidFlowControl(mode) {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("invalid flow control: %s (use: none, status, xonxoff)", mode),
+			}
+		}
+		if !e.manager.SetFlowControl(printerID, mode) {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("printer not found: %s", printerID),
+			}
+		}
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Printer %s now uses %s flow control", printerID, mode),
+			Data: map[string]interface{}{
+				"printer_id":   printerID,
+				"flow_control": mode,
+			},
+		}
+
+	case "output":
+		if len(args) < 3 {
+			return &Result{
+				Success: false,
+				Error:   "usage: printer output <id> <raster|native>",
+			}
+		}
+		printerID := args[1]
+		mode := args[2]
+		if !printer.ValidOutputMode(mode) {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("invalid output mode: %s (use: raster, native)", mode),
+			}
+		}
+		if !e.manager.SetOutputMode(printerID, mode) {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("printer not found: %s", printerID),
+			}
+		}
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Printer %s now uses %s output", printerID, mode),
+			Data: map[string]interface{}{
+				"printer_id": printerID,
+				"output":     mode,
+			},
+		}
+
+	case "profile":
+		if len(args) < 3 {
+			return &Result{
+				Success: false,
+				Error:   "usage: printer profile <id> <name|auto>",
+			}
+		}
+		printerID := args[1]
+		name := args[2]
+		if name == "auto" {
+			name = ""
+		} else if profile.Find(name) == nil {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("unknown profile: %s (see: printer profiles)", name),
+			}
+		}
+		if !e.manager.SetProfile(printerID, name) {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("printer not found: %s", printerID),
+			}
+		}
+		message := fmt.Sprintf("Printer %s now uses the %s profile", printerID, name)
+		if name == "" {
+			message = fmt.Sprintf("Printer %s now detects its profile", printerID)
+		}
+		return &Result{
+			Success: true,
+			Message: message,
+			Data: map[string]interface{}{
+				"printer_id": printerID,
+				"profile":    name,
+			},
+		}
+
+	case "profiles":
+		profiles := profile.All()
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Found %d profile(s):", len(profiles)),
+			Data: map[string]interface{}{
+				"profiles": profiles,
+			},
+		}
+
 	default:
 		return &Result{
 			Success: false,
-			Error:   fmt.Sprintf("unknown printer subcommand: %s. Use: list, add-network, rename", subcommand),
+			Error:   fmt.Sprintf("unknown printer subcommand: %s. Use: list, add-network, rename, pause, resume, completion, output, drawer, profile, profiles, flow-control", subcommand),
 		}
 	}
 }
 
+// jobToData converts a print job to result data
+func jobToData(job *printer.PrintJob) map[string]interface{} {
+	data := map[string]interface{}{
+		"id":         job.ID,
+		"printer_id": job.PrinterID,
+		"status":     job.Status,
+		"retries":    job.Retries,
+		"priority":   job.Priority,
+		"created_at": job.CreatedAt,
+	}
+	if job.Error != nil {
+		data["error"] = job.Error.Error()
+	}
+	if !job.NextAttemptAt.IsZero() {
+		data["next_attempt_at"] = job.NextAttemptAt
+	}
+	if job.IdempotencyKey != "" {
+		data["idempotency_key"] = job.IdempotencyKey
+	}
+	if job.BandsTotal > 0 {
+		data["bands_sent"] = job.BandsSent
+		data["bands_total"] = job.BandsTotal
+	}
+
+	return data
+}
+
 // handleJob handles job commands
-// Usage: job list | status <id> | clear
+// Usage: job list | status <id> | clear | dead | requeue <id> | discard <id> | cancel <id> | priority <id> <n>
 func (e *Executor) handleJob(args []string) *Result {
 	if len(args) == 0 {
 		return &Result{
 			Success: false,
-			Error:   "usage: job <list|status|clear>",
+			Error:   "usage: job <list|status|clear|dead|requeue|discard|cancel|priority>",
 		}
 	}
 
@@ -440,16 +734,7 @@ func (e *Executor) handleJob(args []string) *Result {
 		jobs := e.queue.GetAllJobs()
 		jobList := make([]map[string]interface{}, len(jobs))
 		for i, job := range jobs {
-			jobList[i] = map[string]interface{}{
-				"id":         job.ID,
-				"printer_id": job.PrinterID,
-				"status":     job.Status,
-				"retries":    job.Retries,
-				"created_at": job.CreatedAt,
-			}
-			if job.Error != nil {
-				jobList[i]["error"] = job.Error.Error()
-			}
+			jobList[i] = jobToData(job)
 		}
 		return &Result{
 			Success: true,
@@ -459,6 +744,85 @@ func (e *Executor) handleJob(args []string) *Result {
 			},
 		}
 
+	case "dead":
+		jobs := e.queue.GetDeadJobs()
+		jobList := make([]map[string]interface{}, len(jobs))
+		for i, job := range jobs {
+			jobList[i] = jobToData(job)
+		}
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Found %d dead job(s):", len(jobs)),
+			Data: map[string]interface{}{
+				"jobs": jobList,
+			},
+		}
+
+	case "requeue", "discard", "cancel":
+		if len(args) < 2 {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("usage: job %s <id>", subcommand),
+			}
+		}
+		jobID := args[1]
+		var err error
+		var message string
+		switch subcommand {
+		case "requeue":
+			err = e.queue.Requeue(jobID)
+			message = fmt.Sprintf("Requeued job %s", jobID)
+		case "discard":
+			err = e.queue.Discard(jobID)
+			message = fmt.Sprintf("Discarded job %s", jobID)
+		case "cancel":
+			err = e.queue.Cancel(jobID)
+			message = fmt.Sprintf("Cancelled job %s", jobID)
+		}
+		if err != nil {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("%v: %s", err, jobID),
+			}
+		}
+		return &Result{
+			Success: true,
+			Message: message,
+			Data: map[string]interface{}{
+				"job_id": jobID,
+			},
+		}
+
+	case "priority":
+		if len(args) < 3 {
+			return &Result{
+				Success: false,
+				Error:   "usage: job priority <id> <n>",
+			}
+		}
+		jobID := args[1]
+		priority, err := strconv.Atoi(args[2])
+		if err != nil {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("invalid priority: %s", args[2]),
+			}
+		}
+		if err := e.queue.SetPriority(jobID, priority); err != nil {
+			return &Result{
+				Success: false,
+				Error:   fmt.Sprintf("%v: %s", err, jobID),
+			}
+		}
+		return &Result{
+			Success: true,
+			Message: fmt.Sprintf("Set priority of job %s to %d", jobID, priority),
+			Data: map[string]interface{}{
+				"job_id":   jobID,
+				"priority": priority,
+			},
+		}
+
 	case "status":
 		if len(args) < 2 {
 			return &Result{
@@ -474,16 +838,7 @@ func (e *Executor) handleJob(args []string) *Result {
 				Error:   fmt.Sprintf("job not found: %s", jobID),
 			}
 		}
-		jobData := map[string]interface{}{
-			"id":         job.ID,
-			"printer_id": job.PrinterID,
-			"status":     job.Status,
-			"retries":    job.Retries,
-			"created_at": job.CreatedAt,
-		}
-		if job.Error != nil {
-			jobData["error"] = job.Error.Error()
-		}
+		jobData := jobToData(job)
 		statusMsg := fmt.Sprintf("Job %s: status=%s, printer=%s, retries=%d", job.ID, job.Status, job.PrinterID, job.Retries)
 		if job.Error != nil {
 			statusMsg += fmt.Sprintf(", error=%s", job.Error.Error())
@@ -498,14 +853,14 @@ func (e *Executor) handleJob(args []string) *Result {
 		allJobs := e.queue.GetAllJobs()
 		completedCount := 0
 		for _, job := range allJobs {
-			if job.Status == "completed" {
+			if job.Status == "completed" || job.Status == "cancelled" {
 				completedCount++
 			}
 		}
 		e.queue.ClearCompleted()
-		message := "Cleared completed jobs"
+		message := "Cleared finished jobs"
 		if completedCount > 0 {
-			message = fmt.Sprintf("Cleared %d completed job(s)", completedCount)
+			message = fmt.Sprintf("Cleared %d finished job(s)", completedCount)
 		}
 		return &Result{
 			Success: true,
@@ -515,7 +870,7 @@ func (e *Executor) handleJob(args []string) *Result {
 	default:
 		return &Result{
 			Success: false,
-			Error:   fmt.Sprintf("unknown job subcommand: %s. Use: list, status, clear", subcommand),
+			Error:   fmt.Sprintf("unknown job subcommand: %s. Use: list, status, clear, dead, requeue, discard, cancel, priority", subcommand),
 		}
 	}
 }
@@ -575,14 +930,19 @@ func (e *Executor) handleHelp(args []string) *Result {
       text:"Title" size:32 align:center weight:bold - Text with properties
       feed:2                          - Feed N lines
       cut                             - Cut paper
+      cut mode:partial                - Partial cut (leaves a small bridge)
+      drawer                          - Open the cash drawer
+      drawer pin:5                    - Open the drawer on kick-out pin 5
       divider                         - Add divider line
       divider style:solid|dashed|dotted|double - Divider with style
       image:"/path/to/image.png"      - Print image from path
       barcode:"123456"                - Print barcode
       barcode:"123456" format:CODE128 height:50 - Barcode with options
       qrcode:"https://example.com"    - Print QR code
+      pdf417:"data" ecc_level:0-8 size:2   - PDF417 (also datamatrix:, aztec:)
     
     Note: Use align as a property of text commands (e.g., text:"Hello" align:center)
+    Note: Add --idempotency-key K so a retried submission returns the original job
     
     Example: print printer-123 --compose text:"Hello" feed:2 cut
 
@@ -604,6 +964,30 @@ func (e *Executor) handleHelp(args []string) *Result {
   printer rename <id> <name>
     Set a custom name for a printer
     
+  printer pause <id>
+    Hold queued jobs for a printer (e.g. while changing paper)
+    
+  printer resume <id>
+    Resume printing queued jobs
+    
+  printer completion <id> <fire_and_forget|status|process_id>
+    Choose whether jobs complete once sent or once the printer confirms them
+    
+  printer output <id> <raster|native>
+    Send receipts as one image or as native ESC/POS text, barcodes and QR codes
+    
+  printer flow-control <id> <none|status|xonxoff>
+    Wait for the printer (DLE EOT or XON/XOFF) between bands of large images
+    
+  printer drawer <id> [2|5]
+    Open the cash drawer on a printer's kick-out pin (default 2) without printing
+    
+  printer profile <id> <name|auto>
+    Set a printer's capability profile (width, cutter, code pages), or detect it
+    
+  printer profiles
+    List known printer capability profiles
+    
   job list
     List all print jobs
     
@@ -611,7 +995,22 @@ func (e *Executor) handleHelp(args []string) *Result {
     Get status of a specific job
     
   job clear
-    Clear completed jobs from the queue
+    Clear completed and cancelled jobs from the queue
+    
+  job cancel <id>
+    Cancel a queued or dead job
+    
+  job priority <id> <n>
+    Change the priority of a queued job (higher prints first)
+    
+  job dead
+    List jobs in the dead-letter state
+    
+  job requeue <id>
+    Retry a dead job with a fresh retry budget
+    
+  job discard <id>
+    Remove a dead job
     
   detect
     Detect/scan for printers
@@ -715,7 +1114,7 @@ func createComposedReceiptJSON(composeArgs []string) ([]byte, error) {
 func isCommandStart(arg string) bool {
 	// Check for command types: text:, feed:, cut, divider, etc.
 	// Note: align is not a standalone command - use it as a property of text commands
-	knownCommands := []string{"text:", "feed:", "cut", "divider", "image:", "barcode:", "qrcode:"}
+	knownCommands := []string{"text:", "feed:", "cut", "drawer", "divider", "image:", "barcode:", "qrcode:", "pdf417:", "datamatrix:", "aztec:"}
 	for _, cmd := range knownCommands {
 		if strings.HasPrefix(arg, cmd) || arg == strings.TrimSuffix(cmd, ":") {
 			return true
@@ -754,7 +1153,7 @@ func parseComposeCommandStart(arg string) (map[string]interface{}, error) {
 		cmd["lines"] = lines
 	case "image":
 		cmd["path"] = strings.Trim(firstValue, `"'`)
-	case "barcode", "qrcode":
+	case "barcode", "qrcode", "pdf417", "datamatrix", "aztec":
 		cmd["value"] = strings.Trim(firstValue, `"'`)
 	default:
 		// For unknown command types, treat first value as a generic value
@@ -0,0 +1,617 @@
+// Package escpos encodes receipts as native ESC/POS commands, so the printer
+// draws text, barcodes and QR codes itself instead of printing one large image
+package escpos
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/thereceipt/receipt-engine/internal/profile"
+	"github.com/thereceipt/receipt-engine/internal/renderer"
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+// charWidth is the width in dots of a character in the printer's Font A
+const charWidth = 12
+
+// ESC/POS commands
+var (
+	cmdInitialize = []byte{0x1B, 0x40}       // ESC @
+	cmdBoldOn     = []byte{0x1B, 0x45, 0x01} // ESC E 1
+	cmdBoldOff    = []byte{0x1B, 0x45, 0x00} // ESC E 0
+)
+
+// tearOffLines is how far a printer without a cutter feeds so the last line
+// clears the tear bar
+const tearOffLines = 4
+
+// lineHeight is the printer's default line spacing in dots
+const lineHeight = 30
+
+// Encoder converts resolved receipt commands to an ESC/POS byte stream
+type Encoder struct {
+	receipt    *receiptformat.Receipt // For custom fonts in raster fallbacks
+	paperWidth string
+	profile    *profile.Profile // Nil for a generic printer
+	width      int              // Printable width in dots
+	buf        bytes.Buffer
+}
+
+// New creates a new encoder
+func New(receipt *receiptformat.Receipt, paperWidth string) *Encoder {
+	return &Encoder{
+		receipt:    receipt,
+		paperWidth: paperWidth,
+		width:      renderer.PaperWidthPixels(paperWidth),
+	}
+}
+
+// SetProfile sets the printer's capabilities. Commands the printer can't
+// draw itself are rasterised, and the line is no wider than it can print.
+func (e *Encoder) SetProfile(p *profile.Profile) {
+	e.profile = p
+	e.width = p.Width(renderer.PaperWidthPixels(e.paperWidth))
+}
+
+// Encode converts commands whose variables and arrays have already been
+// resolved. Anything the printer can't draw itself - images, boxes, custom
+// fonts and text outside the printer's code pages - is rendered and sent as a raster image.
+func (e *Encoder) Encode(cmds []receiptformat.Command) ([]byte, error) {
+	e.buf.Reset()
+	e.buf.Write(cmdInitialize)
+
+	for i := range cmds {
+		if err := e.encodeCommand(&cmds[i]); err != nil {
+			return nil, fmt.Errorf("failed to encode %s command: %w", cmds[i].Type, err)
+		}
+	}
+
+	return bytes.Clone(e.buf.Bytes()), nil
+}
+
+func (e *Encoder) encodeCommand(cmd *receiptformat.Command) error {
+	if e.needsRaster(cmd) {
+		return e.encodeRaster(cmd)
+	}
+
+	switch cmd.Type {
+	case "text":
+		e.encodeText(cmd)
+	case "feed":
+		lines := cmd.Lines
+		if lines == 0 {
+			lines = 1
+		}
+		e.feedLines(lines)
+	case "cut":
+		e.buf.Write(CutCommand(e.profile, cmd.Mode == "partial", cmd.Lines))
+	case "drawer":
+		e.buf.Write(DrawerKickCommand(cmd.Pin, cmd.OnTime, cmd.OffTime))
+	case "divider":
+		e.encodeDivider(cmd)
+	case "barcode":
+		return e.encodeBarcode(cmd)
+	case "qrcode":
+		return e.encodeQRCode(cmd)
+	case "item":
+		e.encodeItem(cmd)
+	default:
+		return fmt.Errorf("unsupported command type: %s", cmd.Type)
+	}
+
+	return nil
+}
+
+// needsRaster reports whether a command has to be rendered as an image
+func (e *Encoder) needsRaster(cmd *receiptformat.Command) bool {
+	switch cmd.Type {
+	case "image", "box", "pdf417", "datamatrix", "aztec":
+		return true
+	case "text":
+		return !e.isNativeText(cmd)
+	case "barcode":
+		format := cmd.Format
+		if format == "" {
+			format = "CODE128"
+		}
+		return barcodeSystem(format) == 0 || !e.profile.SupportsBarcode(format) || !isPrintableASCII(cmd.Value)
+	case "qrcode":
+		return !e.profile.SupportsQRCode()
+	case "item":
+		for _, side := range [][]receiptformat.Command{cmd.LeftSide, cmd.RightSide} {
+			for i := range side {
+				// Columns are laid out in characters, so only single-size ASCII text fits
+				text := &side[i]
+				if text.Type != "text" || e.isCustomFont(text.FontFamily) || !isPrintableASCII(text.Value) || magnification(text.Size) > 1 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isNativeText reports whether the printer's built-in font can print a text
+// command, in ASCII or one of its code pages
+func (e *Encoder) isNativeText(cmd *receiptformat.Command) bool {
+	// Mixed styles and sizes on one line are laid out by the renderer
+	if len(cmd.Spans) > 0 || e.isCustomFont(cmd.FontFamily) {
+		return false
+	}
+
+	// The printer prints in the order it's sent, so right to left text is
+	// reordered by the renderer
+	if renderer.ContainsRTL(cmd.Value) {
+		return false
+	}
+
+	// Newlines become line feeds
+	value := strings.ReplaceAll(cmd.Value, "\n", "")
+	if isPrintableASCII(value) {
+		return true
+	}
+	_, _, ok := e.profile.Encode(value)
+	return ok
+}
+
+// isCustomFont reports whether a font family refers to a font file rather
+// than the default font
+func (e *Encoder) isCustomFont(family string) bool {
+	if family == "" {
+		return false
+	}
+	if e.receipt != nil {
+		if _, ok := e.receipt.Fonts[family]; ok {
+			return true
+		}
+	}
+	return family != "default"
+}
+
+// encodeRaster renders a single command and sends it as a raster image
+func (e *Encoder) encodeRaster(cmd *receiptformat.Command) error {
+	r, err := renderer.New(e.paperWidth)
+	if err != nil {
+		return fmt.Errorf("failed to create renderer: %w", err)
+	}
+	r.SetReceipt(e.receipt)
+	r.SetProfile(e.profile)
+
+	if err := r.RenderCommand(cmd); err != nil {
+		return err
+	}
+
+	img := renderer.Dither(trimBottom(r.GetImage()), renderer.DitherOptions{Method: renderer.DitherThreshold})
+	e.buf.Write(Raster(img, e.profile.RasterHeight()))
+
+	return nil
+}
+
+func (e *Encoder) encodeText(cmd *receiptformat.Command) {
+	e.setAlign(cmd.Align)
+	if isBold(cmd.Weight) {
+		e.buf.Write(cmdBoldOn)
+	}
+	if mag := magnification(cmd.Size); mag > 1 {
+		e.setSize(mag)
+	}
+
+	// Wrap by characters, since the printer's font is fixed width
+	width := float64(e.charsPerLine() / magnification(cmd.Size))
+	lines := renderer.WrapText(cmd.Value, width, runeCount)
+	lines = renderer.TruncateLines(lines, cmd.MaxLines, width, runeCount)
+
+	for _, line := range lines {
+		if isPrintableASCII(line) {
+			e.buf.WriteString(line)
+		} else {
+			// isNativeText made sure a code page has every character
+			data, page, _ := e.profile.Encode(line)
+			e.buf.Write([]byte{0x1B, 0x74, byte(page.ID)}) // ESC t n
+			e.buf.Write(data)
+		}
+		e.buf.WriteByte('\n')
+	}
+
+	e.resetStyle()
+}
+
+func runeCount(s string) float64 {
+	return float64(utf8.RuneCountInString(s))
+}
+
+func (e *Encoder) encodeDivider(cmd *receiptformat.Command) {
+	length := cmd.Length
+	if length <= 0 {
+		length = e.charsPerLine()
+	}
+
+	pattern := "-"
+	switch cmd.Style {
+	case "double":
+		pattern = "="
+	case "dashed":
+		pattern = "- "
+	case "dotted":
+		pattern = "."
+	}
+	if cmd.Char != "" && isPrintableASCII(cmd.Char) {
+		pattern = cmd.Char
+	}
+
+	line := strings.Repeat(pattern, length/len(pattern)+1)[:length]
+
+	e.setAlign("center")
+	e.buf.WriteString(line)
+	e.buf.WriteByte('\n')
+	e.resetStyle()
+}
+
+// encodeItem lays out a two-column row in characters. Each text command on
+// either side becomes one or more lines of its column.
+func (e *Encoder) encodeItem(cmd *receiptformat.Command) {
+	leftRatio, rightRatio := 1, 1
+	if cmd.WidthRatio != "" {
+		fmt.Sscanf(cmd.WidthRatio, "%d:%d", &leftRatio, &rightRatio)
+	}
+	if leftRatio <= 0 || rightRatio <= 0 {
+		leftRatio, rightRatio = 1, 1
+	}
+
+	divider := ""
+	if cmd.ShowDivider {
+		divider = "|"
+		if cmd.DividerStyle == "dotted" || cmd.DividerStyle == "dashed" {
+			divider = ":"
+		}
+	}
+
+	available := e.charsPerLine() - len(divider)
+	leftCols := available * leftRatio / (leftRatio + rightRatio)
+	rightCols := available - leftCols
+
+	left := columnLines(cmd.LeftSide, leftCols)
+	right := columnLines(cmd.RightSide, rightCols)
+
+	rows := len(left)
+	if len(right) > rows {
+		rows = len(right)
+	}
+
+	for i := 0; i < rows; i++ {
+		e.writeCell(left, i, leftCols)
+		e.buf.WriteString(divider)
+		e.writeCell(right, i, rightCols)
+		e.buf.WriteByte('\n')
+	}
+}
+
+// columnLine is one line of text in an item column
+type columnLine struct {
+	text  string
+	align string
+	bold  bool
+}
+
+// columnLines wraps a column's text commands to its width in characters
+func columnLines(cmds []receiptformat.Command, width int) []columnLine {
+	var lines []columnLine
+	for _, cmd := range cmds {
+		for _, text := range renderer.WrapText(cmd.Value, float64(width), runeCount) {
+			lines = append(lines, columnLine{text: text, align: cmd.Align, bold: isBold(cmd.Weight)})
+		}
+	}
+	return lines
+}
+
+// writeCell writes line i of a column padded to width characters
+func (e *Encoder) writeCell(lines []columnLine, i int, width int) {
+	if i >= len(lines) {
+		e.buf.WriteString(strings.Repeat(" ", width))
+		return
+	}
+
+	line := lines[i]
+	text := line.text
+	pad := width - int(runeCount(text))
+	if pad < 0 {
+		pad = 0
+	}
+	before := 0
+	switch line.align {
+	case "center":
+		before = pad / 2
+	case "right":
+		before = pad
+	}
+
+	e.buf.WriteString(strings.Repeat(" ", before))
+	if line.bold {
+		e.buf.Write(cmdBoldOn)
+	}
+	e.buf.WriteString(text)
+	if line.bold {
+		e.buf.Write(cmdBoldOff)
+	}
+	e.buf.WriteString(strings.Repeat(" ", pad-before))
+}
+
+func (e *Encoder) encodeBarcode(cmd *receiptformat.Command) error {
+	if cmd.Value == "" {
+		return nil
+	}
+
+	height := cmd.Height
+	if height <= 0 {
+		height = 80
+	}
+	if height > 255 {
+		height = 255
+	}
+
+	width := cmd.Width
+	if width < 2 {
+		width = 2
+	}
+	if width > 6 {
+		width = 6
+	}
+
+	data, err := receiptformat.NormalizeBarcode(cmd.Format, cmd.Value)
+	if err != nil {
+		return err
+	}
+	system := barcodeSystem(cmd.Format)
+	if system == 73 {
+		// CODE128 needs a code set; B covers printable ASCII. A literal
+		// brace is sent as {{ so it isn't read as a code set change.
+		data = "{B" + strings.ReplaceAll(data, "{", "{{")
+	}
+	if len(data) > 255 {
+		return fmt.Errorf("barcode data too long: %d bytes", len(data))
+	}
+
+	align := cmd.Align
+	if align == "" {
+		align = "center"
+	}
+	e.setAlign(align)
+	e.buf.Write([]byte{0x1D, 0x48, hriPosition(cmd.Position)}) // GS H: human readable text
+	e.buf.Write([]byte{0x1D, 0x68, byte(height)})              // GS h: height in dots
+	e.buf.Write([]byte{0x1D, 0x77, byte(width)})               // GS w: module width
+	e.buf.Write([]byte{0x1D, 0x6B, system, byte(len(data))})   // GS k m n
+	e.buf.WriteString(data)
+	e.buf.WriteByte('\n')
+	e.resetStyle()
+
+	return nil
+}
+
+// hriPosition returns the GS H setting for a barcode's text position
+func hriPosition(position string) byte {
+	switch position {
+	case "above":
+		return 1
+	case "below":
+		return 2
+	case "both":
+		return 3
+	}
+	return 0
+}
+
+// barcodeSystem returns the GS k function B symbology for a barcode format,
+// or 0 if the printer can't encode it
+func barcodeSystem(format string) byte {
+	switch format {
+	case "", "CODE128":
+		return 73
+	case "CODE39":
+		return 69
+	case "EAN13":
+		return 67
+	case "EAN8":
+		return 68
+	case "UPC_A":
+		return 65
+	case "UPC_E":
+		return 66
+	case "ITF":
+		return 70
+	case "CODABAR":
+		return 71
+	case "CODE93":
+		return 72
+	}
+	return 0
+}
+
+func (e *Encoder) encodeQRCode(cmd *receiptformat.Command) error {
+	if cmd.Value == "" {
+		return nil
+	}
+
+	modules, err := renderer.QRModules(cmd)
+	if err != nil {
+		return err
+	}
+	size := renderer.QRModuleSize(cmd, modules, e.width, e.profile.Resolution())
+	if size == 0 {
+		return fmt.Errorf("QR code is %d modules wide, too wide for the paper", modules)
+	}
+	if size > 16 {
+		size = 16
+	}
+
+	level := byte(49) // M
+	switch cmd.ErrorCorrection {
+	case "L":
+		level = 48
+	case "Q":
+		level = 50
+	case "H":
+		level = 51
+	}
+
+	stored := len(cmd.Value) + 3
+	if stored > 0xFFFF {
+		return fmt.Errorf("QR code data too long: %d bytes", len(cmd.Value))
+	}
+
+	align := cmd.Align
+	if align == "" {
+		align = "center"
+	}
+	e.setAlign(align)
+	e.buf.Write([]byte{0x1D, 0x28, 0x6B, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00}) // Model 2
+	e.buf.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, byte(size)}) // Module size
+	e.buf.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x45, level})      // Error correction
+	e.buf.Write([]byte{0x1D, 0x28, 0x6B, byte(stored), byte(stored >> 8), 0x31, 0x50, 0x30})
+	e.buf.WriteString(cmd.Value)
+	e.buf.Write([]byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x51, 0x30}) // Print
+	e.buf.WriteByte('\n')
+	e.resetStyle()
+
+	if cmd.Caption != "" {
+		caption := &receiptformat.Command{Type: "text", Value: cmd.Caption, Align: align}
+		if !e.isNativeText(caption) {
+			return e.encodeRaster(caption)
+		}
+		e.encodeText(caption)
+	}
+
+	return nil
+}
+
+// CutCommand returns GS V function B, which feeds the paper until the last
+// printed line is past the cutter (plus feedLines more lines) and cuts it.
+// Printers that can't cut partially cut fully, and printers without a cutter
+// feed the paper past the tear bar instead.
+func CutCommand(p *profile.Profile, partial bool, feedLines int) []byte {
+	if !p.CanCut() {
+		lines := feedLines + tearOffLines
+		if lines > 255 {
+			lines = 255
+		}
+		return []byte{0x1B, 0x64, byte(lines)} // ESC d n
+	}
+
+	m := byte(65)
+	if partial && p.CanPartialCut() {
+		m = 66
+	}
+
+	n := feedLines * lineHeight
+	if n < 0 {
+		n = 0
+	}
+	if n > 255 {
+		n = 255
+	}
+
+	return []byte{0x1D, 0x56, m, byte(n)}
+}
+
+// DrawerKickCommand returns ESC p, which pulses a cash drawer kick-out
+// connector pin (2 or 5) for onTime ms and then waits offTime ms. Zero values
+// use the defaults of pin 2, 100 ms on and 500 ms off.
+func DrawerKickCommand(pin int, onTime int, offTime int) []byte {
+	m := byte(0)
+	if pin == 5 {
+		m = 1
+	}
+	if onTime <= 0 {
+		onTime = 100
+	}
+	if offTime <= 0 {
+		offTime = 500
+	}
+
+	// Times are sent in units of 2 ms
+	return []byte{0x1B, 0x70, m, pulseUnits(onTime), pulseUnits(offTime)}
+}
+
+func pulseUnits(ms int) byte {
+	units := (ms + 1) / 2
+	if units > 255 {
+		units = 255
+	}
+	return byte(units)
+}
+
+func (e *Encoder) setAlign(align string) {
+	n := byte(0)
+	switch align {
+	case "center":
+		n = 1
+	case "right":
+		n = 2
+	}
+	e.buf.Write([]byte{0x1B, 0x61, n}) // ESC a n
+}
+
+// setSize selects a character magnification (1-8) with GS !
+func (e *Encoder) setSize(mag int) {
+	n := byte(mag-1)<<4 | byte(mag-1)
+	e.buf.Write([]byte{0x1D, 0x21, n})
+}
+
+// resetStyle restores left alignment, normal weight and normal size
+func (e *Encoder) resetStyle() {
+	e.buf.Write(cmdBoldOff)
+	e.buf.Write([]byte{0x1D, 0x21, 0x00})
+	e.buf.Write([]byte{0x1B, 0x61, 0x00})
+}
+
+// feedLines prints the buffer and feeds n lines with ESC d
+func (e *Encoder) feedLines(n int) {
+	for n > 0 {
+		step := n
+		if step > 255 {
+			step = 255
+		}
+		e.buf.Write([]byte{0x1B, 0x64, byte(step)})
+		n -= step
+	}
+}
+
+func (e *Encoder) charsPerLine() int {
+	return e.width / charWidth
+}
+
+// magnification maps a font size in pixels to the nearest multiple of the
+// printer's 24-dot font
+func magnification(size int) int {
+	if size == 0 {
+		size = 32 // Renderer default
+	}
+
+	mag := (size + 12) / 24
+	if mag < 1 {
+		mag = 1
+	}
+	if mag > 8 {
+		mag = 8
+	}
+	return mag
+}
+
+func isBold(weight string) bool {
+	switch weight {
+	case "bold", "semibold", "extrabold", "black", "heavy":
+		return true
+	}
+	return false
+}
+
+// isPrintableASCII reports whether the printer's default code page can print s
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 0x20 || s[i] > 0x7E) && s[i] != '\n' {
+			return false
+		}
+	}
+	return true
+}
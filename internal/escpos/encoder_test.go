@@ -0,0 +1,355 @@
+package escpos
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/thereceipt/receipt-engine/internal/profile"
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+func encode(t *testing.T, cmds ...receiptformat.Command) []byte {
+	t.Helper()
+
+	data, err := New(&receiptformat.Receipt{Version: "1.0"}, "58mm").Encode(cmds)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	return data
+}
+
+func TestEncode_Text(t *testing.T) {
+	data := encode(t, receiptformat.Command{Type: "text", Value: "Total", Weight: "bold", Size: 48, Align: "center"})
+
+	if !bytes.HasPrefix(data, []byte{0x1B, 0x40}) {
+		t.Error("Expected stream to start with ESC @")
+	}
+
+	want := []byte{
+		0x1B, 0x61, 0x01, // Center
+		0x1B, 0x45, 0x01, // Bold
+		0x1D, 0x21, 0x11, // Double width and height
+		'T', 'o', 't', 'a', 'l', '\n',
+	}
+	if !bytes.Contains(data, want) {
+		t.Errorf("Expected styled text %x in %x", want, data)
+	}
+
+	// Nothing asked for a cut
+	if bytes.Contains(data, []byte{0x1D, 0x56}) {
+		t.Error("Expected no cut command")
+	}
+}
+
+func TestEncode_Cut(t *testing.T) {
+	data := encode(t,
+		receiptformat.Command{Type: "text", Value: "Customer copy"},
+		receiptformat.Command{Type: "cut", Mode: "partial"},
+		receiptformat.Command{Type: "text", Value: "Merchant copy"},
+		receiptformat.Command{Type: "cut", Lines: 2},
+	)
+
+	want := append([]byte("Customer copy\n"), 0x1B, 0x45, 0x00)
+	if !bytes.Contains(data, want) {
+		t.Fatalf("Expected first copy in %q", data)
+	}
+
+	partial := bytes.Index(data, []byte{0x1D, 0x56, 66, 0})
+	full := bytes.Index(data, []byte{0x1D, 0x56, 65, 60})
+	merchant := bytes.Index(data, []byte("Merchant copy"))
+	if partial < 0 || full < 0 {
+		t.Fatalf("Expected a partial and a full cut in %x", data)
+	}
+	if !(partial < merchant && merchant < full) {
+		t.Error("Expected cuts between and after the copies")
+	}
+	if !bytes.HasSuffix(data, []byte{0x1D, 0x56, 65, 60}) {
+		t.Error("Expected the receipt to end with its own cut")
+	}
+}
+
+func TestEncode_TextWrap(t *testing.T) {
+	// 58mm paper fits 32 characters
+	data := encode(t, receiptformat.Command{
+		Type:     "text",
+		Value:    "Oat milk flat white with an extra shot and caramel syrup\nNo lid",
+		MaxLines: 2,
+	})
+
+	if !bytes.Contains(data, []byte("Oat milk flat white with an\nextra shot and caramel syrup...\n")) {
+		t.Errorf("Expected the text wrapped between words in %q", data)
+	}
+	if bytes.Contains(data, []byte("No lid")) {
+		t.Error("Expected lines past max_lines to be dropped")
+	}
+}
+
+func TestEncode_Barcode(t *testing.T) {
+	data := encode(t, receiptformat.Command{Type: "barcode", Value: "12345", Height: 60})
+
+	want := append([]byte{0x1D, 0x68, 60, 0x1D, 0x77, 2, 0x1D, 0x6B, 73, 7}, "{B12345"...)
+	if !bytes.Contains(data, want) {
+		t.Errorf("Expected GS k CODE128 barcode %x in %x", want, data)
+	}
+}
+
+func TestEncode_BarcodeAlign(t *testing.T) {
+	tests := []struct {
+		align string
+		want  byte
+	}{
+		{"", 1},
+		{"left", 0},
+		{"right", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.align, func(t *testing.T) {
+			data := encode(t, receiptformat.Command{Type: "barcode", Value: "12345", Align: tt.align})
+			if !bytes.Contains(data, []byte{0x1B, 0x61, tt.want, 0x1D, 0x48}) {
+				t.Errorf("Expected ESC a %d before the barcode in %x", tt.want, data)
+			}
+		})
+	}
+}
+
+func TestEncode_BarcodeBraces(t *testing.T) {
+	data := encode(t, receiptformat.Command{Type: "barcode", Value: "A{B}"})
+
+	want := append([]byte{0x1D, 0x6B, 73, 7}, "{BA{{B}"...)
+	if !bytes.Contains(data, want) {
+		t.Errorf("Expected escaped CODE128 braces %x in %x", want, data)
+	}
+
+	// Escaping can push the data past GS k's 255 byte limit
+	encoder := New(&receiptformat.Receipt{Version: "1.0"}, "80mm")
+	_, err := encoder.Encode([]receiptformat.Command{{Type: "barcode", Value: strings.Repeat("{", 127)}})
+	if err == nil {
+		t.Error("Expected an error for barcode data too long once escaped")
+	}
+}
+
+func TestEncode_BarcodeText(t *testing.T) {
+	data := encode(t, receiptformat.Command{Type: "barcode", Value: "12345", Position: "both"})
+
+	if !bytes.Contains(data, []byte{0x1D, 0x48, 3}) {
+		t.Errorf("Expected GS H 3 for text above and below in %x", data)
+	}
+}
+
+func TestEncode_BarcodeCheckDigit(t *testing.T) {
+	encoder := New(&receiptformat.Receipt{Version: "1.0"}, "80mm")
+	encoder.SetProfile(&profile.Profile{Barcodes: []string{"UPC_A"}})
+	data, err := encoder.Encode([]receiptformat.Command{{Type: "barcode", Value: "03600029145", Format: "UPC_A"}})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	want := append([]byte{0x1D, 0x6B, 65, 12}, "036000291452"...)
+	if !bytes.Contains(data, want) {
+		t.Errorf("Expected GS k UPC-A barcode with its check digit %x in %x", want, data)
+	}
+}
+
+func TestEncode_QRCode(t *testing.T) {
+	data := encode(t, receiptformat.Command{Type: "qrcode", Value: "hello", ErrorCorrection: "Q"})
+
+	for _, want := range [][]byte{
+		{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, 6},  // Module size
+		{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x45, 50}, // Error correction Q
+		append([]byte{0x1D, 0x28, 0x6B, 8, 0x00, 0x31, 0x50, 0x30}, "hello"...),
+		{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x51, 0x30}, // Print
+	} {
+		if !bytes.Contains(data, want) {
+			t.Errorf("Expected GS ( k %x in %x", want, data)
+		}
+	}
+}
+
+func TestEncode_QRCodeWidthAndCaption(t *testing.T) {
+	// "hello" is a version 1 code, 29 modules with its quiet zone
+	data := encode(t, receiptformat.Command{Type: "qrcode", Value: "hello", WidthMM: 20, Align: "left", Caption: "Scan to pay"})
+
+	if !bytes.Contains(data, []byte{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, 5}) {
+		t.Errorf("Expected 5 dots per module for 20mm in %x", data)
+	}
+	if !bytes.Contains(data, []byte{0x1B, 0x61, 0}) {
+		t.Error("Expected the code to be left aligned")
+	}
+	if !bytes.Contains(data, []byte("Scan to pay\n")) {
+		t.Error("Expected the caption under the code")
+	}
+}
+
+func TestEncode_Item(t *testing.T) {
+	data := encode(t, receiptformat.Command{
+		Type:      "item",
+		LeftSide:  []receiptformat.Command{{Type: "text", Value: "Coffee"}},
+		RightSide: []receiptformat.Command{{Type: "text", Value: "$3.50", Align: "right"}},
+	})
+
+	// 58mm paper is 32 characters wide, split evenly
+	want := "Coffee          " + "           $3.50" + "\n"
+	if !bytes.Contains(data, []byte(want)) {
+		t.Errorf("Expected item row %q in %q", want, data)
+	}
+}
+
+func TestEncode_ItemWraps(t *testing.T) {
+	data := encode(t, receiptformat.Command{
+		Type:      "item",
+		LeftSide:  []receiptformat.Command{{Type: "text", Value: "Large oat milk latte"}},
+		RightSide: []receiptformat.Command{{Type: "text", Value: "$4.50", Align: "right"}},
+	})
+
+	// Each 16 character column wraps onto extra rows instead of being cut
+	want := "Large oat milk  " + "           $4.50" + "\n" +
+		"latte           " + "                " + "\n"
+	if !bytes.Contains(data, []byte(want)) {
+		t.Errorf("Expected wrapped item rows %q in %q", want, data)
+	}
+}
+
+func TestEncode_RasterFallback(t *testing.T) {
+	receipt := &receiptformat.Receipt{Version: "1.0"}
+	cmds := []receiptformat.Command{
+		{Type: "text", Value: "Plain"},
+		{Type: "text", Value: "Fancy", FontFamily: "brand"},
+		{Type: "text", Value: "Café"},
+	}
+
+	data, err := New(receipt, "58mm").Encode(cmds)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	if !bytes.Contains(data, []byte("Plain\n")) {
+		t.Error("Expected plain text to be sent as text")
+	}
+	if bytes.Contains(data, []byte("Fancy")) || bytes.Contains(data, []byte("Caf")) {
+		t.Error("Expected custom font and non-ASCII text to be rasterised")
+	}
+	if n := bytes.Count(data, []byte{0x1D, 0x76, 0x30, 0x00}); n != 2 {
+		t.Errorf("Expected 2 raster images, got %d", n)
+	}
+}
+
+func TestRaster(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 10, 2))
+	for x := 0; x < 10; x++ {
+		img.SetGray(x, 0, color.Gray{Y: 255})
+		img.SetGray(x, 1, color.Gray{Y: 255})
+	}
+	img.SetGray(0, 0, color.Gray{Y: 0})
+	img.SetGray(9, 1, color.Gray{Y: 0})
+
+	want := []byte{
+		0x1D, 0x76, 0x30, 0x00, 2, 0, 2, 0,
+		0x80, 0x00,
+		0x00, 0x40,
+	}
+	if got := Raster(img, 0); !bytes.Equal(got, want) {
+		t.Errorf("Expected %x, got %x", want, got)
+	}
+
+	// One row per band
+	want = []byte{
+		0x1D, 0x76, 0x30, 0x00, 2, 0, 1, 0,
+		0x80, 0x00,
+		0x1D, 0x76, 0x30, 0x00, 2, 0, 1, 0,
+		0x00, 0x40,
+	}
+	if got := Raster(img, 1); !bytes.Equal(got, want) {
+		t.Errorf("Expected %x, got %x", want, got)
+	}
+
+	// A blank image trims to nothing, with no empty GS v 0 header
+	blank := image.NewGray(image.Rect(0, 0, 10, 2))
+	for x := 0; x < 10; x++ {
+		blank.SetGray(x, 0, color.Gray{Y: 255})
+		blank.SetGray(x, 1, color.Gray{Y: 255})
+	}
+	if got := Raster(trimBottom(blank), 0); len(got) != 0 {
+		t.Errorf("Expected nothing for a blank image, got %x", got)
+	}
+}
+
+func TestEncode_Profile(t *testing.T) {
+	// 72mm printable on 80mm paper, no partial cuts, no native QR codes
+	prof := &profile.Profile{
+		DotsPerLine: 512,
+		FullCut:     true,
+		CodePages:   []profile.CodePage{{ID: 0, Name: "CP437"}, {ID: 16, Name: "CP1252"}},
+		Barcodes:    []string{"CODE39"},
+	}
+
+	encoder := New(&receiptformat.Receipt{Version: "1.0"}, "80mm")
+	encoder.SetProfile(prof)
+	data, err := encoder.Encode([]receiptformat.Command{
+		{Type: "divider"},
+		{Type: "text", Value: "Café"},
+		{Type: "text", Value: "€5"},
+		{Type: "cut", Mode: "partial"},
+		{Type: "barcode", Value: "12345"},
+		{Type: "barcode", Value: "12345", Format: "CODE39"},
+		{Type: "qrcode", Value: "hello"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	// 512 dots fit 42 characters, not the 48 of 576
+	if !bytes.Contains(data, []byte(strings.Repeat("-", 42)+"\n")) || bytes.Contains(data, []byte(strings.Repeat("-", 43))) {
+		t.Error("Expected the divider to fit the printable width")
+	}
+
+	// é is in CP437, € only in CP1252
+	if !bytes.Contains(data, []byte{0x1B, 0x74, 0, 'C', 'a', 'f', 0x82, '\n'}) {
+		t.Errorf("Expected CP437 text in %x", data)
+	}
+	if !bytes.Contains(data, []byte{0x1B, 0x74, 16, 0x80, '5', '\n'}) {
+		t.Errorf("Expected CP1252 text in %x", data)
+	}
+
+	if bytes.Contains(data, []byte{0x1D, 0x56, 66}) || !bytes.Contains(data, []byte{0x1D, 0x56, 65}) {
+		t.Error("Expected a full cut instead of a partial one")
+	}
+
+	if !bytes.Contains(data, []byte{0x1D, 0x6B, 69}) || bytes.Contains(data, []byte{0x1D, 0x6B, 73}) {
+		t.Error("Expected only the CODE39 barcode to be native")
+	}
+	if bytes.Contains(data, []byte{0x1D, 0x28, 0x6B}) {
+		t.Error("Expected the QR code to be rasterised")
+	}
+	if n := bytes.Count(data, []byte{0x1D, 0x76, 0x30, 0x00}); n != 2 {
+		t.Errorf("Expected 2 raster images, got %d", n)
+	}
+	if !bytes.Contains(data, []byte{0x1D, 0x76, 0x30, 0x00, 64, 0}) {
+		t.Error("Expected raster images 512 dots wide")
+	}
+}
+
+func TestDrawerKickCommand(t *testing.T) {
+	tests := []struct {
+		pin, onTime, offTime int
+		want                 []byte
+	}{
+		{0, 0, 0, []byte{0x1B, 0x70, 0, 50, 250}},
+		{5, 200, 400, []byte{0x1B, 0x70, 1, 100, 200}},
+		{2, 510, 1000, []byte{0x1B, 0x70, 0, 255, 255}},
+	}
+
+	for _, tt := range tests {
+		if got := DrawerKickCommand(tt.pin, tt.onTime, tt.offTime); !bytes.Equal(got, tt.want) {
+			t.Errorf("DrawerKickCommand(%d, %d, %d) = %x, want %x", tt.pin, tt.onTime, tt.offTime, got, tt.want)
+		}
+	}
+
+	data := encode(t, receiptformat.Command{Type: "drawer", Pin: 5})
+	if !bytes.Contains(data, []byte{0x1B, 0x70, 1, 50, 250}) {
+		t.Errorf("Expected ESC p in %x", data)
+	}
+}
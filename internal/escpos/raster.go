@@ -0,0 +1,97 @@
+package escpos
+
+import (
+	"image"
+)
+
+// Raster encodes an image as GS v 0 raster bit images. Pixels darker than
+// mid-grey print black. Images taller than maxHeight rows are sent as several
+// bands, since some printers can't buffer a whole image; 0 means no limit.
+// An empty image encodes to nothing.
+func Raster(img image.Image, maxHeight int) []byte {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil
+	}
+	widthBytes := (width + 7) / 8
+
+	if maxHeight <= 0 || maxHeight > 0xFFFF {
+		maxHeight = 0xFFFF
+	}
+
+	data := make([]byte, 0, 8*(height/maxHeight+1)+widthBytes*height)
+	top := 0
+	for {
+		band := height - top
+		if band > maxHeight {
+			band = maxHeight
+		}
+		data = append(data,
+			0x1D, 0x76, 0x30, 0x00, // GS v 0, normal density
+			byte(widthBytes), byte(widthBytes>>8),
+			byte(band), byte(band>>8),
+		)
+		data = appendRows(data, img, top, band)
+
+		top += band
+		if top >= height {
+			break
+		}
+	}
+
+	return data
+}
+
+// appendRows appends count rows of an image, starting at row top, as packed bits
+func appendRows(data []byte, img image.Image, top int, count int) []byte {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+
+	row := make([]byte, (width+7)/8)
+	for y := top; y < top+count; y++ {
+		for i := range row {
+			row[i] = 0
+		}
+		for x := 0; x < width; x++ {
+			if isDark(img, bounds.Min.X+x, bounds.Min.Y+y) {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		data = append(data, row...)
+	}
+
+	return data
+}
+
+// trimBottom drops the blank rows below the last printed pixel
+func trimBottom(img image.Image) image.Image {
+	bounds := img.Bounds()
+
+	bottom := bounds.Min.Y
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y && bottom == bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isDark(img, x, y) {
+				bottom = y + 1
+				break
+			}
+		}
+	}
+
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return img
+	}
+	return sub.SubImage(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bottom))
+}
+
+func isDark(img image.Image, x, y int) bool {
+	r, g, b, a := img.At(x, y).RGBA()
+	if a < 0x8000 {
+		return false // Transparent counts as paper
+	}
+	luminance := (299*r + 587*g + 114*b) / 1000
+	return luminance < 0x8000
+}
@@ -0,0 +1,361 @@
+// Package imagecache downloads images for receipts and keeps them, and the
+// resized and dithered versions printed from them, in an on-disk cache
+package imagecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for zero Options fields
+const (
+	DefaultMaxImageSize = 5 << 20   // 5 MB
+	DefaultMaxCacheSize = 100 << 20 // 100 MB
+	DefaultMaxAge       = time.Hour
+	DefaultTimeout      = 10 * time.Second
+)
+
+// ErrTooLarge is returned when a download exceeds MaxImageSize
+var ErrTooLarge = errors.New("image exceeds the maximum size")
+
+// Options configures a Cache
+type Options struct {
+	MaxImageSize int64         // Largest image downloaded, in bytes
+	MaxCacheSize int64         // Total size of downloads and variants kept; the least recently used go first
+	MaxAge       time.Duration // How long a download is used before checking it changed
+	Timeout      time.Duration // Time limit for each request
+}
+
+// Cache stores downloaded images by the hash of their content, so the same
+// image under several URLs is kept once
+type Cache struct {
+	dir     string
+	opts    Options
+	client  *http.Client
+	mu      sync.Mutex
+	entries map[string]*entry // By URL
+	loaded  bool
+}
+
+// entry records where a URL's content is and how to revalidate it
+type entry struct {
+	Hash         string    `json:"hash"` // SHA-256 of the content, names the object file
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"` // Last download or revalidation
+}
+
+// New creates a cache in dir. Directories are created on first write.
+func New(dir string, opts Options) *Cache {
+	if opts.MaxImageSize <= 0 {
+		opts.MaxImageSize = DefaultMaxImageSize
+	}
+	if opts.MaxCacheSize <= 0 {
+		opts.MaxCacheSize = DefaultMaxCacheSize
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	return &Cache{
+		dir:     dir,
+		opts:    opts,
+		client:  &http.Client{Timeout: opts.Timeout},
+		entries: make(map[string]*entry),
+	}
+}
+
+var (
+	defaultCache *Cache
+	defaultMu    sync.Mutex
+)
+
+// SetDefault sets the cache image commands use
+func SetDefault(c *Cache) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultCache = c
+}
+
+// Default returns the cache image commands use, creating one in the user's
+// cache directory if none was set
+func Default() *Cache {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultCache == nil {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			dir = os.TempDir()
+		}
+		defaultCache = New(filepath.Join(dir, "receipt-engine", "images"), Options{})
+	}
+	return defaultCache
+}
+
+// Fetch returns the content at url. A cached copy is used until it is
+// MaxAge old, then revalidated with its ETag or Last-Modified date. If the
+// server can't be reached, a stale copy is better than no logo at all.
+func (c *Cache) Fetch(url string) ([]byte, error) {
+	c.mu.Lock()
+	c.load()
+	cached := c.entries[url]
+	var stale *entry
+	if cached != nil {
+		copied := *cached
+		stale = &copied
+	}
+	c.mu.Unlock()
+
+	if stale != nil && time.Since(stale.FetchedAt) < c.opts.MaxAge {
+		if data, err := os.ReadFile(c.objectPath(stale.Hash)); err == nil {
+			touch(c.objectPath(stale.Hash))
+			return data, nil
+		}
+		stale = nil // Object went missing or was pruned, download it again
+	}
+
+	data, fresh, err := c.download(url, stale)
+	if err != nil {
+		if stale != nil && !errors.Is(err, ErrTooLarge) {
+			if data, readErr := os.ReadFile(c.objectPath(stale.Hash)); readErr == nil {
+				return data, nil
+			}
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[url] = fresh
+	if err := c.save(); err != nil {
+		// Warning: failed to save the index - the image will be downloaded again next time
+	}
+
+	return data, nil
+}
+
+// download fetches url, sending the validators from a previous download. A
+// 304 reply reuses the cached object.
+func (c *Cache) download(url string, previous *entry) ([]byte, *entry, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid image URL: %w", err)
+	}
+	if previous != nil {
+		if previous.ETag != "" {
+			req.Header.Set("If-None-Match", previous.ETag)
+		}
+		if previous.LastModified != "" {
+			req.Header.Set("If-Modified-Since", previous.LastModified)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && previous != nil {
+		data, err := os.ReadFile(c.objectPath(previous.Hash))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read cached image: %w", err)
+		}
+		fresh := *previous
+		fresh.FetchedAt = time.Now()
+		return data, &fresh, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch image: HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > c.opts.MaxImageSize {
+		return nil, nil, fmt.Errorf("%w (%d bytes)", ErrTooLarge, resp.ContentLength)
+	}
+
+	// Read one byte past the limit to tell a full-size image from a larger one
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.opts.MaxImageSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if int64(len(data)) > c.opts.MaxImageSize {
+		return nil, nil, fmt.Errorf("%w (%d bytes)", ErrTooLarge, c.opts.MaxImageSize)
+	}
+
+	hash := Hash(data)
+	if err := writeFile(c.objectPath(hash), data); err != nil {
+		return nil, nil, fmt.Errorf("failed to cache image: %w", err)
+	}
+	c.prune()
+
+	return data, &entry{
+		Hash:         hash,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}, nil
+}
+
+// Variant returns a processed version of an image stored with StoreVariant.
+// variant describes the processing, e.g. the width and dithering.
+func (c *Cache) Variant(source []byte, variant string) (image.Image, bool) {
+	path := c.variantPath(source, variant)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		return nil, false
+	}
+	touch(path)
+	return img, true
+}
+
+// StoreVariant keeps a processed version of an image for Variant
+func (c *Cache) StoreVariant(source []byte, variant string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	if err := writeFile(c.variantPath(source, variant), buf.Bytes()); err != nil {
+		return err
+	}
+	c.prune()
+	return nil
+}
+
+// prune removes the least recently used downloads and variants until the
+// cache fits in MaxCacheSize. An index entry whose download was removed is
+// downloaded again the next time it's fetched.
+func (c *Cache) prune() {
+	type cachedFile struct {
+		path string
+		size int64
+		used time.Time
+	}
+
+	var files []cachedFile
+	var total int64
+	for _, sub := range []string{"objects", "variants"} {
+		dirEntries, err := os.ReadDir(filepath.Join(c.dir, sub))
+		if err != nil {
+			continue
+		}
+		for _, dirEntry := range dirEntries {
+			info, err := dirEntry.Info()
+			if err != nil || !info.Mode().IsRegular() || strings.HasPrefix(dirEntry.Name(), ".tmp-") {
+				continue
+			}
+			files = append(files, cachedFile{filepath.Join(c.dir, sub, dirEntry.Name()), info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+	}
+	if total <= c.opts.MaxCacheSize {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].used.Before(files[j].used)
+	})
+	for _, file := range files {
+		if total <= c.opts.MaxCacheSize {
+			break
+		}
+		if err := os.Remove(file.path); err == nil {
+			total -= file.size
+		}
+	}
+}
+
+// touch marks a cached file as just used, so pruning keeps it longest
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// Hash returns the hex SHA-256 of data
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) objectPath(hash string) string {
+	return filepath.Join(c.dir, "objects", hash)
+}
+
+func (c *Cache) variantPath(source []byte, variant string) string {
+	return filepath.Join(c.dir, "variants", Hash([]byte(Hash(source)+"\n"+variant))+".png")
+}
+
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.dir, "index.json")
+}
+
+// load reads the index once. Must be called with c.mu held.
+func (c *Cache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	data, err := os.ReadFile(c.indexPath())
+	if err != nil {
+		return // No index yet
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil || c.entries == nil {
+		c.entries = make(map[string]*entry)
+	}
+}
+
+// save writes the index. Must be called with c.mu held.
+func (c *Cache) save() error {
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(c.indexPath(), data)
+}
+
+// writeFile writes data via a temporary file so readers never see half a file
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,158 @@
+package imagecache
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch_CachesAndRevalidates(t *testing.T) {
+	var requests, revalidations atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("logo"))
+	}))
+	defer server.Close()
+
+	cache := New(t.TempDir(), Options{MaxAge: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		data, err := cache.Fetch(server.URL + "/logo.png")
+		if err != nil {
+			t.Fatalf("Failed to fetch: %v", err)
+		}
+		if string(data) != "logo" {
+			t.Errorf("Expected the image content, got %q", data)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected a fresh copy to be served from the cache, got %d requests", requests.Load())
+	}
+
+	// Once it's too old, it is revalidated with its ETag
+	cache.entries[server.URL+"/logo.png"].FetchedAt = time.Now().Add(-2 * time.Hour)
+	data, err := cache.Fetch(server.URL + "/logo.png")
+	if err != nil || string(data) != "logo" {
+		t.Fatalf("Expected the cached image after a 304, got %q, %v", data, err)
+	}
+	if revalidations.Load() != 1 {
+		t.Errorf("Expected a conditional request, got %d", revalidations.Load())
+	}
+}
+
+func TestFetch_PersistsIndex(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("logo"))
+	}))
+
+	dir := t.TempDir()
+	if _, err := New(dir, Options{}).Fetch(server.URL); err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+
+	// A new cache in the same directory doesn't need the server
+	server.Close()
+	data, err := New(dir, Options{}).Fetch(server.URL)
+	if err != nil || string(data) != "logo" {
+		t.Errorf("Expected the image from disk, got %q, %v", data, err)
+	}
+}
+
+func TestFetch_TooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	_, err := New(t.TempDir(), Options{MaxImageSize: 10}).Fetch(server.URL)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestFetch_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	if _, err := New(t.TempDir(), Options{}).Fetch(server.URL); err == nil {
+		t.Error("Expected an error for a missing image")
+	}
+}
+
+func TestVariant(t *testing.T) {
+	cache := New(t.TempDir(), Options{})
+	source := []byte("logo")
+
+	if _, ok := cache.Variant(source, "width=384"); ok {
+		t.Fatal("Expected no variant before one is stored")
+	}
+
+	img := image.NewGray(image.Rect(0, 0, 4, 2))
+	img.SetGray(1, 1, color.Gray{Y: 255})
+	if err := cache.StoreVariant(source, "width=384", img); err != nil {
+		t.Fatalf("Failed to store variant: %v", err)
+	}
+
+	got, ok := cache.Variant(source, "width=384")
+	if !ok {
+		t.Fatal("Expected the stored variant")
+	}
+	if got.Bounds() != img.Bounds() || color.GrayModel.Convert(got.At(1, 1)).(color.Gray).Y != 255 {
+		t.Error("Expected the variant to round-trip")
+	}
+
+	if _, ok := cache.Variant(source, "width=576"); ok {
+		t.Error("Expected variants for other widths to be separate")
+	}
+}
+
+func TestStoreVariant_Prunes(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+
+	// Learn how big one variant is, then allow two
+	probe := New(t.TempDir(), Options{})
+	probe.StoreVariant([]byte("probe"), "v", img)
+	info, err := os.Stat(probe.variantPath([]byte("probe"), "v"))
+	if err != nil {
+		t.Fatalf("Failed to stat variant: %v", err)
+	}
+
+	cache := New(t.TempDir(), Options{MaxCacheSize: 2 * info.Size()})
+	old := time.Now().Add(-time.Hour)
+	for i, source := range []string{"first", "second"} {
+		cache.StoreVariant([]byte(source), "v", img)
+		used := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(cache.variantPath([]byte(source), "v"), used, used)
+	}
+
+	// Using the first makes the second the least recently used
+	if _, ok := cache.Variant([]byte("first"), "v"); !ok {
+		t.Fatal("Expected the first variant")
+	}
+	cache.StoreVariant([]byte("third"), "v", img)
+
+	if _, ok := cache.Variant([]byte("second"), "v"); ok {
+		t.Error("Expected the least recently used variant to be pruned")
+	}
+	for _, source := range []string{"first", "third"} {
+		if _, ok := cache.Variant([]byte(source), "v"); !ok {
+			t.Errorf("Expected the %s variant to be kept", source)
+		}
+	}
+}
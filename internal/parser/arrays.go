@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+// arrayScope is the array entry a command is expanded for, inside the
+// entries of the array-bound commands it's nested in
+type arrayScope struct {
+	name   string // As in arrayBinding
+	fields []receiptformat.VariableArrayField
+	entry  map[string]interface{}
+	group  []map[string]interface{} // For a group header or footer, the group's entries; entry is the first
+	parent *arrayScope
+}
+
+// nestedEntries returns the entries of an array field of the scope's entry,
+// or of all the group's entries. An entry without the field uses its default.
+func (s *arrayScope) nestedEntries(field *receiptformat.VariableArrayField) []map[string]interface{} {
+	entries := s.group
+	if entries == nil {
+		entries = []map[string]interface{}{s.entry}
+	}
+
+	var nested []map[string]interface{}
+	for _, entry := range entries {
+		value := entry[field.Field]
+		if value == nil {
+			value = field.DefaultValue
+		}
+		nested = append(nested, toEntries(value)...)
+	}
+	return nested
+}
+
+// bindArray returns the fields and entries of the array an arrayBinding
+// names: an array field of the entry it's nested in, or one of the
+// receipt's arrays
+func (p *Parser) bindArray(name string, parent *arrayScope) ([]receiptformat.VariableArrayField, []map[string]interface{}, error) {
+	for s := parent; s != nil; s = s.parent {
+		if field := findField(s.fields, name); field != nil && field.ValueType == "array" {
+			return field.Schema, s.nestedEntries(field), nil
+		}
+	}
+	if schema := p.variableArray(name); schema != nil {
+		return schema.Schema, p.arrayEntries(schema), nil
+	}
+	return nil, nil, fmt.Errorf("unknown variable array: %s", name)
+}
+
+// lookupArray returns the entries an expression's array.field names: the
+// current entry of an array the scope is bound to (single is true), the
+// group's entries in a group header or footer, the entries of an array field
+// of the current entry, or all of one of the receipt's arrays
+func (p *Parser) lookupArray(name string, scope *arrayScope) (fields []receiptformat.VariableArrayField, entries []map[string]interface{}, single bool, err error) {
+	for s := scope; s != nil; s = s.parent {
+		if s.name == name {
+			if s.group != nil {
+				return s.fields, s.group, false, nil
+			}
+			return s.fields, []map[string]interface{}{s.entry}, true, nil
+		}
+		if field := findField(s.fields, name); field != nil && field.ValueType == "array" {
+			return field.Schema, s.nestedEntries(field), false, nil
+		}
+	}
+	if schema := p.variableArray(name); schema != nil {
+		return schema.Schema, p.arrayEntries(schema), false, nil
+	}
+	return nil, nil, false, fmt.Errorf("unknown variable array '%s'", name)
+}
+
+// groupEntries splits entries into groups with the same value of a field,
+// in the order each group first appears
+func groupEntries(entries []map[string]interface{}, field *receiptformat.VariableArrayField) [][]map[string]interface{} {
+	var groups [][]map[string]interface{}
+	index := make(map[string]int)
+	for _, entry := range entries {
+		value := entry[field.Field]
+		if value == nil {
+			value = field.DefaultValue
+		}
+		key := receiptformat.ExprString(value)
+
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], entry)
+	}
+	return groups
+}
+
+// exprFieldValue returns an entry's field for use in an expression, or the
+// field's default if the entry doesn't have it
+func exprFieldValue(field *receiptformat.VariableArrayField, data map[string]interface{}) interface{} {
+	value := data[field.Field]
+	if value == nil {
+		value = field.DefaultValue
+	}
+	if field.ValueType == "array" {
+		entries := toEntries(value)
+		list := make([]interface{}, len(entries))
+		for i, entry := range entries {
+			list[i] = entry
+		}
+		return list
+	}
+	return receiptformat.ExprValue(value, field.ValueType)
+}
+
+// toEntries reads a nested array's value, as decoded from JSON or given
+// from Go
+func toEntries(value interface{}) []map[string]interface{} {
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		return v
+	case []interface{}:
+		entries := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if entry, ok := item.(map[string]interface{}); ok {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+	return nil
+}
+
+// findField returns the field with a name, or nil
+func findField(fields []receiptformat.VariableArrayField, name string) *receiptformat.VariableArrayField {
+	for i := range fields {
+		if fields[i].Field == name {
+			return &fields[i]
+		}
+	}
+	return nil
+}
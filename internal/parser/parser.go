@@ -4,7 +4,10 @@ package parser
 import (
 	"fmt"
 	"image"
+	"strings"
 	
+	"github.com/thereceipt/receipt-engine/internal/escpos"
+	"github.com/thereceipt/receipt-engine/internal/profile"
 	"github.com/thereceipt/receipt-engine/internal/renderer"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
@@ -12,6 +15,8 @@ import (
 // Parser executes receipt commands with variable and array support
 type Parser struct {
 	receipt           *receiptformat.Receipt
+	paperWidth        string
+	profile           *profile.Profile
 	renderer          *renderer.Renderer
 	variableData      map[string]interface{}
 	variableArrayData map[string][]map[string]interface{}
@@ -29,6 +34,7 @@ func New(receipt *receiptformat.Receipt, paperWidth string) (*Parser, error) {
 	
 	return &Parser{
 		receipt:           receipt,
+		paperWidth:        paperWidth,
 		renderer:          r,
 		variableData:      make(map[string]interface{}),
 		variableArrayData: make(map[string][]map[string]interface{}),
@@ -45,11 +51,27 @@ func (p *Parser) SetVariableArrayData(data map[string][]map[string]interface{})
 	p.variableArrayData = data
 }
 
+// SetProfile sets the capabilities of the printer the receipt is for
+func (p *Parser) SetProfile(prof *profile.Profile) {
+	p.profile = prof
+	p.renderer.SetProfile(prof)
+}
+
+// Output returns the output mode the receipt asks for ("raster", "native"
+// or empty to use the printer's setting)
+func (p *Parser) Output() string {
+	return p.receipt.Output
+}
+
 // Execute parses and renders the receipt
 func (p *Parser) Execute() (image.Image, error) {
-	// Process commands
-	for _, cmd := range p.receipt.Commands {
-		if err := p.executeCommand(&cmd); err != nil {
+	cmds, err := p.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	
+	for i := range cmds {
+		if err := p.renderer.RenderCommand(&cmds[i]); err != nil {
 			return nil, fmt.Errorf("failed to execute command: %w", err)
 		}
 	}
@@ -57,72 +79,225 @@ func (p *Parser) Execute() (image.Image, error) {
 	return p.renderer.GetImage(), nil
 }
 
-func (p *Parser) executeCommand(cmd *receiptformat.Command) error {
-	// Check if command has array binding
-	if cmd.ArrayBinding != "" {
-		return p.executeArrayBoundCommand(cmd)
+// Controls returns the cuts and drawer kicks in the image from Execute
+func (p *Parser) Controls() []renderer.Control {
+	return p.renderer.Controls()
+}
+
+// ExecuteESCPOS parses the receipt and encodes it as native ESC/POS commands
+func (p *Parser) ExecuteESCPOS() ([]byte, error) {
+	cmds, err := p.Resolve()
+	if err != nil {
+		return nil, err
 	}
 	
-	// Resolve variables in command
-	resolvedCmd, err := p.resolveCommand(cmd)
+	encoder := escpos.New(p.receipt, p.paperWidth)
+	encoder.SetProfile(p.profile)
+	data, err := encoder.Encode(cmds)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to execute command: %w", err)
 	}
 	
-	// Execute through renderer
-	return p.renderer.RenderCommand(resolvedCmd)
+	return data, nil
 }
 
-func (p *Parser) executeArrayBoundCommand(cmd *receiptformat.Command) error {
-	arrayName := cmd.ArrayBinding
+// Resolve expands array-bound commands and substitutes variables, returning
+// the commands in the order they print
+func (p *Parser) Resolve() ([]receiptformat.Command, error) {
+	resolved := make([]receiptformat.Command, 0, len(p.receipt.Commands))
 	
-	// Get array schema
-	var schema receiptformat.VariableArray
-	found := false
-	for _, arr := range p.receipt.VariableArrays {
-		if arr.Name == arrayName {
-			schema = arr
-			found = true
-			break
+	for i := range p.receipt.Commands {
+		cmds, err := p.resolveTopLevel(&p.receipt.Commands[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute command: %w", err)
 		}
+		resolved = append(resolved, cmds...)
 	}
 	
-	if !found {
-		return fmt.Errorf("unknown variable array: %s", arrayName)
+	return resolved, nil
+}
+
+func (p *Parser) resolveTopLevel(cmd *receiptformat.Command) ([]receiptformat.Command, error) {
+	// A command can resolve to none, if its condition is false, or to many,
+	// for an array or the branch of an if or switch
+	return p.resolveCommands([]receiptformat.Command{*cmd})
+}
+
+// resolveArrayBoundCommand repeats a command for each entry of the array it's
+// bound to. parent is the entry of the array-bound command it's nested in,
+// whose array fields it can be bound to; nil if there is none.
+func (p *Parser) resolveArrayBoundCommand(cmd *receiptformat.Command, parent *arrayScope) ([]receiptformat.Command, error) {
+	fields, dataEntries, err := p.bindArray(cmd.ArrayBinding, parent)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Get data for this array
-	dataEntries := p.variableArrayData[arrayName]
+	unbound := *cmd
+	unbound.ArrayBinding = ""
+	unbound.GroupBy = ""
+	unbound.GroupHeader = nil
+	unbound.GroupFooter = nil
 	
-	// If no data provided, use defaults for preview
-	if len(dataEntries) == 0 {
-		defaultEntry := make(map[string]interface{})
-		for _, field := range schema.Schema {
-			defaultEntry[field.Field] = field.DefaultValue
+	var resolved []receiptformat.Command
+	expand := func(cmds []receiptformat.Command, scope *arrayScope) error {
+		expanded, err := p.expandArrayCommands(cmds, scope)
+		if err != nil {
+			return err
+		}
+		for i := range expanded {
+			// Resolve any remaining variables
+			resolvedCmd, err := p.resolveCommand(&expanded[i])
+			if err != nil {
+				return err
+			}
+			resolved = append(resolved, *resolvedCmd)
+		}
+		return nil
+	}
+	
+	// Repeat the command once for each data entry. Its condition is checked
+	// for each entry, so it can leave entries out.
+	repeat := func(entries []map[string]interface{}) error {
+		for _, entry := range entries {
+			scope := &arrayScope{name: cmd.ArrayBinding, fields: fields, entry: entry, parent: parent}
+			if err := expand([]receiptformat.Command{unbound}, scope); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	
+	if cmd.GroupBy == "" {
+		if err := repeat(dataEntries); err != nil {
+			return nil, err
+		}
+		return resolved, nil
+	}
+	
+	// Print each group's entries between its header and footer, which see
+	// the group's entries as the array
+	header := cmd.GroupHeader
+	if header == nil {
+		header = []receiptformat.Command{{Type: "text", ArrayField: cmd.GroupBy, Weight: "bold"}}
+	}
+	groupField := findField(fields, cmd.GroupBy)
+	if groupField == nil {
+		return nil, fmt.Errorf("unknown field '%s' in group_by", cmd.GroupBy)
+	}
+	for _, group := range groupEntries(dataEntries, groupField) {
+		scope := &arrayScope{name: cmd.ArrayBinding, fields: fields, entry: group[0], group: group, parent: parent}
+		if err := expand(header, scope); err != nil {
+			return nil, err
+		}
+		if err := repeat(group); err != nil {
+			return nil, err
+		}
+		if err := expand(cmd.GroupFooter, scope); err != nil {
+			return nil, err
 		}
-		dataEntries = []map[string]interface{}{defaultEntry}
 	}
 	
-	// Render command once for each data entry
-	for _, entry := range dataEntries {
-		expandedCmd := p.expandArrayFields(cmd, &schema, entry)
+	return resolved, nil
+}
+
+// selectCommands returns the commands that print in place of cmds: those
+// whose condition is false are left out, and if and switch commands are
+// replaced by their chosen branch. scope is the array entry being expanded,
+// nil outside array-bound commands. Array-bound commands are kept as they
+// are, since their conditions are checked for each of their entries.
+func (p *Parser) selectCommands(cmds []receiptformat.Command, scope *arrayScope) ([]receiptformat.Command, error) {
+	selected := make([]receiptformat.Command, 0, len(cmds))
+	for _, cmd := range cmds {
+		if cmd.ArrayBinding != "" {
+			selected = append(selected, cmd)
+			continue
+		}
 		
-		// Resolve any remaining variables
-		resolvedCmd, err := p.resolveCommand(expandedCmd)
-		if err != nil {
-			return err
+		var branch []receiptformat.Command
+		switch cmd.Type {
+		case "if":
+			ok, err := p.evalCondition(cmd.Condition, scope)
+			if err != nil {
+				return nil, err
+			}
+			branch = cmd.Else
+			if ok {
+				branch = cmd.Then
+			}
+			
+		case "switch":
+			value, err := p.evalExpression(cmd.Expression, scope, nil)
+			if err != nil {
+				return nil, err
+			}
+			branch = cmd.Default
+			for _, c := range cmd.Cases {
+				if receiptformat.ExprString(value) == c.Value {
+					branch = c.Commands
+					break
+				}
+			}
+			
+		default:
+			if cmd.Condition != "" {
+				ok, err := p.evalCondition(cmd.Condition, scope)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+				cmd.Condition = ""
+			}
+			selected = append(selected, cmd)
+			continue
 		}
 		
-		// Render
-		if err := p.renderer.RenderCommand(resolvedCmd); err != nil {
-			return err
+		// Branches can hold conditions and ifs of their own
+		branchCmds, err := p.selectCommands(branch, scope)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, branchCmds...)
+	}
+	return selected, nil
+}
+
+// evalCondition evaluates a condition, which holds if its value is true, a
+// number other than 0, or text or a list that isn't empty
+func (p *Parser) evalCondition(condition string, scope *arrayScope) (bool, error) {
+	value, err := p.evalExpression(condition, scope, nil)
+	if err != nil {
+		return false, err
+	}
+	return receiptformat.Truthy(value), nil
+}
+
+// variableArray returns the declared variable array with a name, or nil
+func (p *Parser) variableArray(name string) *receiptformat.VariableArray {
+	for i := range p.receipt.VariableArrays {
+		if p.receipt.VariableArrays[i].Name == name {
+			return &p.receipt.VariableArrays[i]
 		}
 	}
-	
 	return nil
 }
 
-func (p *Parser) expandArrayFields(cmd *receiptformat.Command, schema *receiptformat.VariableArray, data map[string]interface{}) *receiptformat.Command {
+// arrayEntries returns an array's data. Without data, one entry of the
+// fields' defaults is used for preview.
+func (p *Parser) arrayEntries(schema *receiptformat.VariableArray) []map[string]interface{} {
+	dataEntries := p.variableArrayData[schema.Name]
+	if len(dataEntries) == 0 {
+		defaultEntry := make(map[string]interface{})
+		for _, field := range schema.Schema {
+			defaultEntry[field.Field] = field.DefaultValue
+		}
+		dataEntries = []map[string]interface{}{defaultEntry}
+	}
+	return dataEntries
+}
+
+func (p *Parser) expandArrayFields(cmd *receiptformat.Command, scope *arrayScope) (*receiptformat.Command, error) {
 	// Deep copy command
 	expanded := *cmd
 	
@@ -131,54 +306,82 @@ func (p *Parser) expandArrayFields(cmd *receiptformat.Command, schema *receiptfo
 	
 	// Expand arrayField references
 	if expanded.ArrayField != "" {
-		// Find field in schema
-		var fieldDef *receiptformat.VariableArrayField
-		for i := range schema.Schema {
-			if schema.Schema[i].Field == expanded.ArrayField {
-				fieldDef = &schema.Schema[i]
-				break
-			}
-		}
-		
-		if fieldDef != nil {
-			// Get value from data or use default
-			value := data[expanded.ArrayField]
-			if value == nil {
-				value = fieldDef.DefaultValue
-			}
-			
-			// Format with prefix/suffix
-			formatted := p.formatValue(value, fieldDef.Prefix, fieldDef.Suffix)
-			
-			// Set as value
+		if formatted, ok := p.arrayFieldValue(scope.fields, scope.entry, expanded.ArrayField); ok {
 			expanded.Value = formatted
 			expanded.ArrayField = ""
 		}
 	}
 	
-	// Recursively expand nested commands (for item, box, etc.)
-	if len(expanded.LeftSide) > 0 {
-		for i := range expanded.LeftSide {
-			expandedSub := p.expandArrayFields(&expanded.LeftSide[i], schema, data)
-			expanded.LeftSide[i] = *expandedSub
+	// Expressions see this entry's fields
+	if expanded.Expression != "" {
+		value, err := p.evalExpression(expanded.Expression, scope, nil)
+		if err != nil {
+			return nil, err
 		}
+		expanded.Value = p.formatValue(value, "", nil, "", "")
+		expanded.Expression = ""
 	}
 	
-	if len(expanded.RightSide) > 0 {
-		for i := range expanded.RightSide {
-			expandedSub := p.expandArrayFields(&expanded.RightSide[i], schema, data)
-			expanded.RightSide[i] = *expandedSub
+	// And those in spans
+	expanded.Spans = copySpans(cmd.Spans)
+	for i := range expanded.Spans {
+		span := &expanded.Spans[i]
+		if span.ArrayField == "" {
+			continue
+		}
+		if formatted, ok := p.arrayFieldValue(scope.fields, scope.entry, span.ArrayField); ok {
+			span.Value = formatted
+			span.ArrayField = ""
 		}
 	}
 	
-	if len(expanded.Commands) > 0 {
-		for i := range expanded.Commands {
-			expandedSub := p.expandArrayFields(&expanded.Commands[i], schema, data)
-			expanded.Commands[i] = *expandedSub
-		}
+	// Recursively expand nested commands (for item, box, etc.). The slices
+	// are copied so each entry gets its own values instead of overwriting
+	// the template.
+	var err error
+	if expanded.LeftSide, err = p.expandArrayCommands(cmd.LeftSide, scope); err != nil {
+		return nil, err
+	}
+	if expanded.RightSide, err = p.expandArrayCommands(cmd.RightSide, scope); err != nil {
+		return nil, err
+	}
+	if expanded.Commands, err = p.expandArrayCommands(cmd.Commands, scope); err != nil {
+		return nil, err
 	}
 	
-	return &expanded
+	return &expanded, nil
+}
+
+// expandArrayCommands expands the commands nested in an array-bound command
+// for an entry, leaving out those whose condition is false for it
+func (p *Parser) expandArrayCommands(cmds []receiptformat.Command, scope *arrayScope) ([]receiptformat.Command, error) {
+	if cmds == nil {
+		return nil, nil
+	}
+	
+	selected, err := p.selectCommands(cmds, scope)
+	if err != nil {
+		return nil, err
+	}
+	expanded := make([]receiptformat.Command, 0, len(selected))
+	for i := range selected {
+		// Arrays nested in this one repeat for each of their own entries
+		if selected[i].ArrayBinding != "" {
+			cmds, err := p.resolveArrayBoundCommand(&selected[i], scope)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, cmds...)
+			continue
+		}
+		
+		expandedSub, err := p.expandArrayFields(&selected[i], scope)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, *expandedSub)
+	}
+	return expanded, nil
 }
 
 func (p *Parser) resolveCommand(cmd *receiptformat.Command) (*receiptformat.Command, error) {
@@ -186,69 +389,257 @@ func (p *Parser) resolveCommand(cmd *receiptformat.Command) (*receiptformat.Comm
 	
 	// Resolve dynamicValue
 	if resolved.DynamicValue != "" {
-		// Find variable definition
-		var varDef *receiptformat.Variable
-		for i := range p.receipt.Variables {
-			if p.receipt.Variables[i].Let == resolved.DynamicValue {
-				varDef = &p.receipt.Variables[i]
-				break
-			}
+		formatted, ok, err := p.variableValue(resolved.DynamicValue)
+		if err != nil {
+			return nil, err
 		}
-		
-		if varDef != nil {
-			// Get value from data or use default
-			value := p.variableData[resolved.DynamicValue]
-			if value == nil {
-				value = varDef.DefaultValue
-			}
-			
-			// Format with prefix/suffix
-			formatted := p.formatValue(value, varDef.Prefix, varDef.Suffix)
-			
-			// Set as value
+		if ok {
 			resolved.Value = formatted
 			resolved.DynamicValue = ""
 		}
 	}
 	
+	// Evaluate expressions not already evaluated with an array entry
+	if resolved.Expression != "" {
+		value, err := p.evalExpression(resolved.Expression, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Value = p.formatValue(value, "", nil, "", "")
+		resolved.Expression = ""
+	}
+	
+	// And those in spans
+	resolved.Spans = copySpans(cmd.Spans)
+	for i := range resolved.Spans {
+		span := &resolved.Spans[i]
+		if span.DynamicValue == "" {
+			continue
+		}
+		formatted, ok, err := p.variableValue(span.DynamicValue)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			span.Value = formatted
+			span.DynamicValue = ""
+		}
+	}
+	
+	// Build QR code payloads now that their variables are known
+	if resolved.Payload != nil {
+		value, err := p.resolvePayload(resolved.Payload)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Value = value
+		resolved.Payload = nil
+	}
+	
 	// Recursively resolve nested commands
-	if len(resolved.LeftSide) > 0 {
-		for i := range resolved.LeftSide {
-			resolvedSub, err := p.resolveCommand(&resolved.LeftSide[i])
+	var err error
+	if resolved.LeftSide, err = p.resolveCommands(cmd.LeftSide); err != nil {
+		return nil, err
+	}
+	if resolved.RightSide, err = p.resolveCommands(cmd.RightSide); err != nil {
+		return nil, err
+	}
+	if resolved.Commands, err = p.resolveCommands(cmd.Commands); err != nil {
+		return nil, err
+	}
+	
+	return &resolved, nil
+}
+
+// resolveCommands resolves commands, leaving out those whose condition is
+// false and repeating array-bound ones for each entry. The result is a copy
+// that can be modified without touching the template.
+func (p *Parser) resolveCommands(cmds []receiptformat.Command) ([]receiptformat.Command, error) {
+	if cmds == nil {
+		return nil, nil
+	}
+	
+	selected, err := p.selectCommands(cmds, nil)
+	if err != nil {
+		return nil, err
+	}
+	resolved := make([]receiptformat.Command, 0, len(selected))
+	for i := range selected {
+		if selected[i].ArrayBinding != "" {
+			cmds, err := p.resolveArrayBoundCommand(&selected[i], nil)
 			if err != nil {
 				return nil, err
 			}
-			resolved.LeftSide[i] = *resolvedSub
+			resolved = append(resolved, cmds...)
+			continue
+		}
+		
+		resolvedSub, err := p.resolveCommand(&selected[i])
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, *resolvedSub)
+	}
+	return resolved, nil
+}
+
+// variableValue returns a variable's value, or its default if none was
+// set, formatted with its format, prefix and suffix. Computed variables are
+// evaluated. ok is false for an unknown variable.
+func (p *Parser) variableValue(name string) (formatted string, ok bool, err error) {
+	for i := range p.receipt.Variables {
+		varDef := &p.receipt.Variables[i]
+		if varDef.Let != name {
+			continue
+		}
+		
+		value, err := p.rawVariableValue(varDef, nil)
+		if err != nil {
+			return "", false, err
+		}
+		return p.formatValue(value, varDef.ValueType, varDef.Format, varDef.Prefix, varDef.Suffix), true, nil
+	}
+	return "", false, nil
+}
+
+// rawVariableValue returns a variable's unformatted value: its data, its
+// default or what its expression computes. evaluating holds the computed
+// variables being evaluated, to stop one that depends on itself.
+func (p *Parser) rawVariableValue(varDef *receiptformat.Variable, evaluating map[string]bool) (interface{}, error) {
+	if varDef.Expression == "" {
+		value := p.variableData[varDef.Let]
+		if value == nil {
+			value = varDef.DefaultValue
 		}
+		return value, nil
 	}
 	
-	if len(resolved.RightSide) > 0 {
-		for i := range resolved.RightSide {
-			resolvedSub, err := p.resolveCommand(&resolved.RightSide[i])
-			if err != nil {
-				return nil, err
+	if evaluating[varDef.Let] {
+		return nil, fmt.Errorf("variable '%s' depends on itself", varDef.Let)
+	}
+	nested := map[string]bool{varDef.Let: true}
+	for name := range evaluating {
+		nested[name] = true
+	}
+	value, err := p.evalExpression(varDef.Expression, nil, nested)
+	if err != nil {
+		return nil, fmt.Errorf("variable '%s': %w", varDef.Let, err)
+	}
+	return value, nil
+}
+
+// evalExpression evaluates an expression. Fields of the arrays scope is
+// bound to are the current entry's values, or lists of the group's for a
+// group header or footer; fields of other arrays are lists of every entry's
+// values.
+func (p *Parser) evalExpression(source string, scope *arrayScope, evaluating map[string]bool) (interface{}, error) {
+	expr, err := receiptformat.ParseExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("expression '%s': %w", source, err)
+	}
+	
+	lookup := func(name string) (interface{}, error) {
+		arrayName, field, isField := strings.Cut(name, ".")
+		if !isField {
+			for i := range p.receipt.Variables {
+				if varDef := &p.receipt.Variables[i]; varDef.Let == name {
+					value, err := p.rawVariableValue(varDef, evaluating)
+					if err != nil {
+						return nil, err
+					}
+					return receiptformat.ExprValue(value, varDef.ValueType), nil
+				}
 			}
-			resolved.RightSide[i] = *resolvedSub
+			return nil, fmt.Errorf("unknown variable '%s'", name)
+		}
+		
+		fields, entries, single, err := p.lookupArray(arrayName, scope)
+		if err != nil {
+			return nil, err
+		}
+		fieldDef := findField(fields, field)
+		if fieldDef == nil {
+			return nil, fmt.Errorf("unknown field '%s' in array '%s'", field, arrayName)
+		}
+		if single {
+			return exprFieldValue(fieldDef, entries[0]), nil
 		}
+		
+		values := make([]interface{}, len(entries))
+		for i, data := range entries {
+			values[i] = exprFieldValue(fieldDef, data)
+		}
+		return values, nil
 	}
 	
-	if len(resolved.Commands) > 0 {
-		for i := range resolved.Commands {
-			resolvedSub, err := p.resolveCommand(&resolved.Commands[i])
-			if err != nil {
-				return nil, err
+	value, err := expr.Eval(receiptformat.ExprEnv{Lookup: lookup, Locale: p.receipt.Locale})
+	if err != nil {
+		return nil, fmt.Errorf("expression '%s': %w", source, err)
+	}
+	return value, nil
+}
+
+// arrayFieldValue returns a field of an array entry, or the field's default
+// if the entry doesn't have it, formatted with its format, prefix and suffix. ok is
+// false for a field the array doesn't have.
+func (p *Parser) arrayFieldValue(fields []receiptformat.VariableArrayField, data map[string]interface{}, field string) (formatted string, ok bool) {
+	fieldDef := findField(fields, field)
+	if fieldDef == nil {
+		return "", false
+	}
+	
+	value := data[field]
+	if value == nil {
+		value = fieldDef.DefaultValue
+	}
+	return p.formatValue(value, fieldDef.ValueType, fieldDef.Format, fieldDef.Prefix, fieldDef.Suffix), true
+}
+
+// resolvePayload fills in a payload's dynamic fields and builds it. Values
+// are used as they are, without the variable's format, prefix and suffix,
+// since payload formats expect plain values. Computed variables are evaluated.
+func (p *Parser) resolvePayload(payload *receiptformat.QRPayload) (string, error) {
+	resolved := receiptformat.QRPayload{Type: payload.Type, Fields: make(map[string]string)}
+	for field, value := range payload.Fields {
+		resolved.Fields[field] = value
+	}
+	
+	for field, name := range payload.DynamicFields {
+		value := p.variableData[name]
+		for i := range p.receipt.Variables {
+			if p.receipt.Variables[i].Let == name {
+				var err error
+				if value, err = p.rawVariableValue(&p.receipt.Variables[i], nil); err != nil {
+					return "", fmt.Errorf("payload field '%s': %w", field, err)
+				}
+				break
 			}
-			resolved.Commands[i] = *resolvedSub
 		}
+		resolved.Fields[field] = p.formatValue(value, "", nil, "", "")
 	}
 	
-	return &resolved, nil
+	return resolved.Build()
 }
 
-func (p *Parser) formatValue(value interface{}, prefix string, suffix string) string {
+// copySpans returns a copy of a span slice that can be modified without
+// touching the original
+func copySpans(spans []receiptformat.Span) []receiptformat.Span {
+	if spans == nil {
+		return nil
+	}
+	return append([]receiptformat.Span(nil), spans...)
+}
+
+// formatValue formats a value for its type and format, in the receipt's
+// locale, between its prefix and suffix
+func (p *Parser) formatValue(value interface{}, valueType string, format *receiptformat.Format, prefix string, suffix string) string {
 	if value == nil {
 		return ""
 	}
 	
-	return fmt.Sprintf("%s%v%s", prefix, value, suffix)
+	locale := ""
+	if p.receipt != nil {
+		locale = p.receipt.Locale
+	}
+	return prefix + receiptformat.FormatValue(value, valueType, format, locale) + suffix
 }
@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	
+	"github.com/thereceipt/receipt-engine/internal/renderer"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
@@ -109,26 +112,517 @@ func TestParser_WithArrays(t *testing.T) {
 	}
 }
 
+func TestParser_ResolveArrayEntries(t *testing.T) {
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		VariableArrays: []receiptformat.VariableArray{
+			{
+				Name: "products",
+				Schema: []receiptformat.VariableArrayField{
+					{Field: "name", ValueType: "string"},
+					{Field: "price", ValueType: "double", Prefix: "$"},
+				},
+			},
+		},
+		Commands: []receiptformat.Command{
+			{
+				Type:         "item",
+				ArrayBinding: "products",
+				LeftSide:     []receiptformat.Command{{Type: "text", ArrayField: "name"}},
+				RightSide:    []receiptformat.Command{{Type: "text", ArrayField: "price"}},
+			},
+		},
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	parser.SetVariableArrayData(map[string][]map[string]interface{}{
+		"products": {
+			{"name": "Coffee", "price": 3.5},
+			{"name": "Croissant", "price": 2.75},
+		},
+	})
+	
+	cmds, err := parser.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	
+	if len(cmds) != 2 {
+		t.Fatalf("Expected 2 commands, got %d", len(cmds))
+	}
+	
+	// Each entry gets its own values
+	if cmds[0].LeftSide[0].Value != "Coffee" || cmds[1].LeftSide[0].Value != "Croissant" {
+		t.Errorf("Expected Coffee and Croissant, got %q and %q", cmds[0].LeftSide[0].Value, cmds[1].LeftSide[0].Value)
+	}
+	if cmds[1].RightSide[0].Value != "$2.75" {
+		t.Errorf("Expected $2.75, got %q", cmds[1].RightSide[0].Value)
+	}
+	
+	// The template is left untouched
+	if receipt.Commands[0].LeftSide[0].ArrayField != "name" {
+		t.Error("Expected receipt commands not to be modified")
+	}
+}
+
+func TestParser_ResolvePayload(t *testing.T) {
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		Variables: []receiptformat.Variable{
+			{Let: "total", ValueType: "double", DefaultValue: 1.0, Prefix: "€"},
+			{Let: "order", ValueType: "string", DefaultValue: "0"},
+		},
+		Commands: []receiptformat.Command{
+			{
+				Type: "qrcode",
+				Payload: &receiptformat.QRPayload{
+					Type:          "epc",
+					Fields:        map[string]string{"name": "Coffee Shop", "iban": "DE89370400440532013000"},
+					DynamicFields: map[string]string{"amount": "total", "text": "order"},
+				},
+			},
+		},
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	parser.SetVariableData(map[string]interface{}{"total": 12.5, "order": "Order 42"})
+	
+	cmds, err := parser.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	
+	// Variables go in without their prefix
+	want := "BCD\n002\n1\nSCT\n\nCoffee Shop\nDE89370400440532013000\nEUR12.50\n\n\nOrder 42\n"
+	if cmds[0].Value != want || cmds[0].Payload != nil {
+		t.Errorf("Expected the built payload as the value, got %q", cmds[0].Value)
+	}
+}
+
+func TestParser_ResolvePayload_ComputedVariable(t *testing.T) {
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		Variables: []receiptformat.Variable{
+			{Let: "subtotal", ValueType: "double", DefaultValue: 10.0},
+			{Let: "total", ValueType: "double", Expression: "subtotal * 1.25"},
+		},
+		Commands: []receiptformat.Command{
+			{
+				Type: "qrcode",
+				Payload: &receiptformat.QRPayload{
+					Type:          "epc",
+					Fields:        map[string]string{"name": "Coffee Shop", "iban": "DE89370400440532013000"},
+					DynamicFields: map[string]string{"amount": "total"},
+				},
+			},
+		},
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	cmds, err := parser.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	
+	if !strings.Contains(cmds[0].Value, "\nEUR12.50\n") {
+		t.Errorf("Expected the computed amount in the payload, got %q", cmds[0].Value)
+	}
+}
+
+func TestParser_ResolveSpans(t *testing.T) {
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		Variables: []receiptformat.Variable{
+			{Let: "total", ValueType: "double", DefaultValue: 0.0, Prefix: "$"},
+		},
+		VariableArrays: []receiptformat.VariableArray{
+			{
+				Name:   "products",
+				Schema: []receiptformat.VariableArrayField{{Field: "name", ValueType: "string"}},
+			},
+		},
+		Commands: []receiptformat.Command{
+			{Type: "text", Spans: []receiptformat.Span{{Value: "Total: "}, {DynamicValue: "total", Weight: "bold"}}},
+			{Type: "text", ArrayBinding: "products", Spans: []receiptformat.Span{{Value: "- "}, {ArrayField: "name", Italic: true}}},
+		},
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	parser.SetVariableData(map[string]interface{}{"total": 4.5})
+	parser.SetVariableArrayData(map[string][]map[string]interface{}{
+		"products": {{"name": "Coffee"}, {"name": "Croissant"}},
+	})
+	
+	cmds, err := parser.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	
+	if len(cmds) != 3 {
+		t.Fatalf("Expected 3 commands, got %d", len(cmds))
+	}
+	if cmds[0].Spans[1].Value != "$4.5" || cmds[0].Spans[1].Weight != "bold" {
+		t.Errorf("Expected bold $4.5, got %+v", cmds[0].Spans[1])
+	}
+	if cmds[1].Spans[1].Value != "Coffee" || cmds[2].Spans[1].Value != "Croissant" {
+		t.Errorf("Expected Coffee and Croissant, got %q and %q", cmds[1].Spans[1].Value, cmds[2].Spans[1].Value)
+	}
+	
+	// The template is left untouched
+	if receipt.Commands[1].Spans[1].ArrayField != "name" || receipt.Commands[1].Spans[1].Value != "" {
+		t.Error("Expected receipt spans not to be modified")
+	}
+}
+
+func TestParser_ExecuteESCPOS(t *testing.T) {
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		Variables: []receiptformat.Variable{
+			{Let: "storeName", ValueType: "string", DefaultValue: "My Store"},
+		},
+		Commands: []receiptformat.Command{
+			{Type: "text", DynamicValue: "storeName", Align: "center"},
+			{Type: "qrcode", Value: "https://example.com"},
+		},
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	parser.SetVariableData(map[string]interface{}{"storeName": "Coffee Shop"})
+	
+	data, err := parser.ExecuteESCPOS()
+	if err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+	
+	if !bytes.Contains(data, []byte("Coffee Shop\n")) {
+		t.Errorf("Expected resolved variable as text, got %q", data)
+	}
+	if !bytes.Contains(data, []byte("https://example.com")) {
+		t.Error("Expected QR code data to be sent to the printer")
+	}
+}
+
+func TestParser_Controls(t *testing.T) {
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		Commands: []receiptformat.Command{
+			{Type: "drawer", Pin: 5},
+			{Type: "text", Value: "Customer copy"},
+			{Type: "cut", Mode: "partial"},
+			{Type: "text", Value: "Merchant copy"},
+			{Type: "cut", Lines: 2},
+		},
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	if _, err := parser.Execute(); err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+	
+	controls := parser.Controls()
+	if len(controls) != 3 {
+		t.Fatalf("Expected 3 controls, got %d", len(controls))
+	}
+	
+	drawer, first, second := controls[0], controls[1], controls[2]
+	if drawer.Type != renderer.ControlDrawer || drawer.Pin != 5 || drawer.Y != 0 {
+		t.Errorf("Unexpected drawer kick: %+v", drawer)
+	}
+	if first.Type != renderer.ControlCut || !first.Partial || second.Partial || second.Feed != 2 {
+		t.Errorf("Unexpected cuts: %+v, %+v", first, second)
+	}
+	if first.Y <= 0 || second.Y <= first.Y {
+		t.Errorf("Expected cuts below each copy, got %+v, %+v", first, second)
+	}
+}
+
 func TestFormatValue(t *testing.T) {
 	parser := &Parser{}
 	
 	tests := []struct {
-		value    interface{}
-		prefix   string
-		suffix   string
-		expected string
+		value     interface{}
+		valueType string
+		prefix    string
+		suffix    string
+		expected  string
 	}{
-		{10.50, "$", "", "$10.5"},
-		{5, "", "x", "5x"},
-		{"Test", "Prefix:", ":Suffix", "Prefix:Test:Suffix"},
-		{nil, "$", "", ""},
+		{10.50, "double", "$", "", "$10.5"},
+		{0.1 + 0.2, "double", "", "", "0.3"},
+		{5, "number", "", "x", "5x"},
+		{"Test", "string", "Prefix:", ":Suffix", "Prefix:Test:Suffix"},
+		{nil, "double", "$", "", ""},
 	}
 	
 	for _, tt := range tests {
-		result := parser.formatValue(tt.value, tt.prefix, tt.suffix)
+		result := parser.formatValue(tt.value, tt.valueType, nil, tt.prefix, tt.suffix)
 		if result != tt.expected {
 			t.Errorf("formatValue(%v, %q, %q) = %q, want %q",
 				tt.value, tt.prefix, tt.suffix, result, tt.expected)
 		}
 	}
 }
+
+func TestParser_FormattedVariables(t *testing.T) {
+	two := 2
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		Locale:  "de-DE",
+		Variables: []receiptformat.Variable{
+			{Let: "total", ValueType: "double", Format: &receiptformat.Format{Currency: "EUR", Grouping: true}},
+			{Let: "tip", ValueType: "double", Format: &receiptformat.Format{Currency: "USD", Locale: "en-US"}},
+			{Let: "paidAt", ValueType: "date", Format: &receiptformat.Format{Layout: "02.01.2006 15:04", Timezone: "Europe/Berlin"}},
+		},
+		VariableArrays: []receiptformat.VariableArray{
+			{
+				Name:   "products",
+				Schema: []receiptformat.VariableArrayField{{Field: "qty", ValueType: "double", Format: &receiptformat.Format{Decimals: &two}}},
+			},
+		},
+		Commands: []receiptformat.Command{
+			{Type: "text", DynamicValue: "total"},
+			{Type: "text", DynamicValue: "tip"},
+			{Type: "text", DynamicValue: "paidAt"},
+			{Type: "text", ArrayBinding: "products", ArrayField: "qty"},
+		},
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	parser.SetVariableData(map[string]interface{}{"total": 1234.5, "tip": 2.0, "paidAt": "2024-03-01T18:30:00Z"})
+	parser.SetVariableArrayData(map[string][]map[string]interface{}{"products": {{"qty": 1.5}}})
+	
+	cmds, err := parser.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	
+	want := []string{"1.234,50\u00a0€", "$2.00", "01.03.2024 19:30", "1,50"}
+	for i, w := range want {
+		if cmds[i].Value != w {
+			t.Errorf("Command %d: expected %q, got %q", i, w, cmds[i].Value)
+		}
+	}
+}
+
+func TestParser_Expressions(t *testing.T) {
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		Variables: []receiptformat.Variable{
+			{Let: "customer", ValueType: "string"},
+			{Let: "taxRate", ValueType: "double", DefaultValue: 0.1},
+			{Let: "subtotal", ValueType: "double", Expression: "sum(products.price * products.qty)"},
+			{Let: "total", ValueType: "double", Expression: "subtotal * (1 + taxRate)", Format: &receiptformat.Format{Currency: "USD"}},
+		},
+		VariableArrays: []receiptformat.VariableArray{
+			{
+				Name: "products",
+				Schema: []receiptformat.VariableArrayField{
+					{Field: "price", ValueType: "double"},
+					{Field: "qty", ValueType: "number", DefaultValue: 1},
+				},
+			},
+		},
+		Commands: []receiptformat.Command{
+			{Type: "text", Expression: "'Thanks, ' + upper(customer)"},
+			{Type: "text", ArrayBinding: "products", Expression: "products.qty + ' x ' + format(products.price, 2)"},
+			{Type: "text", DynamicValue: "subtotal"},
+			{Type: "text", DynamicValue: "total"},
+			{Type: "text", Expression: "count(products.price) + ' items'"},
+		},
+	}
+	
+	if err := receiptformat.Validate(receipt); err != nil {
+		t.Fatalf("Expected valid receipt, got %v", err)
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	parser.SetVariableData(map[string]interface{}{"customer": "ada"})
+	parser.SetVariableArrayData(map[string][]map[string]interface{}{
+		"products": {
+			{"price": 2.5, "qty": "2"},
+			{"price": 10.0},
+		},
+	})
+	
+	cmds, err := parser.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	
+	want := []string{"Thanks, ADA", "2 x 2.50", "1 x 10.00", "15", "$16.50", "2 items"}
+	if len(cmds) != len(want) {
+		t.Fatalf("Expected %d commands, got %d", len(want), len(cmds))
+	}
+	for i, w := range want {
+		if cmds[i].Value != w || cmds[i].Expression != "" {
+			t.Errorf("Command %d: expected %q, got %q", i, w, cmds[i].Value)
+		}
+	}
+	
+	// Errors while evaluating fail the print
+	parser.SetVariableArrayData(map[string][]map[string]interface{}{"products": {{"price": "free"}}})
+	if _, err := parser.Resolve(); err == nil {
+		t.Error("Expected an error for a price that isn't a number")
+	}
+}
+
+func TestParser_Conditionals(t *testing.T) {
+	text := func(value string) receiptformat.Command {
+		return receiptformat.Command{Type: "text", Value: value}
+	}
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		Variables: []receiptformat.Variable{
+			{Let: "balance", ValueType: "double"},
+			{Let: "member", ValueType: "string"},
+		},
+		VariableArrays: []receiptformat.VariableArray{
+			{
+				Name: "products",
+				Schema: []receiptformat.VariableArrayField{
+					{Field: "name", ValueType: "string"},
+					{Field: "qty", ValueType: "number"},
+				},
+			},
+		},
+		Commands: []receiptformat.Command{
+			{Type: "if", Condition: "balance > 0", Then: []receiptformat.Command{text("BALANCE DUE")}, Else: []receiptformat.Command{text("PAID")}},
+			{Type: "text", Value: "Loyalty", Condition: "member != ''"},
+			{Type: "text", ArrayBinding: "products", ArrayField: "name", Condition: "products.qty > 0"},
+			{
+				Type:         "item",
+				ArrayBinding: "products",
+				LeftSide:     []receiptformat.Command{{Type: "text", ArrayField: "name"}},
+				RightSide: []receiptformat.Command{
+					{Type: "if", Condition: "products.qty == 0", Then: []receiptformat.Command{text("sold out")}, Else: []receiptformat.Command{{Type: "text", ArrayField: "qty"}}},
+				},
+			},
+			{
+				Type:       "switch",
+				Expression: "upper(member)",
+				Cases: []receiptformat.SwitchCase{
+					{Value: "GOLD", Commands: []receiptformat.Command{text("Gold member")}},
+					{Value: "SILVER", Commands: []receiptformat.Command{text("Silver member")}},
+				},
+				Default: []receiptformat.Command{text("Join today")},
+			},
+		},
+	}
+	
+	resolve := func(balance float64, member string) []receiptformat.Command {
+		parser, _ := New(receipt, "80mm")
+		parser.SetVariableData(map[string]interface{}{"balance": balance, "member": member})
+		parser.SetVariableArrayData(map[string][]map[string]interface{}{
+			"products": {
+				{"name": "Coffee", "qty": 2},
+				{"name": "Bagel", "qty": 0},
+			},
+		})
+		cmds, err := parser.Resolve()
+		if err != nil {
+			t.Fatalf("Failed to resolve: %v", err)
+		}
+		return cmds
+	}
+	
+	cmds := resolve(4.5, "gold")
+	values := []string{}
+	for _, cmd := range cmds {
+		if cmd.Type == "item" {
+			values = append(values, cmd.LeftSide[0].Value+"="+cmd.RightSide[0].Value)
+			continue
+		}
+		values = append(values, cmd.Value)
+	}
+	want := []string{"BALANCE DUE", "Loyalty", "Coffee", "Coffee=2", "Bagel=sold out", "Gold member"}
+	if strings.Join(values, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %q, got %q", want, values)
+	}
+	
+	cmds = resolve(0, "")
+	if cmds[0].Value != "PAID" || cmds[1].Value != "Coffee" || cmds[len(cmds)-1].Value != "Join today" {
+		t.Errorf("Unexpected commands without a balance or member: %+v", cmds)
+	}
+	
+	// The template keeps its conditions and branches
+	if receipt.Commands[3].RightSide[0].Type != "if" || receipt.Commands[1].Condition == "" {
+		t.Error("Resolving modified the receipt's commands")
+	}
+}
+
+func TestParser_NestedArraysAndGroups(t *testing.T) {
+	receipt := &receiptformat.Receipt{
+		Version: "1.0",
+		VariableArrays: []receiptformat.VariableArray{
+			{
+				Name: "items",
+				Schema: []receiptformat.VariableArrayField{
+					{Field: "name", ValueType: "string"},
+					{Field: "course", ValueType: "string", DefaultValue: "Other"},
+					{Field: "price", ValueType: "double"},
+					{Field: "modifiers", ValueType: "array", Schema: []receiptformat.VariableArrayField{
+						{Field: "label", ValueType: "string", Prefix: "  + "},
+						{Field: "price", ValueType: "double"},
+					}},
+				},
+			},
+		},
+		Commands: []receiptformat.Command{
+			{
+				Type:         "box",
+				ArrayBinding: "items",
+				GroupBy:      "course",
+				GroupFooter:  []receiptformat.Command{{Type: "text", Expression: "'Subtotal ' + sum(items.price)"}},
+				Commands: []receiptformat.Command{
+					{Type: "text", Expression: "items.name + ' ' + (items.price + sum(modifiers.price))"},
+					{Type: "text", ArrayBinding: "modifiers", ArrayField: "label"},
+				},
+			},
+		},
+	}
+	if err := receiptformat.Validate(receipt); err != nil {
+		t.Fatalf("Expected valid receipt, got %v", err)
+	}
+	
+	parser, _ := New(receipt, "80mm")
+	parser.SetVariableArrayData(map[string][]map[string]interface{}{
+		"items": {
+			{"name": "Burger", "course": "Mains", "price": 12.0, "modifiers": []interface{}{
+				map[string]interface{}{"label": "no onions"},
+				map[string]interface{}{"label": "extra cheese", "price": 1.5},
+			}},
+			{"name": "Soup", "course": "Starters", "price": 6.0},
+			{"name": "Pasta", "course": "Mains", "price": 11.0, "modifiers": []map[string]interface{}{{"label": "gluten free"}}},
+			{"name": "Bread", "price": 3.0},
+		},
+	})
+	
+	cmds, err := parser.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	
+	var lines []string
+	for _, cmd := range cmds {
+		if cmd.Type != "box" {
+			lines = append(lines, cmd.Value)
+			continue
+		}
+		for _, nested := range cmd.Commands {
+			lines = append(lines, nested.Value)
+		}
+	}
+	want := []string{
+		"Mains",
+		"Burger 13.5", "  + no onions", "  + extra cheese",
+		"Pasta 11", "  + gluten free",
+		"Subtotal 23",
+		"Starters", "Soup 6", "Subtotal 6",
+		"Other", "Bread 3", "Subtotal 3",
+	}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected\n%q\ngot\n%q", want, lines)
+	}
+	if cmds[0].Weight != "bold" {
+		t.Errorf("Expected a bold default group header, got %+v", cmds[0])
+	}
+}
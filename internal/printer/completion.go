@@ -0,0 +1,136 @@
+package printer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Completion modes control when a print job counts as completed. Modes other
+// than fire and forget check the printer's status before sending a job and
+// retry it if the printer reports a problem. Once a job is sent it is never
+// resent automatically: if it can't be confirmed it goes to the dead-letter
+// state, since the receipt may well have printed.
+const (
+	// CompletionFireAndForget completes a job once its data is written
+	CompletionFireAndForget = "fire_and_forget"
+	// CompletionStatus completes a job if the printer reports no error
+	// right after the write. The check happens as soon as the data is sent,
+	// so it catches paper out or an open cover but not a jam mid-receipt.
+	CompletionStatus = "status"
+	// CompletionProcessID waits for the printer to acknowledge it has
+	// processed the job (GS ( H on Epson) and then checks its status
+	CompletionProcessID = "process_id"
+)
+
+// confirmTimeout bounds how long a printer has to finish printing a job
+const confirmTimeout = 30 * time.Second
+
+// ValidCompletionMode reports whether mode is a known completion mode
+func ValidCompletionMode(mode string) bool {
+	switch mode {
+	case CompletionFireAndForget, CompletionStatus, CompletionProcessID:
+		return true
+	}
+	return false
+}
+
+// checkReady asks the printer whether it can print before a job is sent.
+// Nothing has been written yet, so a problem it reports can be retried.
+func checkReady(conn PrinterConnection) error {
+	sc, ok := conn.(StatusConnection)
+	if !ok {
+		return Permanent(errNoStatus())
+	}
+
+	status, err := QueryStatus(sc)
+	if errors.Is(err, ErrStatusUnsupported) {
+		return Permanent(errNoStatus())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read printer status: %w", err)
+	}
+	if !status.Ready() {
+		return fmt.Errorf("printer reported %s", status.Problem())
+	}
+
+	return nil
+}
+
+// confirmPrint checks with the printer that a job it was just sent printed.
+// Any error leaves the job's outcome unknown: it may or may not have printed.
+func confirmPrint(conn PrinterConnection, mode string, id int) error {
+	if conn == nil {
+		return fmt.Errorf("printer disconnected before confirming")
+	}
+
+	sc, ok := conn.(StatusConnection)
+	if !ok {
+		return errNoStatus()
+	}
+
+	if mode == CompletionProcessID {
+		if err := waitForProcessID(sc, id, confirmTimeout); err != nil {
+			return err
+		}
+	}
+
+	status, err := QueryStatus(sc)
+	if err != nil {
+		return fmt.Errorf("failed to read printer status: %w", err)
+	}
+	if !status.Ready() {
+		return fmt.Errorf("printer reported %s", status.Problem())
+	}
+
+	return nil
+}
+
+// errNoStatus explains that a printer's completion mode can't work
+func errNoStatus() error {
+	return fmt.Errorf("%w; use %s completion", ErrStatusUnsupported, CompletionFireAndForget)
+}
+
+// processID derives the 4-digit process ID sent with a job
+func processID(job *PrintJob) int {
+	return int(job.CreatedAt.UnixNano() % 10000)
+}
+
+// processIDDigits encodes a process ID as the four ASCII digits GS ( H uses
+func processIDDigits(id int) []byte {
+	return []byte(fmt.Sprintf("%04d", id%10000))
+}
+
+// waitForProcessID sends GS ( H fn=48 and waits for the printer to echo the
+// process ID back, which it only does after everything sent before it has
+// been processed
+func waitForProcessID(conn StatusConnection, id int, timeout time.Duration) error {
+	digits := processIDDigits(id)
+
+	request := append([]byte{0x1D, 0x28, 0x48, 0x06, 0x00, 0x30, 0x30}, digits...)
+	want := append(append([]byte{0x37, 0x22}, digits...), 0x00)
+
+	deadline := time.Now().Add(timeout)
+	var received []byte
+	buf := make([]byte, 64)
+
+	for time.Now().Before(deadline) {
+		n, err := conn.Transact(request, buf, time.Until(deadline))
+		request = nil
+		if err == ErrStatusTimeout {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read process ID response: %w", err)
+		}
+
+		// Status Back frames may be mixed in with the response
+		received = append(received, buf[:n]...)
+		if bytes.Contains(received, want) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("printer did not acknowledge the job within %s", timeout)
+}
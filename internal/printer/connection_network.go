@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -16,7 +17,7 @@ type NetworkConnection struct {
 
 // ConnectNetwork connects to a network printer
 func ConnectNetwork(host string, port int) (*NetworkConnection, error) {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 	
 	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
 	if err != nil {
@@ -36,12 +37,31 @@ func (c *NetworkConnection) Write(data []byte) (int, error) {
 	return c.conn.Write(data)
 }
 
+// Transact sends a request and reads the printer's reply
+func (c *NetworkConnection) Transact(req []byte, resp []byte, timeout time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(req) > 0 {
+		if _, err := c.conn.Write(req); err != nil {
+			return 0, err
+		}
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	n, err := c.conn.Read(resp)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return n, ErrStatusTimeout
+	}
+	return n, err
+}
+
 // Print prints an image to the network printer
-func (c *NetworkConnection) Print(img image.Image) error {
-	data := EncodeImageToESCPOS(img)
-	
-	_, err := c.Write(data)
-	if err != nil {
+func (c *NetworkConnection) Print(img image.Image, opts PrintOptions) error {
+	// Bands go out one at a time so long receipts don't overflow the printer's buffer
+	if err := writeBands(c, EncodeImageBands(img, opts), opts); err != nil {
 		return fmt.Errorf("failed to write to network printer: %w", err)
 	}
 	
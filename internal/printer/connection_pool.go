@@ -7,11 +7,23 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+
+	"github.com/thereceipt/receipt-engine/internal/profile"
+	"github.com/thereceipt/receipt-engine/internal/renderer"
 )
 
+// PrintOptions controls how an image is sent to a printer
+type PrintOptions struct {
+	Controls    []renderer.Control // Cuts and drawer kicks, in receipt order
+	Profile     *profile.Profile   // Printer capabilities, nil for a generic printer
+	BandHeight  int                // Rows per raster band, 0 for DefaultBandHeight
+	FlowControl string             // How to wait for the printer between bands
+	Progress    func(sent, total int)
+}
+
 // PrinterConnection is a unified interface for all printer types
 type PrinterConnection interface {
-	Print(img image.Image) error
+	Print(img image.Image, opts PrintOptions) error
 	Write(data []byte) (int, error)
 	Close() error
 }
@@ -19,6 +31,7 @@ type PrinterConnection interface {
 // ConnectionPool manages connections to printers
 type ConnectionPool struct {
 	connections map[string]PrinterConnection
+	held        map[string]*sync.Mutex // Per printer, held by a print job or status poll
 	mu          sync.RWMutex
 }
 
@@ -26,16 +39,15 @@ type ConnectionPool struct {
 func NewConnectionPool() *ConnectionPool {
 	return &ConnectionPool{
 		connections: make(map[string]PrinterConnection),
+		held:        make(map[string]*sync.Mutex),
 	}
 }
 
-// Connect establishes a connection to a printer
+// Connect establishes a connection to a printer. The pool is not locked while
+// dialing, so a slow or unreachable printer doesn't block the others.
 func (p *ConnectionPool) Connect(printer *Printer) error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	// Check if already connected
-	if _, exists := p.connections[printer.ID]; exists {
+	if p.IsConnected(printer.ID) {
 		return nil // Already connected
 	}
 
@@ -64,19 +76,28 @@ func (p *ConnectionPool) Connect(printer *Printer) error {
 	case "network":
 		conn, err = ConnectNetwork(printer.Host, printer.Port)
 	default:
-		return fmt.Errorf("unsupported printer type: %s", printer.Type)
+		return Permanent(fmt.Errorf("unsupported printer type: %s", printer.Type))
 	}
 
 	if err != nil {
 		return err
 	}
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Another caller may have connected while we were dialing
+	if _, exists := p.connections[printer.ID]; exists {
+		conn.Close()
+		return nil
+	}
+
 	p.connections[printer.ID] = conn
 	return nil
 }
 
-// Print sends an image to a printer
-func (p *ConnectionPool) Print(printerID string, img image.Image) error {
+// Print sends an image to a printer, cutting the paper at cuts
+func (p *ConnectionPool) Print(printerID string, img image.Image, opts PrintOptions) error {
 	p.mu.RLock()
 	conn, exists := p.connections[printerID]
 	p.mu.RUnlock()
@@ -85,7 +106,31 @@ func (p *ConnectionPool) Print(printerID string, img image.Image) error {
 		return fmt.Errorf("printer not connected: %s", printerID)
 	}
 
-	return conn.Print(img)
+	return conn.Print(img, opts)
+}
+
+// Write sends raw ESC/POS data to a printer
+func (p *ConnectionPool) Write(printerID string, data []byte) error {
+	p.mu.RLock()
+	conn, exists := p.connections[printerID]
+	p.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("printer not connected: %s", printerID)
+	}
+
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// get returns a printer's connection, or nil if it isn't connected
+func (p *ConnectionPool) get(printerID string) PrinterConnection {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.connections[printerID]
 }
 
 // Disconnect closes a printer connection
@@ -104,6 +149,52 @@ func (p *ConnectionPool) Disconnect(printerID string) error {
 	return err
 }
 
+// disconnectIdle closes a printer's connection if it is still conn,
+// reporting whether it was closed. The caller must hold the printer, so no
+// print job is using the connection.
+func (p *ConnectionPool) disconnectIdle(printerID string, conn PrinterConnection) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.connections[printerID] != conn {
+		return false
+	}
+
+	conn.Close()
+	delete(p.connections, printerID)
+	return true
+}
+
+// acquire holds a printer for a print job, so the status monitor neither
+// drops its connection nor reads replies meant for the job. Every acquire
+// must be paired with a release.
+func (p *ConnectionPool) acquire(printerID string) {
+	p.printerLock(printerID).Lock()
+}
+
+// tryAcquire holds a printer if nothing else does, reporting whether it did
+func (p *ConnectionPool) tryAcquire(printerID string) bool {
+	return p.printerLock(printerID).TryLock()
+}
+
+// release undoes an acquire or successful tryAcquire
+func (p *ConnectionPool) release(printerID string) {
+	p.printerLock(printerID).Unlock()
+}
+
+// printerLock returns the lock that holds a printer
+func (p *ConnectionPool) printerLock(printerID string) *sync.Mutex {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lock, ok := p.held[printerID]
+	if !ok {
+		lock = &sync.Mutex{}
+		p.held[printerID] = lock
+	}
+	return lock
+}
+
 // DisconnectAll closes all connections
 func (p *ConnectionPool) DisconnectAll() {
 	p.mu.Lock()
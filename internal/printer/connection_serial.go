@@ -3,7 +3,9 @@ package printer
 import (
 	"fmt"
 	"image"
+	"io"
 	"sync"
+	"time"
 	
 	"github.com/tarm/serial"
 )
@@ -21,8 +23,9 @@ func ConnectSerial(device string, baud int) (*SerialConnection, error) {
 	}
 	
 	config := &serial.Config{
-		Name: device,
-		Baud: baud,
+		Name:        device,
+		Baud:        baud,
+		ReadTimeout: statusTimeout, // Reads are only used for status replies
 	}
 	
 	port, err := serial.OpenPort(config)
@@ -43,12 +46,38 @@ func (c *SerialConnection) Write(data []byte) (int, error) {
 	return c.port.Write(data)
 }
 
+// Transact sends a request and reads the printer's reply
+func (c *SerialConnection) Transact(req []byte, resp []byte, timeout time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(req) > 0 {
+		if _, err := c.port.Write(req); err != nil {
+			return 0, err
+		}
+	}
+
+	// The port's read timeout is fixed when it is opened, so keep reading
+	// until something arrives or our own deadline passes
+	deadline := time.Now().Add(timeout)
+	for {
+		n, err := c.port.Read(resp)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if !time.Now().Before(deadline) {
+			return 0, ErrStatusTimeout
+		}
+	}
+}
+
 // Print prints an image to the serial printer
-func (c *SerialConnection) Print(img image.Image) error {
-	data := EncodeImageToESCPOS(img)
-	
-	_, err := c.Write(data)
-	if err != nil {
+func (c *SerialConnection) Print(img image.Image, opts PrintOptions) error {
+	// Bands go out one at a time so long receipts don't overflow the printer's buffer
+	if err := writeBands(c, EncodeImageBands(img, opts), opts); err != nil {
 		return fmt.Errorf("failed to write to serial printer: %w", err)
 	}
 	
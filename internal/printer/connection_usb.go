@@ -1,6 +1,7 @@
 package printer
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"sync"
@@ -14,6 +15,7 @@ type USBConnection struct {
 	device   *gousb.Device
 	iface    *gousb.Interface
 	endpoint *gousb.OutEndpoint
+	in       *gousb.InEndpoint // nil if the printer can't send status
 	mu       sync.Mutex
 }
 
@@ -63,6 +65,7 @@ func ConnectUSB(vid, pid uint16) (*USBConnection, error) {
 				device:   dev,
 				iface:    iface,
 				endpoint: outEndpoint,
+				in:       findInEndpoint(iface),
 			}
 			return conn, nil
 		}
@@ -104,6 +107,7 @@ func ConnectUSB(vid, pid uint16) (*USBConnection, error) {
 								device:   dev,
 								iface:    iface,
 								endpoint: outEndpoint,
+								in:       findInEndpoint(iface),
 							}
 							return conn, nil
 						}
@@ -160,6 +164,7 @@ func ConnectUSB(vid, pid uint16) (*USBConnection, error) {
 					device:   dev,
 					iface:    iface,
 					endpoint: outEndpoint,
+					in:       findInEndpoint(iface),
 				}
 				return conn, nil
 			}
@@ -190,12 +195,47 @@ func (c *USBConnection) Write(data []byte) (int, error) {
 	return c.endpoint.Write(data)
 }
 
+// Transact sends a request and reads the printer's reply
+func (c *USBConnection) Transact(req []byte, resp []byte, timeout time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.in == nil {
+		return 0, ErrStatusUnsupported
+	}
+
+	if len(req) > 0 {
+		if _, err := c.endpoint.Write(req); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	n, err := c.in.ReadContext(ctx, resp)
+	if n == 0 && ctx.Err() != nil {
+		return 0, ErrStatusTimeout
+	}
+	return n, err
+}
+
+// findInEndpoint returns the interface's IN endpoint, if it has one
+func findInEndpoint(iface *gousb.Interface) *gousb.InEndpoint {
+	for _, epDesc := range iface.Setting.Endpoints {
+		if epDesc.Direction == gousb.EndpointDirectionIn {
+			if ep, err := iface.InEndpoint(epDesc.Number); err == nil {
+				return ep
+			}
+		}
+	}
+	return nil
+}
+
 // Print prints an image to the USB printer
-func (c *USBConnection) Print(img image.Image) error {
-	data := EncodeImageToESCPOS(img)
-	
-	_, err := c.Write(data)
-	if err != nil {
+func (c *USBConnection) Print(img image.Image, opts PrintOptions) error {
+	// Bands go out one at a time so long receipts don't overflow the printer's buffer
+	if err := writeBands(c, EncodeImageBands(img, opts), opts); err != nil {
 		return fmt.Errorf("failed to write to USB printer: %w", err)
 	}
 	
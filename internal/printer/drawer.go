@@ -0,0 +1,23 @@
+package printer
+
+import (
+	"fmt"
+
+	"github.com/thereceipt/receipt-engine/internal/escpos"
+)
+
+// OpenDrawer pulses the cash drawer connected to a printer without printing
+// anything. Zero values use the defaults of pin 2, 100 ms on and 500 ms off.
+func (p *ConnectionPool) OpenDrawer(printer *Printer, pin int, onTime int, offTime int) error {
+	if err := p.Connect(printer); err != nil {
+		return fmt.Errorf("failed to connect to printer: %w", err)
+	}
+
+	if err := p.Write(printer.ID, escpos.DrawerKickCommand(pin, onTime, offTime)); err != nil {
+		// Drop the connection so the next attempt reconnects from scratch
+		p.Disconnect(printer.ID)
+		return fmt.Errorf("failed to open drawer: %w", err)
+	}
+
+	return nil
+}
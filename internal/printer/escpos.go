@@ -5,29 +5,143 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
-	
+
 	"github.com/hennedo/escpos"
+	native "github.com/thereceipt/receipt-engine/internal/escpos"
+	"github.com/thereceipt/receipt-engine/internal/renderer"
 )
 
 // EncodeImageToESCPOS converts an image to ESC/POS commands using the escpos library
-// This matches the Python escpos library approach
-func EncodeImageToESCPOS(img image.Image) []byte {
-	var buf bytes.Buffer
-	
+// This matches the Python escpos library approach. The image is split at
+// each control, so cuts and drawer kicks happen where the receipt put them,
+// and the paper is only cut where the receipt asked for it. Cuts and image
+// band heights follow the printer's profile.
+func EncodeImageToESCPOS(img image.Image, opts PrintOptions) []byte {
+	return bytes.Join(EncodeImageBands(img, opts), nil)
+}
+
+// EncodeImageBands is EncodeImageToESCPOS split into chunks that each hold at
+// most one raster band, so they can be sent one at a time without
+// overflowing the printer's buffer on long receipts
+func EncodeImageBands(img image.Image, opts PrintOptions) [][]byte {
+	// Binarise everything the same way, including anti-aliased text edges
+	img = renderer.Dither(img, renderer.DitherOptions{Method: renderer.DitherThreshold})
+
+	b := &bandEncoder{height: opts.bandHeight()}
+
+	// Create ESC/POS encoder (like Python's escpos library)
+	b.e = escpos.New(&b.buf)
+
+	// Initialize printer
+	b.e.Initialize()
+
+	bounds := img.Bounds()
+	top := bounds.Min.Y
+	cut := false
+
+	for _, control := range opts.Controls {
+		y := bounds.Min.Y + control.Y
+		if y < top {
+			y = top
+		}
+		if y > bounds.Max.Y {
+			y = bounds.Max.Y
+		}
+
+		if y > top {
+			b.printSegment(img, image.Rect(bounds.Min.X, top, bounds.Max.X, y))
+		}
+		top = y
+
+		switch control.Type {
+		case renderer.ControlCut:
+			// GS V feeds the segment past the cutter before cutting
+			b.e.WriteRaw(native.CutCommand(opts.Profile, control.Partial, control.Feed))
+			cut = true
+		case renderer.ControlDrawer:
+			b.e.WriteRaw(native.DrawerKickCommand(control.Pin, control.OnTime, control.OffTime))
+		}
+	}
+
+	// Whatever follows the last cut, unless it's only the bottom margin
+	rest := image.Rect(bounds.Min.X, top, bounds.Max.X, bounds.Max.Y)
+	if !cut || !isBlank(img, rest) {
+		b.printSegment(img, rest)
+	}
+
+	b.flush()
+
+	return b.chunks
+}
+
+// bandHeight returns how many rows to send per raster band: the configured
+// height, no taller than the profile allows, in whole multiples of 8 rows so
+// padding doesn't add blank lines between bands
+func (o PrintOptions) bandHeight() int {
+	height := o.BandHeight
+	if height <= 0 {
+		height = DefaultBandHeight
+	}
+	if limit := o.Profile.RasterHeight(); limit > 0 && limit < height {
+		height = limit
+	}
+
+	height -= height % 8
+	if height == 0 {
+		height = 8
+	}
+	return height
+}
+
+// bandEncoder collects ESC/POS output into chunks of one raster band each
+type bandEncoder struct {
+	e      *escpos.Escpos
+	buf    bytes.Buffer
+	height int // Rows per band
+	chunks [][]byte
+}
+
+// flush ends the current chunk
+func (b *bandEncoder) flush() {
+	// Flush the buffered writer
+	b.e.Print()
+
+	if b.buf.Len() > 0 {
+		b.chunks = append(b.chunks, bytes.Clone(b.buf.Bytes()))
+		b.buf.Reset()
+	}
+}
+
+// printSegment prints one horizontal segment of an image, one band per chunk
+func (b *bandEncoder) printSegment(img image.Image, rect image.Rectangle) {
+	for rect.Dy() > 0 {
+		band := rect
+		if band.Dy() > b.height {
+			band.Max.Y = band.Min.Y + b.height
+		}
+
+		printBand(b.e, img, band)
+		b.flush()
+
+		rect.Min.Y = band.Max.Y
+	}
+}
+
+// printBand prints one horizontal band of an image
+func printBand(e *escpos.Escpos, img image.Image, rect image.Rectangle) {
 	// Convert image to RGBA format with (0,0) origin (library expects this)
 	// The library's getPixels function assumes bounds start at (0,0)
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-	
+	width := rect.Dx()
+	height := rect.Dy()
+
 	// Pad dimensions to be multiples of 8 (library requirement)
 	// This prevents out-of-bounds access and garbage data
 	paddedWidth := ((width + 7) / 8) * 8
 	paddedHeight := ((height + 7) / 8) * 8
-	
+
 	// Create RGBA image with padded dimensions (white background)
 	rgbaImg := image.NewRGBA(image.Rect(0, 0, paddedWidth, paddedHeight))
-	
+
 	// Fill with white background
 	white := color.RGBA{255, 255, 255, 255}
 	for y := 0; y < paddedHeight; y++ {
@@ -35,32 +149,23 @@ func EncodeImageToESCPOS(img image.Image) []byte {
 			rgbaImg.Set(x, y, white)
 		}
 	}
-	
-	// Draw the original image on top (at 0,0)
-	draw.Draw(rgbaImg, image.Rect(0, 0, width, height), img, bounds.Min, draw.Src)
-	
-	// Create ESC/POS encoder (like Python's escpos library)
-	e := escpos.New(&buf)
-	
-	// Initialize printer
-	e.Initialize()
-	
+
+	// Draw the segment on top (at 0,0)
+	draw.Draw(rgbaImg, image.Rect(0, 0, width, height), img, rect.Min, draw.Src)
+
 	// Print image (library handles all the ESC/POS encoding)
 	e.PrintImage(rgbaImg)
-	
-	// Feed a few lines before cutting
-	e.LineFeed()
-	e.LineFeed()
-	e.LineFeed()
-	
-	// Flush the buffered writer first
-	e.Print()
-	
-	// Cut paper - library's Cut() has a bug, so write correct command manually
-	// GS V 0 = Full cut (0x1D 0x56 0x00)
-	buf.WriteByte(0x1D) // GS
-	buf.WriteByte(0x56) // V
-	buf.WriteByte(0x00) // 0 = Full cut
-	
-	return buf.Bytes()
+}
+
+// isBlank reports whether a region of an image has nothing to print
+func isBlank(img image.Image, rect image.Rectangle) bool {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if (299*r+587*g+114*b)/1000 < 0x8000 {
+				return false
+			}
+		}
+	}
+	return true
 }
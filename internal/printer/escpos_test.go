@@ -0,0 +1,86 @@
+package printer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/thereceipt/receipt-engine/internal/profile"
+	"github.com/thereceipt/receipt-engine/internal/renderer"
+)
+
+func TestEncodeImageToESCPOS_Controls(t *testing.T) {
+	// Two printed bands with a cut between them, then a blank bottom margin
+	img := image.NewRGBA(image.Rect(0, 0, 16, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 16, 10), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 40, 16, 50), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	rasterCmd := []byte{0x1D, 0x76, 0x30, 0x00}
+	cutCmd := []byte{0x1D, 0x56}
+
+	data := EncodeImageToESCPOS(img, PrintOptions{})
+	if n := bytes.Count(data, rasterCmd); n != 1 {
+		t.Errorf("Expected 1 image without cuts, got %d", n)
+	}
+	if bytes.Contains(data, cutCmd) {
+		t.Error("Expected no cut when the receipt has none")
+	}
+
+	data = EncodeImageToESCPOS(img, PrintOptions{Controls: []renderer.Control{
+		{Type: renderer.ControlDrawer, Y: 0},
+		{Type: renderer.ControlCut, Y: 30, Partial: true},
+		{Type: renderer.ControlCut, Y: 60},
+	}})
+	if n := bytes.Count(data, rasterCmd); n != 2 {
+		t.Errorf("Expected 2 segments, got %d", n)
+	}
+
+	kick := bytes.Index(data, []byte{0x1B, 0x70, 0, 50, 250})
+	if kick < 0 || kick > bytes.Index(data, rasterCmd) {
+		t.Error("Expected the drawer kick before anything prints")
+	}
+
+	partial := bytes.Index(data, []byte{0x1D, 0x56, 66, 0})
+	full := bytes.Index(data, []byte{0x1D, 0x56, 65, 0})
+	if partial < 0 || full < 0 || partial > full {
+		t.Fatalf("Expected a partial then a full cut in %x", data)
+	}
+	if !bytes.HasSuffix(data, []byte{0x1D, 0x56, 65, 0}) {
+		t.Error("Expected nothing after the last cut but the blank margin")
+	}
+}
+
+func TestEncodeImageToESCPOS_Profile(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 40))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	// No partial cutter and a small raster buffer
+	prof := &profile.Profile{FullCut: true, MaxRasterHeight: 16}
+	data := EncodeImageToESCPOS(img, PrintOptions{
+		Controls: []renderer.Control{{Type: renderer.ControlCut, Y: 40, Partial: true}},
+		Profile:  prof,
+	})
+
+	if n := bytes.Count(data, []byte{0x1D, 0x76, 0x30, 0x00}); n != 3 {
+		t.Errorf("Expected 40 rows in 3 bands of at most 16, got %d", n)
+	}
+	if !bytes.HasSuffix(data, []byte{0x1D, 0x56, 65, 0}) {
+		t.Error("Expected a full cut on a printer that can't cut partially")
+	}
+
+	// No cutter at all
+	prof = &profile.Profile{}
+	data = EncodeImageToESCPOS(img, PrintOptions{
+		Controls: []renderer.Control{{Type: renderer.ControlCut, Y: 40}},
+		Profile:  prof,
+	})
+	if bytes.Contains(data, []byte{0x1D, 0x56}) {
+		t.Error("Expected no cut on a printer without a cutter")
+	}
+	if !bytes.HasSuffix(data, []byte{0x1B, 0x64, 4}) {
+		t.Errorf("Expected a feed to the tear bar, got %x", data[len(data)-3:])
+	}
+}
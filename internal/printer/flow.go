@@ -0,0 +1,140 @@
+package printer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Flow control modes control how long a printer is given between raster bands
+const (
+	// FlowNone writes bands back to back and relies on the connection to block
+	FlowNone = "none"
+	// FlowStatus waits for DLE EOT to report the printer ready before each band
+	FlowStatus = "status"
+	// FlowXonXoff waits for an XON after the printer sends XOFF (serial printers
+	// with software flow control)
+	FlowXonXoff = "xonxoff"
+)
+
+// DefaultBandHeight is how many rows of a raster image are sent in one band
+const DefaultBandHeight = 256
+
+// XON/XOFF software flow control bytes
+const (
+	xon  = 0x11
+	xoff = 0x13
+)
+
+// flowTimeout bounds how long a printer may stay busy between bands
+const flowTimeout = 30 * time.Second
+
+// flowPollInterval is how often a busy printer is asked again
+const flowPollInterval = 100 * time.Millisecond
+
+// ValidFlowControl reports whether mode is a known flow control mode
+func ValidFlowControl(mode string) bool {
+	switch mode {
+	case FlowNone, FlowStatus, FlowXonXoff:
+		return true
+	}
+	return false
+}
+
+// writeBands sends chunks from EncodeImageBands one at a time, waiting for
+// the printer between them and reporting progress after each
+func writeBands(conn PrinterConnection, chunks [][]byte, opts PrintOptions) error {
+	for i, chunk := range chunks {
+		if i > 0 {
+			if err := waitForPrinter(conn, opts.FlowControl); err != nil {
+				return fmt.Errorf("band %d of %d: %w", i+1, len(chunks), err)
+			}
+		}
+
+		if _, err := conn.Write(chunk); err != nil {
+			return err
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(chunks))
+		}
+	}
+
+	return nil
+}
+
+// waitForPrinter blocks until the printer is ready for more data. Connections
+// that can't read replies are never waited for.
+func waitForPrinter(conn PrinterConnection, mode string) error {
+	sc, ok := conn.(StatusConnection)
+	if !ok {
+		return nil
+	}
+
+	switch mode {
+	case FlowStatus:
+		return waitForReady(sc, flowTimeout)
+	case FlowXonXoff:
+		return waitForXon(sc, flowTimeout)
+	}
+	return nil
+}
+
+// waitForReady polls DLE EOT until the printer reports it can print. A
+// printer too busy to answer is asked again.
+func waitForReady(conn StatusConnection, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	problem := "no response"
+
+	for {
+		status, err := QueryStatus(conn)
+		if err == nil && status.Ready() {
+			return nil
+		}
+		if err != nil && err != ErrStatusTimeout {
+			return fmt.Errorf("failed to read printer status: %w", err)
+		}
+		if err == nil {
+			problem = status.Problem()
+		}
+
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("printer not ready after %s: %s", timeout, problem)
+		}
+		time.Sleep(flowPollInterval)
+	}
+}
+
+// waitForXon reads what the printer has sent since the last band. If the
+// last flow control byte was XOFF, it keeps reading until XON arrives.
+func waitForXon(conn StatusConnection, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 64)
+	paused := false
+
+	for {
+		wait := flowPollInterval
+		if paused {
+			wait = time.Until(deadline)
+		}
+
+		n, err := conn.Transact(nil, buf, wait)
+		if err != nil && err != ErrStatusTimeout {
+			return fmt.Errorf("failed to read flow control: %w", err)
+		}
+		for _, b := range buf[:n] {
+			switch b {
+			case xoff:
+				paused = true
+			case xon:
+				paused = false
+			}
+		}
+
+		if !paused && (n == 0 || err == ErrStatusTimeout) {
+			return nil // Nothing more pending
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("printer sent XOFF and no XON within %s", timeout)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package printer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readyReplies are DLE EOT replies from an online printer with no problems
+var readyReplies = map[byte][]byte{1: {0x12}, 2: {0x12}, 3: {0x12}, 4: {0x12}}
+
+func TestEncodeImageBands(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	chunks := EncodeImageBands(img, PrintOptions{BandHeight: 30})
+
+	// 30 rounds down to 24 rows: 24 + 24 + 24 + 24 + 4
+	if len(chunks) != 5 {
+		t.Fatalf("Expected 5 chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := bytes.Count(chunk, []byte{0x1D, 0x76, 0x30, 0x00}); n != 1 {
+			t.Errorf("Expected one band in chunk %d, got %d", i, n)
+		}
+	}
+	if !bytes.HasPrefix(chunks[0], []byte{0x1B, 0x40}) {
+		t.Error("Expected the first chunk to initialize the printer")
+	}
+
+	if !bytes.Equal(bytes.Join(chunks, nil), EncodeImageToESCPOS(img, PrintOptions{BandHeight: 30})) {
+		t.Error("Expected the chunks to add up to the whole stream")
+	}
+}
+
+func TestWriteBands_Progress(t *testing.T) {
+	conn := &fakeStatusConnection{replies: readyReplies}
+	chunks := [][]byte{[]byte("one"), []byte("two"), []byte("three")}
+
+	var progress []int
+	err := writeBands(conn, chunks, PrintOptions{
+		FlowControl: FlowStatus,
+		Progress: func(sent, total int) {
+			if total != 3 {
+				t.Errorf("Expected 3 bands in total, got %d", total)
+			}
+			progress = append(progress, sent)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to write bands: %v", err)
+	}
+
+	if string(conn.written) != "onetwothree" {
+		t.Errorf("Expected all bands written in order, got %q", conn.written)
+	}
+	if len(progress) != 3 || progress[2] != 3 {
+		t.Errorf("Expected progress after each band, got %v", progress)
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	conn := &fakeStatusConnection{replies: readyReplies}
+	if err := waitForReady(conn, time.Second); err != nil {
+		t.Errorf("Expected a ready printer not to be waited for: %v", err)
+	}
+
+	// Paper out never clears
+	conn.setReplies(map[byte][]byte{1: {0x12}, 2: {0x32}, 3: {0x12}, 4: {0x72}})
+	err := waitForReady(conn, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "paper out") {
+		t.Errorf("Expected a paper out error, got %v", err)
+	}
+}
+
+func TestWaitForXon(t *testing.T) {
+	conn := &fakeStatusConnection{pending: []byte{xoff, 0x10, 0x00, xon}}
+	if err := waitForXon(conn, time.Second); err != nil {
+		t.Errorf("Expected XON to resume: %v", err)
+	}
+
+	conn = &fakeStatusConnection{pending: []byte{xoff}}
+	if err := waitForXon(conn, 200*time.Millisecond); err == nil {
+		t.Error("Expected an error when XON never arrives")
+	}
+
+	conn = &fakeStatusConnection{}
+	if err := waitForXon(conn, time.Second); err != nil {
+		t.Errorf("Expected no wait without XOFF: %v", err)
+	}
+}
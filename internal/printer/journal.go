@@ -0,0 +1,394 @@
+package printer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/thereceipt/receipt-engine/internal/renderer"
+)
+
+// Journal record operations
+const (
+	journalOpPut    = "put"
+	journalOpDelete = "delete"
+)
+
+// journalRecord is a single line in the queue journal
+type journalRecord struct {
+	Op  string      `json:"op"`
+	ID  string      `json:"id,omitempty"`
+	Job *journalJob `json:"job,omitempty"`
+}
+
+// journalJob is the on-disk form of a PrintJob
+type journalJob struct {
+	ID             string             `json:"id"`
+	PrinterID      string             `json:"printer_id"`
+	Status         string             `json:"status"`
+	Retries        int                `json:"retries"`
+	Priority       int                `json:"priority,omitempty"`
+	IdempotencyKey string             `json:"idempotency_key,omitempty"`
+	Error          string             `json:"error,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	CompletedAt    time.Time          `json:"completed_at,omitempty"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at,omitempty"`
+	Payload        []byte             `json:"payload,omitempty"` // PNG-encoded image
+	Controls       []renderer.Control `json:"controls,omitempty"`
+	Data           []byte             `json:"data,omitempty"` // Native ESC/POS commands
+}
+
+// journal is an append-only write-ahead log of print job state changes.
+// Every change is appended as a JSON line and synced to disk before the
+// queue acknowledges it, so jobs survive a crash or power loss.
+type journal struct {
+	path    string
+	file    *os.File // Nil after a failed compaction until the next append reopens it
+	records int      // Records appended since the last compaction
+	tail    [][]byte // Records appended while a compaction runs, nil otherwise
+	closed  bool
+	mu      sync.Mutex
+}
+
+// openJournal opens (or creates) the journal at path and replays it,
+// returning the recovered jobs in their original order
+func openJournal(path string) (*journal, []*PrintJob, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, fmt.Errorf("failed to create journal directory: %w", err)
+		}
+	}
+
+	jobs, err := replayJournal(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	j := &journal{path: path}
+
+	// Rewrite the journal so it only holds the live jobs
+	j.startCompaction()
+	if err := j.compact(jobs); err != nil {
+		return nil, nil, err
+	}
+
+	return j, jobs, nil
+}
+
+// replayJournal reads the journal and rebuilds the last known state of every job
+func replayJournal(path string) ([]*PrintJob, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*PrintJob{}, nil
+		}
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	state := make(map[string]*journalJob)
+	order := make([]string, 0)
+
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+
+		if len(line) > 0 {
+			var rec journalRecord
+			// A torn final write or a corrupt line is skipped rather than
+			// failing recovery for every other job
+			if err := json.Unmarshal(line, &rec); err == nil {
+				switch rec.Op {
+				case journalOpPut:
+					if rec.Job == nil {
+						break
+					}
+					prev, exists := state[rec.Job.ID]
+					if !exists {
+						order = append(order, rec.Job.ID)
+					} else if len(rec.Job.Payload) == 0 && len(rec.Job.Data) == 0 {
+						// Status updates don't repeat the payload
+						rec.Job.Payload = prev.Payload
+						rec.Job.Controls = prev.Controls
+						rec.Job.Data = prev.Data
+					}
+					state[rec.Job.ID] = rec.Job
+				case journalOpDelete:
+					delete(state, rec.ID)
+				}
+			}
+		}
+
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read journal: %w", readErr)
+		}
+	}
+
+	jobs := make([]*PrintJob, 0, len(state))
+	for _, id := range order {
+		entry, exists := state[id]
+		if !exists {
+			continue
+		}
+
+		job, err := entry.toJob()
+		if err != nil {
+			// Payload can't be decoded - keep the job visible as dead
+			job = &PrintJob{
+				ID:        entry.ID,
+				PrinterID: entry.PrinterID,
+				Status:    "dead",
+				Retries:   entry.Retries,
+				Error:     fmt.Errorf("failed to recover job: %w", err),
+				CreatedAt: entry.CreatedAt,
+			}
+		}
+
+		// A job that was mid-print when we went down may or may not have
+		// reached the printer. Printing it again could duplicate the
+		// receipt, so park it for an operator to check and requeue.
+		if job.Status == "printing" {
+			job.Status = "dead"
+			job.Error = errors.New("interrupted while printing; it may have printed, requeue it to print again")
+			job.NextAttemptAt = time.Time{}
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// put appends the current state of a job. The payload is only written when
+// withPayload is set, since it never changes after the job is enqueued.
+func (j *journal) put(job *PrintJob, withPayload bool) error {
+	entry, err := newJournalJob(job, withPayload)
+	if err != nil {
+		return err
+	}
+
+	return j.append(journalRecord{Op: journalOpPut, Job: entry})
+}
+
+// delete appends a removal record for a job
+func (j *journal) delete(jobID string) error {
+	return j.append(journalRecord{Op: journalOpDelete, ID: jobID})
+}
+
+func (j *journal) append(rec journalRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal record: %w", err)
+	}
+	data = append(data, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return errors.New("journal is closed")
+	}
+	if j.file == nil {
+		file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to reopen journal: %w", err)
+		}
+		j.file = file
+	}
+
+	if _, err := j.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+
+	j.records++
+	if j.tail != nil {
+		j.tail = append(j.tail, data)
+	}
+
+	return nil
+}
+
+// needsCompaction reports whether the journal has grown well beyond the live job count
+func (j *journal) needsCompaction(liveJobs int) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.tail == nil && j.records > 4*liveJobs+256
+}
+
+// startCompaction marks the point a compaction's snapshot of the jobs is
+// taken; records appended after it are carried over into the new journal.
+// It reports false if a compaction is already running.
+func (j *journal) startCompaction() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.tail != nil {
+		return false
+	}
+	j.tail = [][]byte{}
+	return true
+}
+
+// compact atomically replaces the journal with one record per job, as of
+// startCompaction, followed by the records appended since. The jobs are
+// encoded without holding the journal, so appends carry on meanwhile. If the
+// new journal can't be put in place, the old one is kept.
+func (j *journal) compact(jobs []*PrintJob) error {
+	defer func() {
+		j.mu.Lock()
+		j.tail = nil
+		j.mu.Unlock()
+	}()
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, job := range jobs {
+		entry, err := newJournalJob(job, true)
+		if err != nil {
+			return fail(err)
+		}
+
+		data, err := json.Marshal(journalRecord{Op: journalOpPut, Job: entry})
+		if err != nil {
+			return fail(fmt.Errorf("failed to encode journal record: %w", err))
+		}
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, data := range j.tail {
+		writer.Write(data)
+	}
+	if err := writer.Flush(); err != nil {
+		return fail(fmt.Errorf("failed to write journal: %w", err))
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(fmt.Errorf("failed to sync journal: %w", err))
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+
+	// The old file is no longer the journal, whether or not the new one opens
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen journal: %w", err)
+	}
+
+	j.file = file
+	j.records = len(jobs) + len(j.tail)
+
+	return nil
+}
+
+// close closes the journal file
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.closed = true
+	if j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	j.file = nil
+
+	return err
+}
+
+func newJournalJob(job *PrintJob, withPayload bool) (*journalJob, error) {
+	entry := &journalJob{
+		ID:             job.ID,
+		PrinterID:      job.PrinterID,
+		Status:         job.Status,
+		Retries:        job.Retries,
+		Priority:       job.Priority,
+		IdempotencyKey: job.IdempotencyKey,
+		CreatedAt:      job.CreatedAt,
+		CompletedAt:    job.CompletedAt,
+		NextAttemptAt:  job.NextAttemptAt,
+	}
+	if job.Error != nil {
+		entry.Error = job.Error.Error()
+	}
+
+	if withPayload && job.Image != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, job.Image); err != nil {
+			return nil, fmt.Errorf("failed to encode job image: %w", err)
+		}
+		entry.Payload = buf.Bytes()
+	}
+	if withPayload {
+		entry.Controls = job.Controls
+		entry.Data = job.Data
+	}
+
+	return entry, nil
+}
+
+func (e *journalJob) toJob() (*PrintJob, error) {
+	job := &PrintJob{
+		ID:             e.ID,
+		PrinterID:      e.PrinterID,
+		Status:         e.Status,
+		Retries:        e.Retries,
+		Priority:       e.Priority,
+		IdempotencyKey: e.IdempotencyKey,
+		CreatedAt:      e.CreatedAt,
+		CompletedAt:    e.CompletedAt,
+		NextAttemptAt:  e.NextAttemptAt,
+		Controls:       e.Controls,
+		Data:           e.Data,
+	}
+	if e.Error != "" {
+		job.Error = errors.New(e.Error)
+	}
+
+	if len(e.Payload) > 0 {
+		img, err := png.Decode(bytes.NewReader(e.Payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode job image: %w", err)
+		}
+		job.Image = img
+	}
+
+	return job, nil
+}
@@ -0,0 +1,183 @@
+package printer
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal_RecoversJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.journal")
+
+	j, jobs, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("Expected empty journal, got %d jobs", len(jobs))
+	}
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	queued := &PrintJob{ID: "job_1", PrinterID: "p1", Image: img, Status: "queued", CreatedAt: time.Now()}
+	printing := &PrintJob{ID: "job_2", PrinterID: "p1", Image: img, Status: "queued", CreatedAt: time.Now()}
+	removed := &PrintJob{ID: "job_3", PrinterID: "p2", Image: img, Status: "queued", CreatedAt: time.Now()}
+
+	for _, job := range []*PrintJob{queued, printing, removed} {
+		if err := j.put(job, true); err != nil {
+			t.Fatalf("Failed to journal job: %v", err)
+		}
+	}
+
+	printing.Status = "printing"
+	j.put(printing, false)
+	j.delete(removed.ID)
+	j.close()
+
+	_, recovered, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal: %v", err)
+	}
+
+	if len(recovered) != 2 {
+		t.Fatalf("Expected 2 recovered jobs, got %d", len(recovered))
+	}
+
+	if recovered[0].ID != "job_1" || recovered[1].ID != "job_2" {
+		t.Errorf("Jobs recovered out of order: %s, %s", recovered[0].ID, recovered[1].ID)
+	}
+
+	// Interrupted jobs may have printed, so they aren't resumed
+	if recovered[1].Status != "dead" || recovered[1].Error == nil {
+		t.Errorf("Expected interrupted job to be dead with an error, got %s", recovered[1].Status)
+	}
+
+	for _, job := range recovered {
+		if job.Image == nil || job.Image.Bounds().Dx() != 8 {
+			t.Errorf("Job %s payload not recovered", job.ID)
+		}
+	}
+}
+
+func TestJournal_IgnoresTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.journal")
+
+	j, _, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	j.put(&PrintJob{ID: "job_1", PrinterID: "p1", Status: "queued", CreatedAt: time.Now()}, true)
+	j.close()
+
+	// Simulate a crash in the middle of appending a record
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open journal file: %v", err)
+	}
+	f.WriteString(`{"op":"put","job":{"id":"job_2","stat`)
+	f.Close()
+
+	_, recovered, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal: %v", err)
+	}
+
+	if len(recovered) != 1 || recovered[0].ID != "job_1" {
+		t.Errorf("Expected only job_1 to be recovered, got %d jobs", len(recovered))
+	}
+}
+
+func TestJournal_RecoversNativeData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.journal")
+
+	j, _, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	job := &PrintJob{ID: "job_1", PrinterID: "p1", Data: []byte{0x1B, 0x40, 'h', 'i'}, Status: "queued", CreatedAt: time.Now()}
+	j.put(job, true)
+
+	// Status updates don't repeat the data
+	job.Retries = 1
+	j.put(job, false)
+	j.close()
+
+	_, recovered, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal: %v", err)
+	}
+
+	if len(recovered) != 1 {
+		t.Fatalf("Expected 1 recovered job, got %d", len(recovered))
+	}
+	if string(recovered[0].Data) != string(job.Data) || recovered[0].Image != nil {
+		t.Errorf("Expected ESC/POS data to be recovered, got %q", recovered[0].Data)
+	}
+	if recovered[0].Retries != 1 {
+		t.Errorf("Expected latest state to be recovered, got %d retries", recovered[0].Retries)
+	}
+}
+
+func TestJournal_CompactKeepsConcurrentAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.journal")
+	j, _, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	job := &PrintJob{ID: "job_1", PrinterID: "p1", Image: img, Status: "queued", CreatedAt: time.Now()}
+	j.put(job, true)
+
+	// The snapshot is taken, then the job completes before the rewrite
+	if !j.startCompaction() {
+		t.Fatal("Expected compaction to start")
+	}
+	if j.startCompaction() {
+		t.Error("Expected only one compaction at a time")
+	}
+	snapshot := *job
+	job.Status = "completed"
+	j.put(job, false)
+
+	if err := j.compact([]*PrintJob{&snapshot}); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	j.close()
+
+	_, recovered, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen journal: %v", err)
+	}
+	if len(recovered) != 1 || recovered[0].Status != "completed" || recovered[0].Image == nil {
+		t.Errorf("Expected the completed job with its payload, got %+v", recovered)
+	}
+}
+
+func TestJournal_CompactFailureKeepsJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.journal")
+	j, _, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	defer j.close()
+
+	// A directory in the way of the temporary file fails the rewrite
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatalf("Failed to block compaction: %v", err)
+	}
+	j.startCompaction()
+	if err := j.compact(nil); err == nil {
+		t.Error("Expected the compaction error to be returned")
+	}
+
+	job := &PrintJob{ID: "job_1", PrinterID: "p1", Data: []byte("hi"), Status: "queued", CreatedAt: time.Now()}
+	if err := j.put(job, true); err != nil {
+		t.Errorf("Expected the journal to keep working, got %v", err)
+	}
+	if jobs, err := replayJournal(path); err != nil || len(jobs) != 1 {
+		t.Errorf("Expected the job in the old journal, got %d (%v)", len(jobs), err)
+	}
+}
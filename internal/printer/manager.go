@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/google/gousb"
+	"github.com/thereceipt/receipt-engine/internal/profile"
 	"github.com/thereceipt/receipt-engine/internal/registry"
 )
 
@@ -25,10 +26,12 @@ type Manager struct {
 	mu                 sync.RWMutex
 	networkScanStarted bool
 	networkScanMu      sync.Mutex
+	statuses           map[string]PrinterStatus
 
 	// Event callbacks
 	onPrinterAdded   func(*Printer)
 	onPrinterRemoved func(string)
+	onPrinterStatus  func(string, PrinterStatus)
 }
 
 // Printer represents a detected printer
@@ -54,6 +57,7 @@ func NewManager(registryPath string) (*Manager, error) {
 	return &Manager{
 		registry:           reg,
 		printers:           make(map[string]*Printer),
+		statuses:           make(map[string]PrinterStatus),
 		networkScanStarted: false,
 	}, nil
 }
@@ -169,6 +173,65 @@ func (m *Manager) AddNetworkPrinter(host string, port int, description string) s
 	return id
 }
 
+// GetCompletionMode returns how print completion is confirmed for a printer
+func (m *Manager) GetCompletionMode(id string) string {
+	if entry := m.registry.GetPrinterInfo(id); entry != nil && entry.CompletionMode != "" {
+		return entry.CompletionMode
+	}
+	return CompletionFireAndForget
+}
+
+// SetCompletionMode sets how print completion is confirmed for a printer
+func (m *Manager) SetCompletionMode(id string, mode string) bool {
+	return m.registry.SetCompletionMode(id, mode)
+}
+
+// GetOutputMode returns whether receipts are sent to a printer as an image
+// or as native ESC/POS
+func (m *Manager) GetOutputMode(id string) string {
+	if entry := m.registry.GetPrinterInfo(id); entry != nil && entry.Output != "" {
+		return entry.Output
+	}
+	return OutputRaster
+}
+
+// SetOutputMode sets whether receipts are sent to a printer as an image or as native ESC/POS
+func (m *Manager) SetOutputMode(id string, mode string) bool {
+	return m.registry.SetOutput(id, mode)
+}
+
+// GetProfile returns the capability profile for a printer: the one set for
+// it, or else one matching its USB IDs or model name. It returns nil if the
+// printer is unknown, which means generic ESC/POS at the full paper width.
+func (m *Manager) GetProfile(id string) *profile.Profile {
+	entry := m.registry.GetPrinterInfo(id)
+	if entry == nil {
+		return nil
+	}
+	if entry.Profile != "" {
+		return profile.Find(entry.Profile)
+	}
+	return profile.Match(entry.VID, entry.PID, entry.Description)
+}
+
+// SetProfile sets the capability profile for a printer, empty to detect it
+func (m *Manager) SetProfile(id string, name string) bool {
+	return m.registry.SetProfile(id, name)
+}
+
+// GetFlowControl returns how a printer is waited for between raster bands
+func (m *Manager) GetFlowControl(id string) string {
+	if entry := m.registry.GetPrinterInfo(id); entry != nil && entry.FlowControl != "" {
+		return entry.FlowControl
+	}
+	return FlowNone
+}
+
+// SetFlowControl sets how a printer is waited for between raster bands
+func (m *Manager) SetFlowControl(id string, mode string) bool {
+	return m.registry.SetFlowControl(id, mode)
+}
+
 // OnPrinterAdded sets a callback for when a printer is added
 func (m *Manager) OnPrinterAdded(callback func(*Printer)) {
 	m.onPrinterAdded = callback
@@ -179,6 +242,36 @@ func (m *Manager) OnPrinterRemoved(callback func(string)) {
 	m.onPrinterRemoved = callback
 }
 
+// OnPrinterStatusChanged sets a callback for when a printer reports a new status
+func (m *Manager) OnPrinterStatusChanged(callback func(string, PrinterStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onPrinterStatus = callback
+}
+
+// GetPrinterStatus returns the last status read from a printer
+func (m *Manager) GetPrinterStatus(id string) (PrinterStatus, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, exists := m.statuses[id]
+	return status, exists
+}
+
+// setPrinterStatus records a printer's status, notifying the callback if it changed
+func (m *Manager) setPrinterStatus(id string, status PrinterStatus) {
+	m.mu.Lock()
+	previous, known := m.statuses[id]
+	m.statuses[id] = status
+	callback := m.onPrinterStatus
+	m.mu.Unlock()
+
+	if callback != nil && (!known || !previous.sameAs(status)) {
+		callback(id, status)
+	}
+}
+
 // detectUSB detects USB printers using libusb
 // Gracefully returns empty list if libusb is not available (no error)
 func (m *Manager) detectUSB() ([]*Printer, error) {
@@ -0,0 +1,67 @@
+package printer
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/thereceipt/receipt-engine/internal/profile"
+	"github.com/thereceipt/receipt-engine/internal/renderer"
+)
+
+// Output modes control how a receipt is sent to the printer
+const (
+	// OutputRaster renders the whole receipt as one image
+	OutputRaster = "raster"
+	// OutputNative sends ESC/POS text, barcode and QR commands and only
+	// rasterises images and custom fonts. Much less data, crisper text.
+	OutputNative = "native"
+)
+
+// ValidOutputMode reports whether mode is a known output mode
+func ValidOutputMode(mode string) bool {
+	return mode == OutputRaster || mode == OutputNative
+}
+
+// ReceiptRenderer produces a receipt either as an image or as native ESC/POS
+type ReceiptRenderer interface {
+	Execute() (image.Image, error)
+	Controls() []renderer.Control // Cuts and drawer kicks in the image from Execute
+	ExecuteESCPOS() ([]byte, error)
+	Output() string // Mode the receipt asks for, empty to use the printer's
+	SetProfile(p *profile.Profile)
+}
+
+// Payload is what a print job sends: an image, or ready-made ESC/POS data
+type Payload struct {
+	Image    image.Image
+	Controls []renderer.Control
+	Data     []byte
+}
+
+// RenderReceipt renders a receipt for a printer's profile in its output mode,
+// unless the receipt asks for a specific one
+func RenderReceipt(r ReceiptRenderer, printerMode string, prof *profile.Profile) (Payload, error) {
+	r.SetProfile(prof)
+
+	mode := printerMode
+	if r.Output() != "" {
+		mode = r.Output()
+	}
+
+	if mode == OutputNative {
+		data, err := r.ExecuteESCPOS()
+		if err != nil {
+			return Payload{}, err
+		}
+		return Payload{Data: data}, nil
+	}
+
+	img, err := r.Execute()
+	if err != nil {
+		return Payload{}, err
+	}
+	if img == nil {
+		return Payload{}, fmt.Errorf("rendered image is nil")
+	}
+	return Payload{Image: img, Controls: r.Controls()}, nil
+}
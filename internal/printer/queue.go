@@ -2,107 +2,333 @@ package printer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"image"
+	"log"
 	"sync"
 	"time"
+
+	"github.com/thereceipt/receipt-engine/internal/profile"
+	"github.com/thereceipt/receipt-engine/internal/renderer"
+)
+
+// Errors returned by job management
+var (
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobNotDead        = errors.New("job is not in the dead-letter state")
+	ErrJobNotCancellable = errors.New("job can no longer be cancelled")
+	ErrJobNotQueued      = errors.New("job is not queued")
 )
 
 // PrintJob represents a print job
 type PrintJob struct {
-	ID        string
-	PrinterID string
-	Image     image.Image
-	Retries   int
-	Status    string // queued, printing, failed, completed
-	Error     error
-	CreatedAt time.Time
+	ID             string
+	PrinterID      string
+	Image          image.Image
+	Controls       []renderer.Control // Cuts and drawer kicks within Image
+	Data           []byte             // Native ESC/POS commands, sent instead of Image
+	Retries        int
+	Priority       int    // Higher runs first; FIFO within the same priority
+	IdempotencyKey string // Client-supplied key that deduplicates retried submissions
+	Status         string // queued, printing, completed, dead, cancelled
+	BandsSent      int    // Raster bands written so far in the current attempt
+	BandsTotal     int    // Raster bands in the image, 0 until printing starts
+	Error          error
+	CreatedAt      time.Time
+	CompletedAt    time.Time
+	NextAttemptAt  time.Time // Earliest time a retry may run
+}
+
+// DefaultIdempotencyWindow is how long an idempotency key is remembered
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// QueueOptions configures a PrintQueue
+type QueueOptions struct {
+	MaxRetries        int
+	RetryBaseDelay    time.Duration // Backoff before the first retry; doubles each attempt
+	RetryMaxDelay     time.Duration // Upper bound for the backoff
+	JournalPath       string        // On-disk journal; empty keeps jobs in memory only
+	Retention         time.Duration // How long completed jobs are kept; 0 keeps them until cleared
+	IdempotencyWindow time.Duration // How long an idempotency key maps to its job; 0 uses the default
+	BandHeight        int           // Rows per raster band; 0 uses DefaultBandHeight
+	Paused            []string      // Printers that start paused, before any recovered jobs are dispatched
+}
+
+// JobOptions are per-job settings passed to Enqueue
+type JobOptions struct {
+	Priority       int
+	IdempotencyKey string // Resubmitting with the same key returns the original job
+}
+
+// idempotencyEntry remembers which job an idempotency key created
+type idempotencyEntry struct {
+	jobID     string
+	createdAt time.Time
 }
 
-// PrintQueue manages print jobs with retry logic
+// PrintQueue manages print jobs with retry logic. Each printer gets its own
+// dispatcher so a slow or hung printer never holds up the others.
 type PrintQueue struct {
-	jobs       []*PrintJob
-	mu         sync.Mutex
-	pool       *ConnectionPool
-	manager    *Manager
-	maxRetries int
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
-}
-
-// NewPrintQueue creates a new print queue
-func NewPrintQueue(pool *ConnectionPool, manager *Manager, maxRetries int) *PrintQueue {
+	jobs        []*PrintJob
+	dispatchers map[string]*dispatcher
+	paused      map[string]bool
+	keys        map[string]idempotencyEntry
+	mu          sync.Mutex
+	pool        *ConnectionPool
+	manager     *Manager
+	maxRetries  int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	retention   time.Duration
+	keyWindow   time.Duration
+	bandHeight  int
+	journal     *journal
+	onProgress  func(jobID string, sent, total int)
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewPrintQueue creates a new print queue. If a journal path is configured,
+// jobs left over from a previous run are recovered and resumed.
+func NewPrintQueue(pool *ConnectionPool, manager *Manager, opts QueueOptions) (*PrintQueue, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	q := &PrintQueue{
-		jobs:       make([]*PrintJob, 0),
-		pool:       pool,
-		manager:    manager,
-		maxRetries: maxRetries,
-		ctx:        ctx,
-		cancel:     cancel,
+		jobs:        make([]*PrintJob, 0),
+		dispatchers: make(map[string]*dispatcher),
+		paused:      make(map[string]bool),
+		keys:        make(map[string]idempotencyEntry),
+		pool:        pool,
+		manager:     manager,
+		maxRetries:  opts.MaxRetries,
+		baseDelay:   opts.RetryBaseDelay,
+		maxDelay:    opts.RetryMaxDelay,
+		retention:   opts.Retention,
+		keyWindow:   opts.IdempotencyWindow,
+		bandHeight:  opts.BandHeight,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	for _, printerID := range opts.Paused {
+		q.paused[printerID] = true
+	}
+
+	if q.keyWindow <= 0 {
+		q.keyWindow = DefaultIdempotencyWindow
+	}
+	if q.baseDelay <= 0 {
+		q.baseDelay = DefaultRetryBaseDelay
 	}
+	if q.maxDelay < q.baseDelay {
+		q.maxDelay = DefaultRetryMaxDelay
+		if q.maxDelay < q.baseDelay {
+			q.maxDelay = q.baseDelay
+		}
+	}
+
+	if opts.JournalPath != "" {
+		j, jobs, err := openJournal(opts.JournalPath)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to open print queue journal: %w", err)
+		}
+		q.journal = j
+		q.jobs = jobs
+	}
+
+	// Start dispatchers for any recovered jobs, and remember their keys so
+	// a client retrying across a restart still gets the original job
+	q.mu.Lock()
+	for _, job := range q.jobs {
+		if job.Status == "queued" {
+			q.wake(job.PrinterID)
+		}
+		if job.IdempotencyKey != "" {
+			q.keys[job.IdempotencyKey] = idempotencyEntry{jobID: job.ID, createdAt: job.CreatedAt}
+		}
+	}
+	q.mu.Unlock()
 
-	// Start worker
+	// Start retention and idempotency key cleanup
 	q.wg.Add(1)
-	go q.worker()
+	go q.janitor()
 
-	return q
+	return q, nil
 }
 
-// Enqueue adds a print job to the queue
-func (q *PrintQueue) Enqueue(printerID string, img image.Image) string {
+// Enqueue adds a print job to the queue. The job is journaled before it is
+// accepted, so an error means the job was not queued. If the idempotency key
+// was used within the idempotency window, the original job ID is returned
+// and nothing new is queued.
+func (q *PrintQueue) Enqueue(printerID string, img image.Image, opts JobOptions) (string, error) {
+	return q.EnqueuePayload(printerID, Payload{Image: img}, opts)
+}
+
+// EnqueuePayload adds a print job for an image or native ESC/POS data, as
+// returned by RenderReceipt. It behaves like Enqueue otherwise.
+func (q *PrintQueue) EnqueuePayload(printerID string, payload Payload, opts JobOptions) (string, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	if jobID, ok := q.lookupKey(opts.IdempotencyKey); ok {
+		return jobID, nil
+	}
+
 	job := &PrintJob{
-		ID:        fmt.Sprintf("job_%d", time.Now().UnixNano()),
-		PrinterID: printerID,
-		Image:     img,
-		Status:    "queued",
-		CreatedAt: time.Now(),
+		ID:             fmt.Sprintf("job_%d", time.Now().UnixNano()),
+		PrinterID:      printerID,
+		Image:          payload.Image,
+		Controls:       payload.Controls,
+		Data:           payload.Data,
+		Priority:       opts.Priority,
+		IdempotencyKey: opts.IdempotencyKey,
+		Status:         "queued",
+		CreatedAt:      time.Now(),
+	}
+
+	if q.journal != nil {
+		if err := q.journal.put(job, true); err != nil {
+			return "", fmt.Errorf("failed to persist job: %w", err)
+		}
 	}
 
 	q.jobs = append(q.jobs, job)
+	if job.IdempotencyKey != "" {
+		q.keys[job.IdempotencyKey] = idempotencyEntry{jobID: job.ID, createdAt: job.CreatedAt}
+	}
+	q.wake(printerID)
 
-	return job.ID
+	return job.ID, nil
 }
 
-// worker processes print jobs
-func (q *PrintQueue) worker() {
-	defer q.wg.Done()
+// JobForKey returns the job submitted with an idempotency key within the
+// idempotency window, so a retried request can be answered before its
+// receipt is rendered again
+func (q *PrintQueue) JobForKey(key string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
 
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+	return q.lookupKey(key)
+}
+
+// lookupKey returns the job for an unexpired idempotency key. The caller
+// holds q.mu.
+func (q *PrintQueue) lookupKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	entry, exists := q.keys[key]
+	if !exists || time.Since(entry.createdAt) >= q.keyWindow {
+		return "", false
+	}
+	return entry.jobID, true
+}
+
+// dispatcher runs the jobs of a single printer in FIFO order
+type dispatcher struct {
+	printerID string
+	wake      chan struct{}
+}
+
+// wake signals the printer's dispatcher that work is available, starting it
+// on first use. Must be called with q.mu held.
+func (q *PrintQueue) wake(printerID string) {
+	d, exists := q.dispatchers[printerID]
+	if !exists {
+		d = &dispatcher{
+			printerID: printerID,
+			wake:      make(chan struct{}, 1),
+		}
+		q.dispatchers[printerID] = d
+
+		q.wg.Add(1)
+		go q.dispatch(d)
+	}
+
+	// A pending signal is enough - the dispatcher drains all queued jobs
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch processes a printer's jobs until the queue is stopped
+func (q *PrintQueue) dispatch(d *dispatcher) {
+	defer q.wg.Done()
 
 	for {
+		// Drain every queued job that is due before going back to sleep
+		var wait time.Duration
+		for q.ctx.Err() == nil {
+			ran, retryIn := q.processNextJob(d.printerID)
+			if !ran {
+				wait = retryIn
+				break
+			}
+		}
+
+		// Sleep until woken, or until the head job's backoff expires
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			retry = timer.C
+		}
+
 		select {
 		case <-q.ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
 			return
-		case <-ticker.C:
-			q.processNextJob()
+		case <-d.wake:
+		case <-retry:
+		}
+
+		if timer != nil {
+			timer.Stop()
 		}
 	}
 }
 
-func (q *PrintQueue) processNextJob() {
+// processNextJob prints the next queued job for a printer, reporting
+// whether there was one. If that job is still backing off, it returns
+// how long until it is due so later jobs don't jump ahead of it.
+func (q *PrintQueue) processNextJob(printerID string) (bool, time.Duration) {
 	q.mu.Lock()
 
-	// Find next queued job (skip jobs that are already printing, completed, or failed)
+	// Paused printers keep their jobs until resumed
+	if q.paused[printerID] {
+		q.mu.Unlock()
+		return false, 0
+	}
+
+	// Find the highest-priority queued job, oldest first within a priority
+	// (skip jobs that are already printing, completed, dead, or cancelled)
 	var job *PrintJob
 	for _, j := range q.jobs {
-		if j.Status == "queued" {
+		if j.PrinterID == printerID && j.Status == "queued" && (job == nil || j.Priority > job.Priority) {
 			job = j
-			job.Status = "printing"
-			break
 		}
 	}
 
+	if job != nil {
+		if wait := time.Until(job.NextAttemptAt); wait > 0 {
+			q.mu.Unlock()
+			return false, wait
+		}
+		job.Status = "printing"
+		job.BandsSent, job.BandsTotal = 0, 0
+		q.persist(job)
+	}
+
 	q.mu.Unlock()
 
 	if job == nil {
-		return // No jobs to process
+		return false, 0 // No jobs to process
 	}
 
 	// Attempt to print (only once per job)
@@ -123,35 +349,164 @@ func (q *PrintQueue) processNextJob() {
 
 	if foundJob == nil || foundJob.Status != "printing" {
 		// Job was removed or status changed, don't update
-		return
+		return true, 0
 	}
 
 	if err != nil {
 		foundJob.Retries++
 		foundJob.Error = err
 
-		if foundJob.Retries >= q.maxRetries {
-			foundJob.Status = "failed"
+		if IsPermanent(err) || foundJob.Retries >= q.maxRetries {
+			// Retrying won't help - park the job in the dead-letter state
+			foundJob.Status = "dead"
+			foundJob.NextAttemptAt = time.Time{}
 			// Job failed - error is stored in job.Error, can be viewed in TUI
 		} else {
-			// Retry with delay - mark as queued but add a delay before it can be processed again
+			// Back off before the next attempt
 			foundJob.Status = "queued"
+			foundJob.NextAttemptAt = time.Now().Add(retryDelay(foundJob.Retries, q.baseDelay, q.maxDelay))
 			// Job retrying - status is tracked in job, can be viewed in TUI
-			// Don't sleep here - let the worker ticker handle timing
 		}
 	} else {
 		// Success - mark as completed immediately
 		foundJob.Status = "completed"
+		foundJob.CompletedAt = time.Now()
 		// Job completed - status is tracked in job, can be viewed in TUI
 	}
+
+	q.persist(foundJob)
+
+	return true, 0
+}
+
+// persist journals a job's current status. Must be called with q.mu held.
+func (q *PrintQueue) persist(job *PrintJob) {
+	if q.journal == nil {
+		return
+	}
+
+	if err := q.journal.put(job, false); err != nil {
+		// The in-memory state is still correct
+		log.Printf("Warning: failed to journal print job %s: %v", job.ID, err)
+		return
+	}
+
+	if q.journal.needsCompaction(len(q.jobs)) && q.ctx.Err() == nil {
+		q.compactJournal()
+	}
+}
+
+// compactJournal rewrites the journal from a snapshot of the jobs in the
+// background, so encoding every payload doesn't hold up the dispatchers.
+// Must be called with q.mu held.
+func (q *PrintQueue) compactJournal() {
+	if !q.journal.startCompaction() {
+		return
+	}
+
+	snapshot := make([]*PrintJob, len(q.jobs))
+	for i, job := range q.jobs {
+		jobCopy := *job
+		snapshot[i] = &jobCopy
+	}
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+
+		if err := q.journal.compact(snapshot); err != nil {
+			log.Printf("Warning: failed to compact print queue journal: %v", err)
+		}
+	}()
+}
+
+// janitor periodically removes completed jobs older than the retention
+// period and forgets expired idempotency keys
+func (q *PrintQueue) janitor() {
+	defer q.wg.Done()
+
+	interval := time.Minute
+	if q.retention > 0 && q.retention < interval {
+		interval = q.retention
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+			if q.retention > 0 {
+				q.pruneCompleted(time.Now().Add(-q.retention))
+			}
+			q.pruneKeys(time.Now().Add(-q.keyWindow))
+		}
+	}
+}
+
+// pruneCompleted removes completed and cancelled jobs that finished before cutoff
+func (q *PrintQueue) pruneCompleted(cutoff time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.removeJobs(func(job *PrintJob) bool {
+		return isFinished(job) && job.CompletedAt.Before(cutoff)
+	})
+}
+
+// pruneKeys forgets idempotency keys created before cutoff
+func (q *PrintQueue) pruneKeys(cutoff time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for key, entry := range q.keys {
+		if entry.createdAt.Before(cutoff) {
+			delete(q.keys, key)
+		}
+	}
+}
+
+// isFinished reports whether a job will never print again
+func isFinished(job *PrintJob) bool {
+	return job.Status == "completed" || job.Status == "cancelled"
+}
+
+// removeJobs drops every job matching the predicate. Must be called with q.mu held.
+func (q *PrintQueue) removeJobs(match func(*PrintJob) bool) {
+	filtered := make([]*PrintJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if !match(job) {
+			filtered = append(filtered, job)
+			continue
+		}
+		if q.journal != nil {
+			q.journal.delete(job.ID)
+		}
+	}
+
+	q.jobs = filtered
 }
 
 func (q *PrintQueue) printJob(job *PrintJob) error {
+	if job.Image == nil && job.Data == nil {
+		return Permanent(fmt.Errorf("job has nothing to print"))
+	}
+
+	// Keep the status monitor off the connection until the job is confirmed
+	q.pool.acquire(job.PrinterID)
+	defer q.pool.release(job.PrinterID)
+
 	// Ensure printer is connected
 	if !q.pool.IsConnected(job.PrinterID) {
+		if q.manager == nil {
+			// Without a manager the connection may still be pooled later
+			return fmt.Errorf("printer not found: %s", job.PrinterID)
+		}
 		printer := q.manager.GetPrinter(job.PrinterID)
 		if printer == nil {
-			return fmt.Errorf("printer not found: %s", job.PrinterID)
+			return Permanent(fmt.Errorf("printer not found: %s", job.PrinterID))
 		}
 
 		if err := q.pool.Connect(printer); err != nil {
@@ -159,17 +514,95 @@ func (q *PrintQueue) printJob(job *PrintJob) error {
 		}
 	}
 
+	// Make sure the printer can take the job while it's still safe to retry
+	mode := q.completionMode(job.PrinterID)
+	if mode != CompletionFireAndForget {
+		if err := checkReady(q.pool.get(job.PrinterID)); err != nil {
+			return fmt.Errorf("printer not ready: %w", err)
+		}
+	}
+
 	// Print exactly once - Print should be idempotent and atomic
 	// If Print succeeds, it means data was sent once
-	err := q.pool.Print(job.PrinterID, job.Image)
+	var err error
+	if job.Data != nil {
+		err = q.pool.Write(job.PrinterID, job.Data)
+	} else {
+		err = q.pool.Print(job.PrinterID, job.Image, PrintOptions{
+			Controls:    job.Controls,
+			Profile:     q.profile(job.PrinterID),
+			BandHeight:  q.bandHeight,
+			FlowControl: q.flowControl(job.PrinterID),
+			Progress: func(sent, total int) {
+				q.reportProgress(job.ID, sent, total)
+			},
+		})
+	}
 	if err != nil {
+		// Drop the connection so the next attempt reconnects from scratch
+		q.pool.Disconnect(job.PrinterID)
 		return fmt.Errorf("print failed: %w", err)
 	}
 
+	// Written isn't printed - check with the printer if it's configured to.
+	// The receipt may have printed, so an unconfirmed job is never resent.
+	if mode != CompletionFireAndForget {
+		if err := confirmPrint(q.pool.get(job.PrinterID), mode, processID(job)); err != nil {
+			return Permanent(fmt.Errorf("print not confirmed: %w", err))
+		}
+	}
+
 	// Success - return nil to mark job as completed
 	return nil
 }
 
+// completionMode returns how a printer's jobs are confirmed
+func (q *PrintQueue) completionMode(printerID string) string {
+	if q.manager == nil {
+		return CompletionFireAndForget
+	}
+	return q.manager.GetCompletionMode(printerID)
+}
+
+// flowControl returns how a printer is waited for between raster bands
+func (q *PrintQueue) flowControl(printerID string) string {
+	if q.manager == nil {
+		return FlowNone
+	}
+	return q.manager.GetFlowControl(printerID)
+}
+
+// reportProgress records how many bands of a job have been sent
+func (q *PrintQueue) reportProgress(jobID string, sent, total int) {
+	q.mu.Lock()
+	if job := q.findJob(jobID); job != nil {
+		job.BandsSent = sent
+		job.BandsTotal = total
+	}
+	callback := q.onProgress
+	q.mu.Unlock()
+
+	if callback != nil {
+		callback(jobID, sent, total)
+	}
+}
+
+// OnJobProgress sets a callback for each raster band a job sends
+func (q *PrintQueue) OnJobProgress(callback func(jobID string, sent, total int)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.onProgress = callback
+}
+
+// profile returns the capabilities of a job's printer
+func (q *PrintQueue) profile(printerID string) *profile.Profile {
+	if q.manager == nil {
+		return nil
+	}
+	return q.manager.GetProfile(printerID)
+}
+
 // GetJob returns a job by ID
 func (q *PrintQueue) GetJob(jobID string) *PrintJob {
 	q.mu.Lock()
@@ -201,23 +634,162 @@ func (q *PrintQueue) GetAllJobs() []*PrintJob {
 	return jobs
 }
 
-// ClearCompleted removes completed jobs from the queue
-func (q *PrintQueue) ClearCompleted() {
+// GetDeadJobs returns the jobs in the dead-letter state
+func (q *PrintQueue) GetDeadJobs() []*PrintJob {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	filtered := make([]*PrintJob, 0)
+	jobs := make([]*PrintJob, 0)
 	for _, job := range q.jobs {
-		if job.Status != "completed" {
-			filtered = append(filtered, job)
+		if job.Status == "dead" {
+			jobCopy := *job
+			jobs = append(jobs, &jobCopy)
 		}
 	}
 
-	q.jobs = filtered
+	return jobs
+}
+
+// Requeue moves a dead job back into the queue with a fresh retry budget
+func (q *PrintQueue) Requeue(jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.findJob(jobID)
+	if job == nil {
+		return ErrJobNotFound
+	}
+	if job.Status != "dead" {
+		return ErrJobNotDead
+	}
+
+	job.Status = "queued"
+	job.Retries = 0
+	job.Error = nil
+	job.NextAttemptAt = time.Time{}
+	q.persist(job)
+	q.wake(job.PrinterID)
+
+	return nil
+}
+
+// Discard permanently removes a dead job
+func (q *PrintQueue) Discard(jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.findJob(jobID)
+	if job == nil {
+		return ErrJobNotFound
+	}
+	if job.Status != "dead" {
+		return ErrJobNotDead
+	}
+
+	q.removeJobs(func(j *PrintJob) bool {
+		return j.ID == jobID
+	})
+
+	return nil
+}
+
+// findJob returns the live job with the given ID. Must be called with q.mu held.
+func (q *PrintQueue) findJob(jobID string) *PrintJob {
+	for _, job := range q.jobs {
+		if job.ID == jobID {
+			return job
+		}
+	}
+
+	return nil
+}
+
+// Cancel stops a queued or dead job from printing. Jobs that are already
+// printing can't be recalled from the printer.
+func (q *PrintQueue) Cancel(jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.findJob(jobID)
+	if job == nil {
+		return ErrJobNotFound
+	}
+	if job.Status != "queued" && job.Status != "dead" {
+		return ErrJobNotCancellable
+	}
+
+	job.Status = "cancelled"
+	job.CompletedAt = time.Now()
+	job.NextAttemptAt = time.Time{}
+	q.persist(job)
+
+	return nil
+}
+
+// SetPriority changes the priority of a queued job
+func (q *PrintQueue) SetPriority(jobID string, priority int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.findJob(jobID)
+	if job == nil {
+		return ErrJobNotFound
+	}
+	if job.Status != "queued" {
+		return ErrJobNotQueued
+	}
+
+	job.Priority = priority
+	q.persist(job)
+	q.wake(job.PrinterID)
+
+	return nil
+}
+
+// PausePrinter holds a printer's queued jobs until it is resumed.
+// A job that is already printing is allowed to finish.
+func (q *PrintQueue) PausePrinter(printerID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.paused[printerID] = true
 }
 
-// Stop stops the print queue worker
+// ResumePrinter resumes processing a paused printer's jobs
+func (q *PrintQueue) ResumePrinter(printerID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.paused[printerID] {
+		return
+	}
+
+	delete(q.paused, printerID)
+	q.wake(printerID)
+}
+
+// IsPrinterPaused reports whether a printer's queue is paused
+func (q *PrintQueue) IsPrinterPaused(printerID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.paused[printerID]
+}
+
+// ClearCompleted removes completed and cancelled jobs from the queue
+func (q *PrintQueue) ClearCompleted() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.removeJobs(isFinished)
+}
+
+// Stop stops the print queue dispatchers and closes the journal
 func (q *PrintQueue) Stop() {
 	q.cancel()
 	q.wg.Wait()
+
+	if q.journal != nil {
+		q.journal.close()
+	}
 }
@@ -0,0 +1,437 @@
+package printer
+
+import (
+	"errors"
+	"image"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConnection records prints and can be made to block
+type fakeConnection struct {
+	mu      sync.Mutex
+	printed int
+	written []byte
+	block   chan struct{}
+	err     error
+}
+
+func (c *fakeConnection) Print(img image.Image, opts PrintOptions) error {
+	if c.block != nil {
+		<-c.block
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	c.printed++
+	return nil
+}
+
+func (c *fakeConnection) Write(data []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.written = append(c.written, data...)
+	return len(data), nil
+}
+
+func (c *fakeConnection) Close() error {
+	return nil
+}
+
+func (c *fakeConnection) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.printed
+}
+
+func newTestQueue(t *testing.T, conns map[string]PrinterConnection) *PrintQueue {
+	t.Helper()
+
+	pool := NewConnectionPool()
+	for id, conn := range conns {
+		pool.connections[id] = conn
+	}
+
+	q, err := NewPrintQueue(pool, nil, QueueOptions{MaxRetries: 3})
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	t.Cleanup(q.Stop)
+
+	return q
+}
+
+func waitForStatus(t *testing.T, q *PrintQueue, jobID, status string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if job := q.GetJob(jobID); job != nil && job.Status == status {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	job := q.GetJob(jobID)
+	if job == nil {
+		t.Fatalf("Job %s not found", jobID)
+	}
+	t.Fatalf("Job %s: expected status %s, got %s", jobID, status, job.Status)
+}
+
+func TestPrintQueue_IndependentPrinters(t *testing.T) {
+	kitchen := &fakeConnection{block: make(chan struct{})}
+	bar := &fakeConnection{}
+
+	q := newTestQueue(t, map[string]PrinterConnection{
+		"kitchen": kitchen,
+		"bar":     bar,
+	})
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+
+	kitchenJob, _ := q.Enqueue("kitchen", img, JobOptions{})
+	waitForStatus(t, q, kitchenJob, "printing")
+
+	// The bar printer must not wait on the hung kitchen printer
+	barJob, _ := q.Enqueue("bar", img, JobOptions{})
+	waitForStatus(t, q, barJob, "completed")
+
+	close(kitchen.block)
+	waitForStatus(t, q, kitchenJob, "completed")
+}
+
+func TestPrintQueue_FIFOPerPrinter(t *testing.T) {
+	conn := &fakeConnection{block: make(chan struct{})}
+
+	q := newTestQueue(t, map[string]PrinterConnection{"p1": conn})
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+
+	first, _ := q.Enqueue("p1", img, JobOptions{})
+	waitForStatus(t, q, first, "printing")
+
+	second, _ := q.Enqueue("p1", img, JobOptions{})
+	third, _ := q.Enqueue("p1", img, JobOptions{})
+
+	if job := q.GetJob(second); job.Status != "queued" {
+		t.Errorf("Expected second job to wait, got %s", job.Status)
+	}
+
+	close(conn.block)
+	waitForStatus(t, q, third, "completed")
+
+	first1, second1, third1 := q.GetJob(first), q.GetJob(second), q.GetJob(third)
+	if first1.CompletedAt.After(second1.CompletedAt) || second1.CompletedAt.After(third1.CompletedAt) {
+		t.Error("Jobs for the same printer completed out of order")
+	}
+	if conn.count() != 3 {
+		t.Errorf("Expected 3 prints, got %d", conn.count())
+	}
+}
+
+func TestPrintQueue_BackoffAndDeadLetter(t *testing.T) {
+	conn := &fakeConnection{err: errors.New("connection refused")}
+
+	pool := NewConnectionPool()
+	pool.connections["p1"] = conn
+
+	q, err := NewPrintQueue(pool, nil, QueueOptions{
+		MaxRetries:     2,
+		RetryBaseDelay: 50 * time.Millisecond,
+		RetryMaxDelay:  50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	t.Cleanup(q.Stop)
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	jobID, _ := q.Enqueue("p1", img, JobOptions{})
+
+	// The failed print drops the connection, so hand it back for the retry
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if job := q.GetJob(jobID); job.Retries == 1 {
+			if job.Status != "queued" || time.Until(job.NextAttemptAt) <= 0 {
+				t.Fatalf("Expected job to back off after a transient error, got %s", job.Status)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	pool.mu.Lock()
+	pool.connections["p1"] = conn
+	pool.mu.Unlock()
+
+	waitForStatus(t, q, jobID, "dead")
+
+	if dead := q.GetDeadJobs(); len(dead) != 1 || dead[0].ID != jobID {
+		t.Fatalf("Expected job in dead-letter list, got %d jobs", len(dead))
+	}
+
+	// Requeue with a working printer
+	conn.mu.Lock()
+	conn.err = nil
+	conn.mu.Unlock()
+	pool.mu.Lock()
+	pool.connections["p1"] = conn
+	pool.mu.Unlock()
+
+	if err := q.Requeue(jobID); err != nil {
+		t.Fatalf("Failed to requeue: %v", err)
+	}
+	waitForStatus(t, q, jobID, "completed")
+
+	if err := q.Discard(jobID); !errors.Is(err, ErrJobNotDead) {
+		t.Errorf("Expected ErrJobNotDead discarding a completed job, got %v", err)
+	}
+}
+
+func TestPrintQueue_PermanentErrorSkipsRetries(t *testing.T) {
+	q := newTestQueue(t, nil)
+
+	// A job without an image can never print
+	jobID, _ := q.Enqueue("p1", nil, JobOptions{})
+	waitForStatus(t, q, jobID, "dead")
+
+	job := q.GetJob(jobID)
+	if job.Retries != 1 || !IsPermanent(job.Error) {
+		t.Errorf("Expected one permanent failure, got retries=%d error=%v", job.Retries, job.Error)
+	}
+
+	if err := q.Discard(jobID); err != nil {
+		t.Fatalf("Failed to discard: %v", err)
+	}
+	if q.GetJob(jobID) != nil {
+		t.Error("Expected discarded job to be removed")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	max := time.Second
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		delay := retryDelay(attempt, base, max)
+		if delay < want/2 || delay > want {
+			t.Errorf("retryDelay(%d) = %v, want between %v and %v", attempt, delay, want/2, want)
+		}
+	}
+}
+
+func TestPrintQueue_PriorityAndPause(t *testing.T) {
+	conn := &fakeConnection{}
+
+	q := newTestQueue(t, map[string]PrinterConnection{"p1": conn})
+	q.PausePrinter("p1")
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+
+	low, _ := q.Enqueue("p1", img, JobOptions{})
+	cancelled, _ := q.Enqueue("p1", img, JobOptions{})
+	high, _ := q.Enqueue("p1", img, JobOptions{Priority: 10})
+	bumped, _ := q.Enqueue("p1", img, JobOptions{})
+
+	time.Sleep(20 * time.Millisecond)
+	if job := q.GetJob(low); job.Status != "queued" {
+		t.Fatalf("Expected paused printer to hold jobs, got %s", job.Status)
+	}
+
+	if err := q.Cancel(cancelled); err != nil {
+		t.Fatalf("Failed to cancel: %v", err)
+	}
+	if err := q.SetPriority(bumped, 5); err != nil {
+		t.Fatalf("Failed to set priority: %v", err)
+	}
+
+	q.ResumePrinter("p1")
+	waitForStatus(t, q, low, "completed")
+
+	highJob, bumpedJob, lowJob := q.GetJob(high), q.GetJob(bumped), q.GetJob(low)
+	if highJob.CompletedAt.After(bumpedJob.CompletedAt) || bumpedJob.CompletedAt.After(lowJob.CompletedAt) {
+		t.Error("Jobs did not print in priority order")
+	}
+	if job := q.GetJob(cancelled); job.Status != "cancelled" {
+		t.Errorf("Expected cancelled job to stay cancelled, got %s", job.Status)
+	}
+	if conn.count() != 3 {
+		t.Errorf("Expected 3 prints, got %d", conn.count())
+	}
+
+	if err := q.Cancel(low); !errors.Is(err, ErrJobNotCancellable) {
+		t.Errorf("Expected ErrJobNotCancellable cancelling a completed job, got %v", err)
+	}
+
+	q.ClearCompleted()
+	if jobs := q.GetAllJobs(); len(jobs) != 0 {
+		t.Errorf("Expected finished jobs to be cleared, got %d", len(jobs))
+	}
+}
+
+func TestPrintQueue_IdempotencyKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.journal")
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+
+	opts := QueueOptions{MaxRetries: 1, JournalPath: path, Paused: []string{"p1"}}
+	q, err := NewPrintQueue(NewConnectionPool(), nil, opts)
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+
+	first, _ := q.Enqueue("p1", img, JobOptions{IdempotencyKey: "order-42"})
+	retried, _ := q.Enqueue("p1", img, JobOptions{IdempotencyKey: "order-42"})
+	other, _ := q.Enqueue("p1", img, JobOptions{IdempotencyKey: "order-43"})
+
+	if retried != first {
+		t.Errorf("Expected retried submission to return %s, got %s", first, retried)
+	}
+	if jobID, ok := q.JobForKey("order-42"); !ok || jobID != first {
+		t.Errorf("Expected key lookup to return %s, got %s", first, jobID)
+	}
+	if _, ok := q.JobForKey("order-44"); ok {
+		t.Error("Expected no job for an unused key")
+	}
+	if other == first {
+		t.Error("Expected a different key to create a new job")
+	}
+	if jobs := q.GetAllJobs(); len(jobs) != 2 {
+		t.Errorf("Expected 2 jobs, got %d", len(jobs))
+	}
+	q.Stop()
+
+	// Keys survive a restart through the journal; the printer starts paused
+	// so the recovered jobs aren't dispatched
+	q, err = NewPrintQueue(NewConnectionPool(), nil, opts)
+	if err != nil {
+		t.Fatalf("Failed to reopen queue: %v", err)
+	}
+	defer q.Stop()
+
+	if retried, _ := q.Enqueue("p1", img, JobOptions{IdempotencyKey: "order-42"}); retried != first {
+		t.Errorf("Expected key to be remembered across restart, got %s", retried)
+	}
+
+	// Expired keys create a new job
+	q.pruneKeys(time.Now().Add(time.Second))
+	if _, ok := q.JobForKey("order-42"); ok {
+		t.Error("Expected no job for an expired key")
+	}
+	if again, _ := q.Enqueue("p1", img, JobOptions{IdempotencyKey: "order-42"}); again == first {
+		t.Error("Expected an expired key to create a new job")
+	}
+}
+
+func TestPrintQueue_ConfirmedCompletion(t *testing.T) {
+	manager, err := NewManager(filepath.Join(t.TempDir(), "printers.json"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	printerID := manager.AddNetworkPrinter("127.0.0.1", 9100, "test")
+	manager.SetCompletionMode(printerID, CompletionProcessID)
+
+	paperOut := map[byte][]byte{1: {0x12}, 2: {0x32}, 3: {0x12}, 4: {0x72}}
+	ready := map[byte][]byte{1: {0x12}, 2: {0x12}, 3: {0x12}, 4: {0x12}}
+	conn := &fakeStatusConnection{replies: paperOut, acknowledge: true}
+
+	pool := NewConnectionPool()
+	pool.connections[printerID] = conn
+
+	q, err := NewPrintQueue(pool, manager, QueueOptions{
+		MaxRetries:     3,
+		RetryBaseDelay: 20 * time.Millisecond,
+		RetryMaxDelay:  20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	t.Cleanup(q.Stop)
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	jobID, _ := q.Enqueue(printerID, img, JobOptions{})
+
+	// The printer reports paper out, so the job is held back and retried
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if job := q.GetJob(jobID); job.Retries > 0 {
+			if job.Status == "completed" {
+				t.Fatal("Expected job not to complete while the printer is out of paper")
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if conn.count() != 0 {
+		t.Fatal("Expected nothing to print while the printer is out of paper")
+	}
+
+	conn.setReplies(ready)
+	waitForStatus(t, q, jobID, "completed")
+	if conn.count() != 1 {
+		t.Errorf("Expected the job to print once, got %d", conn.count())
+	}
+}
+
+func TestPrintQueue_UnconfirmedNotResent(t *testing.T) {
+	manager, err := NewManager(filepath.Join(t.TempDir(), "printers.json"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	printerID := manager.AddNetworkPrinter("127.0.0.1", 9100, "test")
+	manager.SetCompletionMode(printerID, CompletionProcessID)
+
+	// Ready, but never acknowledges the process ID
+	ready := map[byte][]byte{1: {0x12}, 2: {0x12}, 3: {0x12}, 4: {0x12}}
+	conn := &fakeStatusConnection{replies: ready}
+
+	pool := NewConnectionPool()
+	pool.connections[printerID] = conn
+
+	q, err := NewPrintQueue(pool, manager, QueueOptions{
+		MaxRetries:     3,
+		RetryBaseDelay: 20 * time.Millisecond,
+		RetryMaxDelay:  20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	t.Cleanup(q.Stop)
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	jobID, _ := q.Enqueue(printerID, img, JobOptions{})
+
+	waitForStatus(t, q, jobID, "dead")
+	if conn.count() != 1 {
+		t.Errorf("Expected an unconfirmed job not to be resent, got %d prints", conn.count())
+	}
+}
+
+func TestPrintQueue_NativePayload(t *testing.T) {
+	conn := &fakeConnection{}
+	q := newTestQueue(t, map[string]PrinterConnection{"p1": conn})
+
+	data := []byte{0x1B, 0x40, 'h', 'i', '\n'}
+	jobID, err := q.EnqueuePayload("p1", Payload{Data: data}, JobOptions{})
+	if err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+	waitForStatus(t, q, jobID, "completed")
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if string(conn.written) != string(data) {
+		t.Errorf("Expected ESC/POS data to be written as-is, got %q", conn.written)
+	}
+	if conn.printed != 0 {
+		t.Errorf("Expected no image prints, got %d", conn.printed)
+	}
+}
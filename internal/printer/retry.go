@@ -0,0 +1,67 @@
+package printer
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Default retry backoff settings
+const (
+	DefaultRetryBaseDelay = 1 * time.Second
+	DefaultRetryMaxDelay  = 1 * time.Minute
+)
+
+// PermanentError marks a print failure that retrying can't fix,
+// such as an unknown printer or a job that can't be encoded
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err so the queue sends the job straight to the dead-letter state
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err (or anything it wraps) is permanent.
+// Everything else - connection refused, timeouts, write errors - is treated
+// as transient and retried with backoff.
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// retryDelay returns the backoff before the given retry attempt (1-based):
+// base * 2^(attempt-1), capped at max, with the upper half randomised so
+// printers that went offline together don't all retry in lockstep
+func retryDelay(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
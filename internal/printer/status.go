@@ -0,0 +1,320 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// statusTimeout bounds how long we wait for a printer to answer a status request
+const statusTimeout = 500 * time.Millisecond
+
+// ErrStatusTimeout is returned when a printer doesn't answer a status request in time
+var ErrStatusTimeout = errors.New("printer did not respond to status request")
+
+// ErrStatusUnsupported is returned by connections that can't read replies
+// from the printer, such as USB printers without an IN endpoint
+var ErrStatusUnsupported = errors.New("printer connection can't report status")
+
+// ESC/POS status commands
+var (
+	// EnableAutoStatusBack is GS a with every status change reported
+	EnableAutoStatusBack = []byte{0x1D, 0x61, 0xFF}
+)
+
+// StatusConnection is implemented by connections that can read replies from
+// the printer. Transact holds the connection for the whole exchange, so a
+// status request never lands in the middle of print data.
+type StatusConnection interface {
+	PrinterConnection
+	// Transact writes req (if any), then reads into resp until at least one
+	// byte arrives or timeout expires, returning ErrStatusTimeout if none did
+	Transact(req []byte, resp []byte, timeout time.Duration) (int, error)
+}
+
+// PrinterStatus is the state reported by the printer itself
+type PrinterStatus struct {
+	Online       bool      `json:"online"`
+	PaperNearEnd bool      `json:"paper_near_end"`
+	PaperOut     bool      `json:"paper_out"`
+	CoverOpen    bool      `json:"cover_open"`
+	CutterError  bool      `json:"cutter_error"`
+	Fault        bool      `json:"fault"`       // Unrecoverable or auto-recoverable error
+	DrawerOpen   bool      `json:"drawer_open"` // Drawer kick-out connector pin 3 is high
+	Error        string    `json:"error,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Ready reports whether the printer can print right now
+func (s PrinterStatus) Ready() bool {
+	return s.Online && !s.PaperOut && !s.CoverOpen && !s.CutterError && !s.Fault
+}
+
+// Problem returns a short description of why the printer isn't ready
+func (s PrinterStatus) Problem() string {
+	switch {
+	case s.Error != "":
+		return s.Error
+	case s.PaperOut:
+		return "paper out"
+	case s.CoverOpen:
+		return "cover open"
+	case s.CutterError:
+		return "cutter error"
+	case s.Fault:
+		return "printer error"
+	case !s.Online:
+		return "offline"
+	case s.PaperNearEnd:
+		return "paper near end"
+	}
+	return ""
+}
+
+// sameAs compares two statuses ignoring when they were read
+func (s PrinterStatus) sameAs(other PrinterStatus) bool {
+	s.UpdatedAt, other.UpdatedAt = time.Time{}, time.Time{}
+	return s == other
+}
+
+// QueryStatus reads the printer's real-time status with DLE EOT 1-4
+func QueryStatus(conn StatusConnection) (PrinterStatus, error) {
+	var replies [4]byte
+	for i := range replies {
+		b, err := queryStatusByte(conn, byte(i+1))
+		if err != nil {
+			return PrinterStatus{}, err
+		}
+		replies[i] = b
+	}
+
+	return parseRealtimeStatus(replies), nil
+}
+
+// queryStatusByte sends DLE EOT n and returns the reply byte
+func queryStatusByte(conn StatusConnection, n byte) (byte, error) {
+	buf := make([]byte, 16)
+	read, err := conn.Transact([]byte{0x10, 0x04, n}, buf, statusTimeout)
+	if err != nil {
+		return 0, err
+	}
+
+	// Real-time status bytes always have bits 1 and 4 set and bits 0 and 7
+	// clear. Anything else is a stale Automatic Status Back frame.
+	for i := read - 1; i >= 0; i-- {
+		if buf[i]&0x93 == 0x12 {
+			return buf[i], nil
+		}
+	}
+
+	return 0, ErrStatusTimeout
+}
+
+// parseRealtimeStatus decodes the replies to DLE EOT 1 (printer),
+// 2 (offline cause), 3 (error cause) and 4 (roll paper sensor)
+func parseRealtimeStatus(replies [4]byte) PrinterStatus {
+	printer, offline, errCause, paper := replies[0], replies[1], replies[2], replies[3]
+
+	return PrinterStatus{
+		Online:       printer&0x08 == 0,
+		DrawerOpen:   printer&0x04 != 0,
+		CoverOpen:    offline&0x04 != 0,
+		PaperOut:     offline&0x20 != 0 || paper&0x60 != 0,
+		Fault:        offline&0x40 != 0 || errCause&0x28 != 0,
+		CutterError:  errCause&0x04 != 0,
+		PaperNearEnd: paper&0x0C != 0,
+	}
+}
+
+// parseAutoStatus finds the last complete Automatic Status Back frame in data
+func parseAutoStatus(data []byte) (PrinterStatus, bool) {
+	// The first byte of a frame has bit 4 set and bits 0, 1 and 7 clear;
+	// the other three have bits 4 and 7 clear
+	for i := len(data) - 4; i >= 0; i-- {
+		frame := data[i : i+4]
+		if frame[0]&0x93 != 0x10 || frame[1]&0x90 != 0 || frame[2]&0x90 != 0 || frame[3]&0x90 != 0 {
+			continue
+		}
+
+		return PrinterStatus{
+			Online:       frame[0]&0x08 == 0,
+			DrawerOpen:   frame[0]&0x04 != 0,
+			CoverOpen:    frame[0]&0x20 != 0,
+			CutterError:  frame[1]&0x04 != 0,
+			Fault:        frame[1]&0x28 != 0,
+			PaperNearEnd: frame[2]&0x03 != 0,
+			PaperOut:     frame[2]&0x0C != 0,
+		}, true
+	}
+
+	return PrinterStatus{}, false
+}
+
+// StatusOptions configures a StatusMonitor
+type StatusOptions struct {
+	Interval       time.Duration // How often printers are polled
+	AutoStatusBack bool          // Let printers push changes (GS a) instead of polling with DLE EOT
+}
+
+// StatusMonitor periodically reads the status of every known printer and
+// records it on the manager
+type StatusMonitor struct {
+	manager        *Manager
+	pool           *ConnectionPool
+	interval       time.Duration
+	autoStatusBack bool
+	asbEnabled     map[string]StatusConnection // Connections GS a was sent on
+	unsupported    map[string]StatusConnection // Connections that can't report status
+	mu             sync.Mutex
+	ctx            context.Context
+	cancel         context.CancelFunc
+}
+
+// NewStatusMonitor creates a new printer status monitor
+func NewStatusMonitor(manager *Manager, pool *ConnectionPool, opts StatusOptions) *StatusMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	return &StatusMonitor{
+		manager:        manager,
+		pool:           pool,
+		interval:       interval,
+		autoStatusBack: opts.AutoStatusBack,
+		asbEnabled:     make(map[string]StatusConnection),
+		unsupported:    make(map[string]StatusConnection),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// Start begins polling printer status
+func (m *StatusMonitor) Start() {
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			m.pollAll()
+
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the status monitor
+func (m *StatusMonitor) Stop() {
+	m.cancel()
+}
+
+// pollAll polls every printer concurrently so an unreachable one doesn't
+// delay the rest
+func (m *StatusMonitor) pollAll() {
+	var wg sync.WaitGroup
+	for _, p := range m.manager.GetAllPrinters() {
+		wg.Add(1)
+		go func(p *Printer) {
+			defer wg.Done()
+			m.poll(p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// poll reads and records the status of one printer. A printer busy with a
+// job is skipped: its replies belong to the job.
+func (m *StatusMonitor) poll(p *Printer) {
+	if !m.pool.tryAcquire(p.ID) {
+		return
+	}
+	defer m.pool.release(p.ID)
+
+	if err := m.pool.Connect(p); err != nil {
+		m.manager.setPrinterStatus(p.ID, PrinterStatus{Error: err.Error(), UpdatedAt: time.Now()})
+		return
+	}
+
+	conn, ok := m.pool.get(p.ID).(StatusConnection)
+	if !ok || m.isUnsupported(p.ID, conn) {
+		// Write-only connection; nothing to report
+		return
+	}
+
+	var status PrinterStatus
+	var err error
+	if m.autoStatusBack {
+		status, err = m.readAutoStatus(p.ID, conn)
+	} else {
+		status, err = QueryStatus(conn)
+	}
+
+	if errors.Is(err, ErrStatusUnsupported) {
+		// Stop asking until the printer is reconnected
+		m.mu.Lock()
+		m.unsupported[p.ID] = conn
+		m.mu.Unlock()
+		return
+	}
+
+	if err != nil {
+		status = PrinterStatus{Error: err.Error()}
+		// Drop the connection so the next poll (or print) reconnects
+		if !errors.Is(err, ErrStatusTimeout) {
+			m.pool.disconnectIdle(p.ID, conn)
+		}
+	}
+
+	status.UpdatedAt = time.Now()
+	m.manager.setPrinterStatus(p.ID, status)
+}
+
+// isUnsupported reports whether conn was found not to report status
+func (m *StatusMonitor) isUnsupported(printerID string, conn StatusConnection) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.unsupported[printerID] == conn
+}
+
+// readAutoStatus enables Automatic Status Back on a connection the first
+// time it is seen, then picks up any frame the printer has pushed since.
+// Printers only push on changes, so no frame means nothing changed.
+func (m *StatusMonitor) readAutoStatus(printerID string, conn StatusConnection) (PrinterStatus, error) {
+	m.mu.Lock()
+	enabled := m.asbEnabled[printerID] == conn
+	m.mu.Unlock()
+
+	if !enabled {
+		if _, err := conn.Write(EnableAutoStatusBack); err != nil {
+			return PrinterStatus{}, err
+		}
+		m.mu.Lock()
+		m.asbEnabled[printerID] = conn
+		m.mu.Unlock()
+	}
+
+	buf := make([]byte, 64)
+	n, err := conn.Transact(nil, buf, statusTimeout)
+	if err != nil && !errors.Is(err, ErrStatusTimeout) {
+		return PrinterStatus{}, err
+	}
+
+	if status, ok := parseAutoStatus(buf[:n]); ok {
+		return status, nil
+	}
+
+	previous, known := m.manager.GetPrinterStatus(printerID)
+	if !known || previous.Error != "" {
+		// Assume a reachable printer is fine until it reports otherwise
+		return PrinterStatus{Online: true}, nil
+	}
+	return previous, nil
+}
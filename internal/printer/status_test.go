@@ -0,0 +1,216 @@
+package printer
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeStatusConnection answers DLE EOT requests from a canned table and
+// optionally acknowledges GS ( H process IDs
+type fakeStatusConnection struct {
+	fakeConnection
+	replies     map[byte][]byte
+	acknowledge bool
+	pending     []byte
+}
+
+func (c *fakeStatusConnection) Transact(req []byte, resp []byte, timeout time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if bytes.HasPrefix(req, []byte{0x10, 0x04}) && len(req) == 3 {
+		c.pending = append(c.pending, c.replies[req[2]]...)
+	}
+	if bytes.HasPrefix(req, []byte{0x1D, 0x28, 0x48}) && c.acknowledge {
+		// Split across reads, behind an Automatic Status Back frame
+		c.pending = append(c.pending, 0x10, 0x00, 0x00, 0x00, 0x37, 0x22)
+		c.pending = append(c.pending, req[7:11]...)
+		c.pending = append(c.pending, 0x00)
+	}
+	if len(c.pending) == 0 {
+		return 0, ErrStatusTimeout
+	}
+
+	n := copy(resp[:min(len(resp), 5)], c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// setReplies swaps the canned status replies
+func (c *fakeStatusConnection) setReplies(replies map[byte][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.replies = replies
+}
+
+func TestQueryStatus(t *testing.T) {
+	conn := &fakeStatusConnection{
+		replies: map[byte][]byte{
+			1: {0x16},       // Drawer pin high, online
+			2: {0x36},       // Cover open, paper end stop
+			3: {0x12},       // No errors
+			4: {0x10, 0x1E}, // Stale ASB byte, then near end
+		},
+	}
+
+	status, err := QueryStatus(conn)
+	if err != nil {
+		t.Fatalf("Failed to query status: %v", err)
+	}
+
+	if !status.Online || !status.DrawerOpen || !status.CoverOpen || !status.PaperOut || !status.PaperNearEnd {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if status.CutterError || status.Fault {
+		t.Errorf("Unexpected error flags: %+v", status)
+	}
+	if status.Ready() {
+		t.Error("Expected printer with cover open not to be ready")
+	}
+	if status.Problem() != "paper out" {
+		t.Errorf("Expected paper out to be reported first, got %q", status.Problem())
+	}
+}
+
+func TestQueryStatus_NoReply(t *testing.T) {
+	conn := &fakeStatusConnection{replies: map[byte][]byte{}}
+
+	if _, err := QueryStatus(conn); err != ErrStatusTimeout {
+		t.Errorf("Expected ErrStatusTimeout, got %v", err)
+	}
+}
+
+func TestParseAutoStatus(t *testing.T) {
+	// Noise followed by two frames; the last one wins
+	data := []byte{0x12, 0x10, 0x00, 0x00, 0x00, 0x30, 0x04, 0x0C, 0x00}
+
+	status, ok := parseAutoStatus(data)
+	if !ok {
+		t.Fatal("Expected a frame to be found")
+	}
+	if !status.Online || !status.CoverOpen || !status.CutterError || !status.PaperOut {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	if _, ok := parseAutoStatus([]byte{0x12, 0x12}); ok {
+		t.Error("Expected no frame in real-time status bytes")
+	}
+}
+
+func TestWaitForProcessID(t *testing.T) {
+	conn := &fakeStatusConnection{acknowledge: true}
+	if err := waitForProcessID(conn, 42, time.Second); err != nil {
+		t.Errorf("Expected acknowledgement, got %v", err)
+	}
+
+	conn = &fakeStatusConnection{}
+	if err := waitForProcessID(conn, 42, time.Second); err == nil {
+		t.Error("Expected an error when the printer never acknowledges")
+	}
+}
+
+// failingStatusConnection fails every status request with err
+type failingStatusConnection struct {
+	fakeConnection
+	err   error
+	calls int
+}
+
+func (c *failingStatusConnection) Transact(req []byte, resp []byte, timeout time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	return 0, c.err
+}
+
+func TestStatusMonitor_Poll(t *testing.T) {
+	manager, err := NewManager(filepath.Join(t.TempDir(), "printers.json"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	printerID := manager.AddNetworkPrinter("127.0.0.1", 9100, "test")
+	p := manager.GetPrinter(printerID)
+
+	pool := NewConnectionPool()
+	m := NewStatusMonitor(manager, pool, StatusOptions{})
+
+	// A printer that can't report status is only asked once and stays connected
+	conn := &failingStatusConnection{err: ErrStatusUnsupported}
+	pool.connections[printerID] = conn
+	m.poll(p)
+	m.poll(p)
+	if conn.calls != 1 {
+		t.Errorf("Expected polling to stop after ErrStatusUnsupported, got %d requests", conn.calls)
+	}
+	if pool.get(printerID) != conn {
+		t.Error("Expected the connection to stay pooled")
+	}
+
+	// A failing connection isn't dropped while a job is printing on it
+	broken := &failingStatusConnection{err: errors.New("broken pipe")}
+	pool.connections[printerID] = broken
+	pool.acquire(printerID)
+	m.poll(p)
+	if pool.get(printerID) != broken {
+		t.Error("Expected a connection in use not to be dropped")
+	}
+
+	pool.release(printerID)
+	m.poll(p)
+	if pool.IsConnected(printerID) {
+		t.Error("Expected an idle failing connection to be dropped")
+	}
+}
+
+// slowStatusConnection pauses after each reply, like a printer on a slow link
+type slowStatusConnection struct {
+	fakeStatusConnection
+}
+
+func (c *slowStatusConnection) Transact(req []byte, resp []byte, timeout time.Duration) (int, error) {
+	n, err := c.fakeStatusConnection.Transact(req, resp, timeout)
+	time.Sleep(2 * time.Millisecond)
+	return n, err
+}
+
+func TestStatusMonitor_DuringProcessIDJob(t *testing.T) {
+	manager, err := NewManager(filepath.Join(t.TempDir(), "printers.json"))
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	printerID := manager.AddNetworkPrinter("127.0.0.1", 9100, "test")
+	manager.SetCompletionMode(printerID, CompletionProcessID)
+
+	// The acknowledgement comes back over several slow reads, which a poll
+	// between them could take
+	ready := map[byte][]byte{1: {0x12}, 2: {0x12}, 3: {0x12}, 4: {0x12}}
+	conn := &slowStatusConnection{fakeStatusConnection{replies: ready, acknowledge: true}}
+
+	pool := NewConnectionPool()
+	pool.connections[printerID] = conn
+
+	m := NewStatusMonitor(manager, pool, StatusOptions{Interval: time.Millisecond, AutoStatusBack: true})
+	m.Start()
+	defer m.Stop()
+
+	q, err := NewPrintQueue(pool, manager, QueueOptions{MaxRetries: 1})
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	t.Cleanup(q.Stop)
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := 0; i < 20; i++ {
+		jobID, _ := q.Enqueue(printerID, img, JobOptions{})
+		waitForStatus(t, q, jobID, "completed")
+	}
+	if conn.count() != 20 {
+		t.Errorf("Expected each job to print once, got %d prints", conn.count())
+	}
+}
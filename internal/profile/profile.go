@@ -0,0 +1,202 @@
+// Package profile describes the capabilities of printer models: how wide they
+// print, which cuts, code pages and barcodes they support, and how much raster
+// data they accept at once
+package profile
+
+import (
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Profile describes what a printer model can do
+type Profile struct {
+	Name            string     `json:"name"` // Unique key, e.g. "epson-tm-t88"
+	Vendor          string     `json:"vendor"`
+	Models          []string   `json:"models"` // Model names matched against the printer description
+	USB             []USBID    `json:"usb,omitempty"`
+	DotsPerLine     int        `json:"dots_per_line"` // Printable width
+	DPI             int        `json:"dpi"`
+	FullCut         bool       `json:"full_cut"`
+	PartialCut      bool       `json:"partial_cut"`
+	MaxRasterHeight int        `json:"max_raster_height,omitempty"` // Rows per GS v 0 command, 0 for no limit
+	CodePages       []CodePage `json:"code_pages,omitempty"`        // In order of preference
+	Barcodes        []string   `json:"barcodes,omitempty"`          // Formats GS k can print
+	QRCode          bool       `json:"qr_code"`                     // GS ( k QR codes
+}
+
+// USBID identifies a printer model on USB
+type USBID struct {
+	VID uint16 `json:"vid"`
+	PID uint16 `json:"pid"`
+}
+
+// CodePage is a character code table the printer selects with ESC t n
+type CodePage struct {
+	ID   int    `json:"id"`   // n in ESC t n
+	Name string `json:"name"` // e.g. "CP437"
+}
+
+// defaultBarcodes are the GS k formats assumed when a printer has no profile
+var defaultBarcodes = []string{"CODE128", "CODE39", "EAN13", "EAN8"}
+
+// Find returns the profile with the given name, or nil if there is none
+func Find(name string) *Profile {
+	for i := range profiles {
+		if strings.EqualFold(profiles[i].Name, name) {
+			p := profiles[i]
+			return &p
+		}
+	}
+	return nil
+}
+
+// Match returns the profile for a USB printer, falling back to the model
+// name in its description. It returns nil if nothing matches.
+func Match(vid, pid uint16, description string) *Profile {
+	if vid != 0 || pid != 0 {
+		for i := range profiles {
+			for _, id := range profiles[i].USB {
+				if id.VID == vid && id.PID == pid {
+					p := profiles[i]
+					return &p
+				}
+			}
+		}
+	}
+
+	description = strings.ToLower(description)
+	if description == "" {
+		return nil
+	}
+	for i := range profiles {
+		for _, model := range profiles[i].Models {
+			if strings.Contains(description, strings.ToLower(model)) {
+				p := profiles[i]
+				return &p
+			}
+		}
+	}
+
+	return nil
+}
+
+// All returns every known profile
+func All() []Profile {
+	return append([]Profile(nil), profiles...)
+}
+
+// Width returns the printable width in dots for a paper width in pixels.
+// A printer can print less than the paper is wide, so the narrower wins.
+func (p *Profile) Width(paperPixels int) int {
+	if p == nil || p.DotsPerLine <= 0 || p.DotsPerLine > paperPixels {
+		return paperPixels
+	}
+	return p.DotsPerLine
+}
+
+// DefaultDPI is the resolution of most thermal receipt printers
+const DefaultDPI = 203
+
+// Resolution returns the printer's DPI, or DefaultDPI if it isn't known
+func (p *Profile) Resolution() int {
+	if p == nil || p.DPI <= 0 {
+		return DefaultDPI
+	}
+	return p.DPI
+}
+
+// SupportsBarcode reports whether the printer can print a barcode format itself
+func (p *Profile) SupportsBarcode(format string) bool {
+	barcodes := defaultBarcodes
+	if p != nil && p.Barcodes != nil {
+		barcodes = p.Barcodes
+	}
+
+	for _, b := range barcodes {
+		if strings.EqualFold(b, format) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsQRCode reports whether the printer can print QR codes itself
+func (p *Profile) SupportsQRCode() bool {
+	return p == nil || p.QRCode
+}
+
+// CanCut reports whether the printer has a cutter
+func (p *Profile) CanCut() bool {
+	return p == nil || p.FullCut || p.PartialCut
+}
+
+// CanPartialCut reports whether the printer can cut partially
+func (p *Profile) CanPartialCut() bool {
+	return p == nil || p.PartialCut
+}
+
+// RasterHeight returns the most rows to send in one raster command, or 0 for no limit
+func (p *Profile) RasterHeight() int {
+	if p == nil {
+		return 0
+	}
+	return p.MaxRasterHeight
+}
+
+// Encode converts text to the first code page that can represent all of it,
+// returning the bytes and the code page to select. ok is false if none can.
+func (p *Profile) Encode(text string) (data []byte, page CodePage, ok bool) {
+	if p == nil {
+		return nil, CodePage{}, false
+	}
+
+	for _, page := range p.CodePages {
+		table, known := charmaps[strings.ToUpper(page.Name)]
+		if !known {
+			continue
+		}
+
+		data := make([]byte, 0, len(text))
+		encoded := true
+		for _, r := range text {
+			if r == '\n' {
+				data = append(data, '\n')
+				continue
+			}
+			b, valid := table.EncodeRune(r)
+			if !valid {
+				encoded = false
+				break
+			}
+			data = append(data, b)
+		}
+		if encoded {
+			return data, page, true
+		}
+	}
+
+	return nil, CodePage{}, false
+}
+
+// charmaps are the code pages text can be converted to
+var charmaps = map[string]*charmap.Charmap{
+	"CP437":       charmap.CodePage437,
+	"CP850":       charmap.CodePage850,
+	"CP852":       charmap.CodePage852,
+	"CP858":       charmap.CodePage858,
+	"CP860":       charmap.CodePage860,
+	"CP863":       charmap.CodePage863,
+	"CP865":       charmap.CodePage865,
+	"CP866":       charmap.CodePage866,
+	"CP1250":      charmap.Windows1250,
+	"CP1251":      charmap.Windows1251,
+	"CP1252":      charmap.Windows1252,
+	"CP1253":      charmap.Windows1253,
+	"CP1254":      charmap.Windows1254,
+	"CP1255":      charmap.Windows1255,
+	"CP1257":      charmap.Windows1257,
+	"ISO-8859-2":  charmap.ISO8859_2,
+	"ISO-8859-7":  charmap.ISO8859_7,
+	"ISO-8859-15": charmap.ISO8859_15,
+}
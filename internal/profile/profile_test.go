@@ -0,0 +1,78 @@
+package profile
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	p := Find("EPSON-TM-T88")
+	if p == nil {
+		t.Fatal("Expected to find epson-tm-t88")
+	}
+	if p.DotsPerLine != 512 {
+		t.Errorf("Expected 512 dots per line, got %d", p.DotsPerLine)
+	}
+
+	if Find("unknown") != nil {
+		t.Error("Expected no profile for an unknown name")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	if p := Match(0x04B8, 0x0202, ""); p == nil || p.Name != "epson-tm-t88" {
+		t.Errorf("Expected epson-tm-t88 by USB ID, got %v", p)
+	}
+	if p := Match(0, 0, "EPSON TM-T20II Receipt"); p == nil || p.Name != "epson-tm-t20" {
+		t.Errorf("Expected epson-tm-t20 by model name, got %v", p)
+	}
+	if p := Match(0x1234, 0x5678, "Unknown printer"); p != nil {
+		t.Errorf("Expected no match, got %s", p.Name)
+	}
+}
+
+func TestProfile_Width(t *testing.T) {
+	p := &Profile{DotsPerLine: 512}
+	if got := p.Width(576); got != 512 {
+		t.Errorf("Expected the printable width 512, got %d", got)
+	}
+	if got := p.Width(384); got != 384 {
+		t.Errorf("Expected the narrower paper width 384, got %d", got)
+	}
+
+	var generic *Profile
+	if got := generic.Width(576); got != 576 {
+		t.Errorf("Expected a generic printer to use the paper width, got %d", got)
+	}
+}
+
+func TestProfile_Encode(t *testing.T) {
+	p := &Profile{CodePages: []CodePage{{ID: 0, Name: "CP437"}, {ID: 17, Name: "CP866"}}}
+
+	data, page, ok := p.Encode("Привет")
+	if !ok || page.ID != 17 {
+		t.Fatalf("Expected Cyrillic to use CP866, got %v %v", page, ok)
+	}
+	if !bytes.Equal(data, []byte{0x8F, 0xE0, 0xA8, 0xA2, 0xA5, 0xE2}) {
+		t.Errorf("Unexpected CP866 bytes %x", data)
+	}
+
+	if _, _, ok := p.Encode("日本"); ok {
+		t.Error("Expected no code page for Japanese")
+	}
+}
+
+func TestProfile_Capabilities(t *testing.T) {
+	var generic *Profile
+	if !generic.CanCut() || !generic.CanPartialCut() || !generic.SupportsQRCode() || !generic.SupportsBarcode("EAN13") {
+		t.Error("Expected a generic printer to support the common commands")
+	}
+
+	p := Find("pos-58")
+	if p.CanCut() {
+		t.Error("Expected pos-58 to have no cutter")
+	}
+	if p.SupportsBarcode("CODE93") {
+		t.Error("Expected pos-58 not to support CODE93")
+	}
+}
@@ -0,0 +1,88 @@
+package profile
+
+// Code pages shared by most ESC/POS printers
+var (
+	epsonCodePages = []CodePage{
+		{ID: 0, Name: "CP437"},
+		{ID: 2, Name: "CP850"},
+		{ID: 19, Name: "CP858"},
+		{ID: 16, Name: "CP1252"},
+		{ID: 18, Name: "CP852"},
+		{ID: 17, Name: "CP866"},
+		{ID: 3, Name: "CP860"},
+		{ID: 4, Name: "CP863"},
+		{ID: 5, Name: "CP865"},
+	}
+	basicCodePages = []CodePage{
+		{ID: 0, Name: "CP437"},
+		{ID: 16, Name: "CP1252"},
+	}
+)
+
+// profiles is the built-in printer database, in the spirit of escpos-printer-db
+var profiles = []Profile{
+	{
+		Name:        "generic-58mm",
+		Vendor:      "Generic",
+		DotsPerLine: 384,
+		DPI:         203,
+		// Cheap 58mm printers rarely have a cutter and choke on tall images
+		MaxRasterHeight: 255,
+		CodePages:       basicCodePages,
+		Barcodes:        []string{"CODE128", "CODE39", "EAN13", "EAN8", "UPC_A"},
+		QRCode:          true,
+	},
+	{
+		Name:            "generic-80mm",
+		Vendor:          "Generic",
+		DotsPerLine:     576,
+		DPI:             203,
+		FullCut:         true,
+		PartialCut:      true,
+		MaxRasterHeight: 255,
+		CodePages:       basicCodePages,
+		Barcodes:        []string{"CODE128", "CODE39", "EAN13", "EAN8", "UPC_A"},
+		QRCode:          true,
+	},
+	{
+		Name:            "epson-tm-t20",
+		Vendor:          "Epson",
+		Models:          []string{"TM-T20"},
+		USB:             []USBID{{VID: 0x04B8, PID: 0x0E15}},
+		DotsPerLine:     576,
+		DPI:             203,
+		FullCut:         true,
+		PartialCut:      true,
+		MaxRasterHeight: 1024,
+		CodePages:       epsonCodePages,
+		Barcodes:        []string{"CODE128", "CODE39", "CODE93", "EAN13", "EAN8", "UPC_A", "UPC_E", "ITF", "CODABAR"},
+		QRCode:          true,
+	},
+	{
+		// 80mm paper, but only 72mm of it is printable
+		Name:            "epson-tm-t88",
+		Vendor:          "Epson",
+		Models:          []string{"TM-T88"},
+		USB:             []USBID{{VID: 0x04B8, PID: 0x0202}},
+		DotsPerLine:     512,
+		DPI:             180,
+		FullCut:         true,
+		PartialCut:      true,
+		MaxRasterHeight: 1024,
+		CodePages:       epsonCodePages,
+		Barcodes:        []string{"CODE128", "CODE39", "CODE93", "EAN13", "EAN8", "UPC_A", "UPC_E", "ITF", "CODABAR"},
+		QRCode:          true,
+	},
+	{
+		Name:            "pos-58",
+		Vendor:          "Generic",
+		Models:          []string{"POS-58", "POS58"},
+		USB:             []USBID{{VID: 0x0416, PID: 0x5011}},
+		DotsPerLine:     384,
+		DPI:             203,
+		MaxRasterHeight: 255,
+		CodePages:       basicCodePages,
+		Barcodes:        []string{"CODE128", "CODE39", "EAN13", "EAN8", "UPC_A"},
+		QRCode:          true,
+	},
+}
@@ -30,6 +30,11 @@ type PrinterEntry struct {
 	Port        int    `json:"port,omitempty"`
 	Description string `json:"description"`
 	Name        string `json:"name,omitempty"` // Custom user-set name
+
+	CompletionMode string `json:"completion_mode,omitempty"` // How print completion is confirmed
+	Output         string `json:"output,omitempty"`          // raster or native ESC/POS
+	Profile        string `json:"profile,omitempty"`         // Capability profile, empty to detect it
+	FlowControl    string `json:"flow_control,omitempty"`    // How to wait for the printer between raster bands
 }
 
 // PrinterInfo represents basic printer information for detection
@@ -129,6 +134,74 @@ func (r *Registry) SetPrinterName(printerID string, name string) bool {
 	return false
 }
 
+// SetCompletionMode sets how print completion is confirmed for a printer
+func (r *Registry) SetCompletionMode(printerID string, mode string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.data {
+		if entry.ID == printerID {
+			entry.CompletionMode = mode
+			if err := r.save(); err != nil {
+				// Warning: failed to save registry - non-critical, will retry
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// SetOutput sets whether receipts are sent to a printer as an image or as native ESC/POS
+func (r *Registry) SetOutput(printerID string, output string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.data {
+		if entry.ID == printerID {
+			entry.Output = output
+			if err := r.save(); err != nil {
+				// Warning: failed to save registry - non-critical, will retry
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// SetProfile sets the capability profile used for a printer
+func (r *Registry) SetProfile(printerID string, profile string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.data {
+		if entry.ID == printerID {
+			entry.Profile = profile
+			if err := r.save(); err != nil {
+				// Warning: failed to save registry - non-critical, will retry
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// SetFlowControl sets how a printer is waited for between raster bands
+func (r *Registry) SetFlowControl(printerID string, mode string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.data {
+		if entry.ID == printerID {
+			entry.FlowControl = mode
+			if err := r.save(); err != nil {
+				// Warning: failed to save registry - non-critical, will retry
+			}
+			return true
+		}
+	}
+	return false
+}
+
 // GetPrinterInfo gets all stored information for a printer
 func (r *Registry) GetPrinterInfo(printerID string) *PrinterEntry {
 	r.mu.RLock()
@@ -0,0 +1,342 @@
+package renderer
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Marks that set a line's base direction before it's resolved
+const (
+	leftToRightMark = '\u200e'
+	rightToLeftMark = '\u200f'
+)
+
+// ContainsRTL reports whether text has any right to left characters, which
+// have to be reordered before they're drawn
+func ContainsRTL(text string) bool {
+	for _, c := range text {
+		props, _ := bidi.LookupRune(c)
+		if class := props.Class(); class == bidi.R || class == bidi.AL {
+			return true
+		}
+	}
+	return false
+}
+
+// isRTL reports whether text is a right to left paragraph: whether its first
+// letter is from a right to left script
+func isRTL(text string) bool {
+	for _, c := range text {
+		props, _ := bidi.LookupRune(c)
+		switch props.Class() {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+	return false
+}
+
+// bidiLevels returns the embedding level of each character in a line: even
+// for left to right, odd for right to left
+func bidiLevels(runes []rune, rtl bool) []int {
+	levels := make([]int, len(runes))
+	base := 0
+	mark := leftToRightMark
+	if rtl {
+		base = 1
+		mark = rightToLeftMark
+	}
+	for i := range levels {
+		levels[i] = base
+	}
+	if len(runes) == 0 {
+		return levels
+	}
+
+	// The mark fixes the base direction, which would otherwise come from the
+	// line's own first letter
+	var p bidi.Paragraph
+	if _, err := p.SetString(string(mark) + string(runes)); err != nil {
+		return levels
+	}
+	order, err := p.Order()
+	if err != nil {
+		return levels
+	}
+
+	for i := 0; i < order.NumRuns(); i++ {
+		run := order.Run(i)
+		level := 1
+		if run.Direction() == bidi.LeftToRight {
+			level = 2 * base // Left to right text inside right to left is nested a level deeper
+		}
+		start, end := run.Pos()
+		for j := start; j <= end; j++ {
+			if j > 0 {
+				levels[j-1] = level
+			}
+		}
+	}
+
+	if !rtl {
+		raiseNumbers(runes, levels)
+	}
+	return levels
+}
+
+// raiseNumbers nests numbers that follow right to left text a level deeper,
+// so they read left to right inside it. The ordering only says which runs are
+// left to right, which doesn't tell these numbers apart from the text around
+// them in a left to right line.
+func raiseNumbers(runes []rune, levels []int) {
+	class := func(i int) bidi.Class {
+		props, _ := bidi.LookupRune(runes[i])
+		return props.Class()
+	}
+	isNumber := func(i int) bool {
+		return i >= 0 && i < len(runes) && levels[i] == 2
+	}
+
+	afterRTL := false
+	for i := range runes {
+		switch class(i) {
+		case bidi.L:
+			afterRTL = false
+		case bidi.R, bidi.AL:
+			afterRTL = true
+		case bidi.AN:
+			if levels[i] == 0 {
+				levels[i] = 2
+			}
+		case bidi.EN:
+			if afterRTL && levels[i] == 0 {
+				levels[i] = 2
+			}
+		}
+	}
+
+	// A separator between two digits, as in 4.50, and currency and percent
+	// signs next to them belong to the number
+	for i := range runes {
+		if levels[i] == 0 && (class(i) == bidi.CS || class(i) == bidi.ES) && isNumber(i-1) && isNumber(i+1) {
+			levels[i] = 2
+		}
+	}
+	for i := range runes {
+		if levels[i] == 0 && class(i) == bidi.ET && isNumber(i-1) {
+			levels[i] = 2
+		}
+	}
+	for i := len(runes) - 1; i >= 0; i-- {
+		if levels[i] == 0 && class(i) == bidi.ET && isNumber(i+1) {
+			levels[i] = 2
+		}
+	}
+}
+
+// visualOrder returns the indices of units in the order they're drawn, left
+// to right, reversing every run at each level from the highest down to 1
+// (rule L2 of the Unicode bidi algorithm)
+func visualOrder(levels []int) []int {
+	order := make([]int, len(levels))
+	maxLevel := 0
+	for i, level := range levels {
+		order[i] = i
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+
+	for level := maxLevel; level >= 1; level-- {
+		for i := 0; i < len(order); {
+			if levels[order[i]] < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(order) && levels[order[j]] >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+			}
+			i = j
+		}
+	}
+	return order
+}
+
+// visualLine reorders a line of text for drawing left to right. Combining
+// marks stay after the letter they belong to, and brackets in right to left
+// text are mirrored.
+func visualLine(line string, rtl bool) string {
+	runes := []rune(line)
+	levels := bidiLevels(runes, rtl)
+
+	// Letters with their combining marks are reordered together
+	var clusters [][]rune
+	var clusterLevels []int
+	for i, c := range runes {
+		if len(clusters) > 0 && unicode.Is(unicode.Mn, c) {
+			clusters[len(clusters)-1] = append(clusters[len(clusters)-1], c)
+			continue
+		}
+		clusters = append(clusters, []rune{c})
+		clusterLevels = append(clusterLevels, levels[i])
+	}
+
+	var b strings.Builder
+	for _, i := range visualOrder(clusterLevels) {
+		cluster := string(clusters[i])
+		if clusterLevels[i]%2 == 1 {
+			cluster = mirrorBrackets(cluster)
+		}
+		b.WriteString(cluster)
+	}
+	return b.String()
+}
+
+// mirrorBrackets swaps opening and closing brackets, which point the other
+// way in right to left text
+func mirrorBrackets(s string) string {
+	return strings.Map(func(c rune) rune {
+		if props, _ := bidi.LookupRune(c); props.IsBracket() {
+			return []rune(bidi.ReverseString(string(c)))[0]
+		}
+		return c
+	}, s)
+}
+
+// arabicForms are the isolated, final, initial and medial presentation forms
+// of Arabic letters. Letters that only join the letter before them have no
+// initial or medial forms, and hamza joins neither.
+var arabicForms = map[rune][4]rune{
+	0x0621: {0xFE80, 0, 0, 0},
+	0x0622: {0xFE81, 0xFE82, 0, 0},
+	0x0623: {0xFE83, 0xFE84, 0, 0},
+	0x0624: {0xFE85, 0xFE86, 0, 0},
+	0x0625: {0xFE87, 0xFE88, 0, 0},
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	0x0627: {0xFE8D, 0xFE8E, 0, 0},
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	0x0629: {0xFE93, 0xFE94, 0, 0},
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	0x062F: {0xFEA9, 0xFEAA, 0, 0},
+	0x0630: {0xFEAB, 0xFEAC, 0, 0},
+	0x0631: {0xFEAD, 0xFEAE, 0, 0},
+	0x0632: {0xFEAF, 0xFEB0, 0, 0},
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	0x0648: {0xFEED, 0xFEEE, 0, 0},
+	0x0649: {0xFEEF, 0xFEF0, 0, 0},
+	0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+}
+
+// lamAlef are the isolated and final ligatures of lam followed by each alef
+var lamAlef = map[rune][2]rune{
+	0x0622: {0xFEF5, 0xFEF6},
+	0x0623: {0xFEF7, 0xFEF8},
+	0x0625: {0xFEF9, 0xFEFA},
+	0x0627: {0xFEFB, 0xFEFC},
+}
+
+const (
+	arabicLam = '\u0644'
+	tatweel   = '\u0640' // Joins on both sides but has no forms of its own
+)
+
+// joinsNext reports whether a letter connects to the letter after it
+func joinsNext(c rune) bool {
+	return c == tatweel || arabicForms[c][2] != 0
+}
+
+// joinsPrevious reports whether a letter connects to the letter before it
+func joinsPrevious(c rune) bool {
+	return c == tatweel || arabicForms[c][1] != 0
+}
+
+// shapeArabic replaces Arabic letters with the form they take next to their
+// neighbours, which fonts draw joined up. Text is shaped in logical order,
+// before it's wrapped and reordered.
+func shapeArabic(text string) string {
+	if !strings.ContainsFunc(text, func(c rune) bool { _, ok := arabicForms[c]; return ok }) {
+		return text
+	}
+
+	runes := []rune(text)
+
+	// Combining marks such as vowel signs don't break a join
+	neighbour := func(i, step int) int {
+		for j := i + step; j >= 0 && j < len(runes); j += step {
+			if !unicode.Is(unicode.Mn, runes[j]) {
+				return j
+			}
+		}
+		return -1
+	}
+	runeAt := func(i int) rune {
+		if i < 0 {
+			return 0
+		}
+		return runes[i]
+	}
+
+	shaped := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		forms, ok := arabicForms[c]
+		if !ok {
+			shaped = append(shaped, c)
+			continue
+		}
+
+		joinPrevious := forms[1] != 0 && joinsNext(runeAt(neighbour(i, -1)))
+
+		// Lam followed by alef is written as one ligature
+		next := neighbour(i, 1)
+		if ligature, ok := lamAlef[runeAt(next)]; c == arabicLam && ok {
+			if joinPrevious {
+				shaped = append(shaped, ligature[1])
+			} else {
+				shaped = append(shaped, ligature[0])
+			}
+			shaped = append(shaped, runes[i+1:next]...) // Marks on the lam
+			i = next
+			continue
+		}
+
+		joinNext := forms[2] != 0 && joinsPrevious(runeAt(next))
+		switch {
+		case joinPrevious && joinNext:
+			shaped = append(shaped, forms[3])
+		case joinPrevious:
+			shaped = append(shaped, forms[1])
+		case joinNext:
+			shaped = append(shaped, forms[2])
+		default:
+			shaped = append(shaped, forms[0])
+		}
+	}
+	return string(shaped)
+}
@@ -0,0 +1,73 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+func TestVisualLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"left to right", "abc (def) ghi", "abc (def) ghi"},
+		{"hebrew", "שלום עולם", "םלוע םולש"},
+		{"mirrored brackets", "שלום (עולם)", "(םלוע) םולש"},
+		{"number in hebrew", "סה\"כ 42.50", "42.50 כ\"הס"},
+		{"hebrew in english", "Total: שלום 42", "Total: 42 םולש"},
+		{"price after hebrew", "Paid שלום $4.50 ok", "Paid $4.50 םולש ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := visualLine(tt.line, isRTL(tt.line)); got != tt.want {
+				t.Errorf("visualLine(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShapeArabic(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		// Alef doesn't join the seen after it, and lam alef is a ligature
+		{"salam", "السلام", "ﺍﻟﺴﻼﻡ"},
+		{"isolated", "ب ب", "ﺏ ﺏ"},
+		{"vowel marks don't break joins", "بَب", "ﺑَﺐ"},
+		{"latin untouched", "abc", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shapeArabic(tt.text); got != tt.want {
+				t.Errorf("shapeArabic(%q) = %U, want %U", tt.text, []rune(got), []rune(tt.want))
+			}
+		})
+	}
+}
+
+func TestReorderPieces(t *testing.T) {
+	line := spanLine{pieces: pieces("שלום", " ", "Coffee", " ", "עולם")}
+	reorderPieces(&line, true)
+	if got, want := lineTexts([]spanLine{line})[0], "םלוע Coffee םולש"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestRenderText_RTL(t *testing.T) {
+	r, err := New("80mm")
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	for _, cmd := range []receiptformat.Command{
+		{Type: "text", Value: "مرحبا بكم في متجرنا، شكرا لزيارتكم ونتمنى لكم يوما سعيدا مع قهوة طازجة"},
+		{Type: "text", Spans: []receiptformat.Span{{Value: "סה\"כ ", Weight: "bold"}, {Value: "₪42.50"}}},
+	} {
+		if err := r.RenderCommand(&cmd); err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+	}
+}
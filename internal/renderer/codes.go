@@ -1,123 +1,354 @@
 package renderer
 
 import (
+	"fmt"
+	"strings"
 	
 	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/aztec"
+	"github.com/boombuler/barcode/codabar"
 	"github.com/boombuler/barcode/code128"
 	"github.com/boombuler/barcode/code39"
+	"github.com/boombuler/barcode/code93"
+	"github.com/boombuler/barcode/datamatrix"
 	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/pdf417"
+	"github.com/boombuler/barcode/twooffive"
+	"github.com/boombuler/barcode/utils"
 	"github.com/skip2/go-qrcode"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
+// barcodeQuietZone is the blank space a scanner needs either side of a
+// barcode, in modules
+const barcodeQuietZone = 10
+
+// barcodeTextSize is the font size of the human-readable text (HRI) under
+// or above a barcode
+const barcodeTextSize = 22
+
 func (r *Renderer) renderBarcode(cmd *receiptformat.Command) error {
 	if cmd.Value == "" {
 		return nil
 	}
 	
-	format := cmd.Format
-	if format == "" {
-		format = "CODE128"
-	}
-	
 	height := cmd.Height
 	if height == 0 {
 		height = 80
 	}
 	
-	width := cmd.Width
-	if width == 0 {
-		width = 2
+	barcodeImg, err := EncodeBarcode(cmd.Format, cmd.Value)
+	if err != nil {
+		return err
 	}
 	
-	var barcodeImg barcode.Barcode
-	var err error
-	
-	// Generate barcode based on format
-	switch format {
-	case "CODE128":
-		barcodeImg, err = code128.Encode(cmd.Value)
-	case "CODE39":
-		barcodeImg, err = code39.Encode(cmd.Value, false, false)
-	case "EAN13":
-		barcodeImg, err = ean.Encode(cmd.Value)
-	case "EAN8":
-		barcodeImg, err = ean.Encode(cmd.Value)
-	default:
-		barcodeImg, err = code128.Encode(cmd.Value)
+	// Bars are drawn at a whole number of dots per module, never squeezed to
+	// fit, so the code stays scannable
+	modules := barcodeImg.Bounds().Dx() + 2*barcodeQuietZone
+	module := cmd.Width
+	if module == 0 {
+		module = 2
+		if modules*module > r.width {
+			module = 1
+		}
+	}
+	if modules*module > r.width {
+		return fmt.Errorf("barcode needs %d dots at module width %d including quiet zones, but the paper is %d dots wide", modules*module, module, r.width)
 	}
 	
+	barcodeImg, err = barcode.Scale(barcodeImg, barcodeImg.Bounds().Dx()*module, height)
 	if err != nil {
 		return err
 	}
 	
-	// Scale barcode
-	targetWidth := r.width - 40 // Leave margins
-	barcodeImg, err = barcode.Scale(barcodeImg, targetWidth, height)
-	if err != nil {
-		return err
+	// Already checked by EncodeBarcode
+	text, _ := receiptformat.NormalizeBarcode(cmd.Format, cmd.Value)
+	
+	if cmd.Position == "above" || cmd.Position == "both" {
+		r.drawCaption(text, float64(r.width)/2)
 	}
 	
 	// Ensure we have enough height
 	imgHeight := barcodeImg.Bounds().Dy()
 	r.ensureHeight(imgHeight + 20)
 	
-	// Center the barcode
+	// Center the barcode, which leaves at least the quiet zone either side
 	x := (r.width - barcodeImg.Bounds().Dx()) / 2
 	
 	// Draw barcode
 	r.ctx.DrawImage(barcodeImg, x, int(r.y))
 	
-	r.y += float64(imgHeight) + 10
+	r.y += float64(imgHeight) + 4
+	
+	if cmd.Position == "below" || cmd.Position == "both" {
+		r.drawCaption(text, float64(r.width)/2)
+	}
+	
+	r.y += 6
 	
 	return nil
 }
 
+// drawCaption draws a line of text under or above a code, centered on centerX
+func (r *Renderer) drawCaption(text string, centerX float64) {
+	// The bundled font always loads
+	face, _ := loadFace(builtinFontPath("regular", false), barcodeTextSize)
+	r.ctx.SetFontFace(face)
+	
+	textWidth, _ := r.ctx.MeasureString(text)
+	textHeight := fontHeight(barcodeTextSize)
+	r.ensureHeight(int(textHeight) + 10)
+	r.ctx.SetFontFace(face)
+	
+	r.ctx.DrawString(text, centerX-textWidth/2, r.y+textHeight)
+	
+	r.y += textHeight + 4
+}
+
 func (r *Renderer) renderQRCode(cmd *receiptformat.Command) error {
 	if cmd.Value == "" {
 		return nil
 	}
 	
-	size := cmd.Size
-	if size == 0 {
-		size = 6
+	qr, err := qrcode.New(cmd.Value, qrRecoveryLevel(cmd.ErrorCorrection))
+	if err != nil {
+		return err
+	}
+	
+	// The bitmap includes the quiet zone
+	modules := len(qr.Bitmap())
+	module := QRModuleSize(cmd, modules, r.width, r.dpi)
+	if module == 0 {
+		return fmt.Errorf("QR code is %d modules wide, too wide for the paper", modules)
+	}
+	
+	qrImg := qr.Image(-module) // Negative sizes are dots per module
+	
+	// Ensure we have enough height
+	imgHeight := qrImg.Bounds().Dy()
+	r.ensureHeight(imgHeight + 20)
+	
+	imgWidth := qrImg.Bounds().Dx()
+	var x int
+	switch cmd.Align {
+	case "left":
+		x = 0
+	case "right":
+		x = r.width - imgWidth
+	default: // center
+		x = (r.width - imgWidth) / 2
 	}
 	
-	errorCorrection := qrcode.Medium
-	switch cmd.ErrorCorrection {
+	// Draw QR code
+	r.ctx.DrawImage(qrImg, x, int(r.y))
+	
+	r.y += float64(imgHeight)
+	
+	if cmd.Caption != "" {
+		r.drawCaption(cmd.Caption, float64(x)+float64(imgWidth)/2)
+	}
+	
+	r.y += 10
+	
+	return nil
+}
+
+// qrRecoveryLevel maps an error correction level to go-qrcode's names, which
+// run Low, Medium, High, Highest for L (7%), M (15%), Q (25%) and H (30%)
+func qrRecoveryLevel(level string) qrcode.RecoveryLevel {
+	switch level {
 	case "L":
-		errorCorrection = qrcode.Low
-	case "M":
-		errorCorrection = qrcode.Medium
+		return qrcode.Low
 	case "Q":
-		errorCorrection = qrcode.High
+		return qrcode.High
 	case "H":
-		errorCorrection = qrcode.Highest
+		return qrcode.Highest
+	}
+	return qrcode.Medium
+}
+
+// QRModules returns how many modules wide a QR code command is, including
+// its quiet zone
+func QRModules(cmd *receiptformat.Command) (int, error) {
+	qr, err := qrcode.New(cmd.Value, qrRecoveryLevel(cmd.ErrorCorrection))
+	if err != nil {
+		return 0, err
+	}
+	return len(qr.Bitmap()), nil
+}
+
+// QRModuleSize returns the dots per module for a QR code modules wide. A
+// width in dots or mm is rounded down to whole modules so they print
+// crisply; otherwise Size is used (default 6). Either way the code is made
+// smaller if needed to fit maxWidth, and 0 means even one dot per module
+// doesn't fit.
+func QRModuleSize(cmd *receiptformat.Command, modules, maxWidth, dpi int) int {
+	module := cmd.Size
+	switch {
+	case cmd.Width > 0:
+		module = cmd.Width / modules
+	case cmd.WidthMM > 0:
+		module = int(cmd.WidthMM*float64(dpi)/25.4) / modules
+	case module == 0:
+		module = 6
+	}
+	if module < 1 {
+		module = 1
+	}
+	if module*modules > maxWidth {
+		module = maxWidth / modules
+	}
+	return module
+}
+
+// EncodeBarcode creates a 1D barcode in one of receiptformat.BarcodeFormats
+func EncodeBarcode(format, value string) (barcode.Barcode, error) {
+	value, err := receiptformat.NormalizeBarcode(format, value)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Generate QR code
-	qr, err := qrcode.New(cmd.Value, errorCorrection)
+	switch format {
+	case "", "CODE128":
+		return code128.Encode(value)
+	case "CODE39":
+		return code39.Encode(value, false, false)
+	case "CODE93":
+		return code93.Encode(value, true, true)
+	case "EAN13", "EAN8":
+		return ean.Encode(value)
+	case "UPC_A":
+		// UPC-A is an EAN-13 with a leading zero
+		return ean.Encode("0" + value)
+	case "UPC_E":
+		return encodeUPCE(value), nil
+	case "ITF":
+		return twooffive.Encode(value, true)
+	case "CODABAR":
+		return codabar.Encode(value)
+	case "GS1_128":
+		return encodeGS1128(value)
+	}
+	return nil, fmt.Errorf("unsupported barcode format '%s'", format)
+}
+
+// encodeGS1128 creates a CODE128 barcode starting with FNC1, with another
+// FNC1 after each variable-length element that isn't last
+func encodeGS1128(value string) (barcode.Barcode, error) {
+	elements, err := receiptformat.ParseGS1(value)
+	if err != nil {
+		return nil, err
+	}
+	
+	var data strings.Builder
+	data.WriteRune(code128.FNC1)
+	for i, element := range elements {
+		data.WriteString(element.AI)
+		data.WriteString(element.Data)
+		if !element.Fixed() && i < len(elements)-1 {
+			data.WriteRune(code128.FNC1)
+		}
+	}
+	return code128.Encode(data.String())
+}
+
+// EAN/UPC digit patterns: odd parity (L) and even parity (G), 7 modules each
+var (
+	upcOddPatterns  = []string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	upcEvenPatterns = []string{"0100111", "0110011", "0011011", "0100001", "0011101", "0111001", "0000101", "0010001", "0001001", "0010111"}
+)
+
+// upcEParity gives the parity of each of the six digits for number system 0,
+// by check digit. Number system 1 uses the opposite parities.
+var upcEParity = []string{"EEEOOO", "EEOEOO", "EEOOEO", "EEOOOE", "EOEEOO", "EOOEEO", "EOOOEE", "EOEOEO", "EOEOOE", "EOOEOE"}
+
+// encodeUPCE draws a normalized UPC-E code: number system, six digits and
+// check digit. Only the six digits are drawn; the others set their parity.
+func encodeUPCE(code string) barcode.Barcode {
+	parity := upcEParity[code[7]-'0']
+	
+	var modules strings.Builder
+	modules.WriteString("101")
+	for i, c := range code[1:7] {
+		even := parity[i] == 'E'
+		if code[0] == '1' {
+			even = !even
+		}
+		if even {
+			modules.WriteString(upcEvenPatterns[c-'0'])
+		} else {
+			modules.WriteString(upcOddPatterns[c-'0'])
+		}
+	}
+	modules.WriteString("010101")
+	
+	bits := new(utils.BitList)
+	for _, m := range modules.String() {
+		bits.AddBit(m == '1')
+	}
+	return utils.New1DCode("UPC E", code, bits)
+}
+
+// render2DCode draws a PDF417, DataMatrix or Aztec code with square modules
+// of cmd.Size dots, made smaller if needed to fit the paper
+func (r *Renderer) render2DCode(cmd *receiptformat.Command) error {
+	if cmd.Value == "" {
+		return nil
+	}
+	
+	var code barcode.Barcode
+	var err error
+	module := cmd.Size
+	
+	switch cmd.Type {
+	case "pdf417":
+		level := cmd.ECCLevel
+		if level == 0 {
+			level = 2
+		}
+		code, err = pdf417.Encode(cmd.Value, byte(level))
+		if module == 0 {
+			module = 2
+		}
+	case "datamatrix":
+		code, err = datamatrix.Encode(cmd.Value)
+	case "aztec":
+		minECC := cmd.ECCLevel
+		if minECC == 0 {
+			minECC = 23
+		}
+		code, err = aztec.Encode([]byte(cmd.Value), minECC, 0)
+	default:
+		return fmt.Errorf("unsupported 2D code type: %s", cmd.Type)
+	}
 	if err != nil {
 		return err
 	}
 	
-	// Calculate size (make it fit printer width with margins)
-	qrSize := r.width - 100 // Leave margins
-	if qrSize > 400 {
-		qrSize = 400 // Max size
+	if module == 0 {
+		module = 4
+	}
+	bounds := code.Bounds()
+	if maxModule := (r.width - 40) / bounds.Dx(); module > maxModule {
+		module = maxModule
+	}
+	if module < 1 {
+		return fmt.Errorf("%s code is too wide for the paper", cmd.Type)
 	}
 	
-	qrImg := qr.Image(qrSize)
+	img, err := barcode.Scale(code, bounds.Dx()*module, bounds.Dy()*module)
+	if err != nil {
+		return err
+	}
 	
 	// Ensure we have enough height
-	imgHeight := qrImg.Bounds().Dy()
+	imgHeight := img.Bounds().Dy()
 	r.ensureHeight(imgHeight + 20)
 	
-	// Center the QR code
-	x := (r.width - qrImg.Bounds().Dx()) / 2
+	// Center the code
+	x := (r.width - img.Bounds().Dx()) / 2
 	
-	// Draw QR code
-	r.ctx.DrawImage(qrImg, x, int(r.y))
+	r.ctx.DrawImage(img, x, int(r.y))
 	
 	r.y += float64(imgHeight) + 10
 	
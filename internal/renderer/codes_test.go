@@ -0,0 +1,134 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+func TestEncodeBarcode_AllFormats(t *testing.T) {
+	values := map[string]string{
+		"EAN13":   "400638133393",
+		"EAN8":    "9638507",
+		"UPC_A":   "03600029145",
+		"UPC_E":   "0425261",
+		"ITF":     "12345678",
+		"CODE39":  "ABC-123",
+		"CODE93":  "Receipt 42",
+		"CODE128": "Receipt 42",
+		"CODABAR": "40156",
+		"GS1_128": "(01)09501101530003(10)ABC123(17)250101",
+	}
+	for _, format := range receiptformat.BarcodeFormats {
+		value, ok := values[format]
+		if !ok {
+			t.Errorf("No test value for %s", format)
+			continue
+		}
+		code, err := EncodeBarcode(format, value)
+		if err != nil {
+			t.Errorf("EncodeBarcode(%s) failed: %v", format, err)
+			continue
+		}
+		if code.Bounds().Dx() == 0 {
+			t.Errorf("EncodeBarcode(%s) produced an empty barcode", format)
+		}
+	}
+}
+
+func TestEncodeBarcode_UPCE(t *testing.T) {
+	code, err := EncodeBarcode("UPC_E", "0425261")
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	// Start guard, six 7-module digits and end guard
+	if code.Bounds().Dx() != 3+6*7+6 {
+		t.Errorf("Expected 51 modules, got %d", code.Bounds().Dx())
+	}
+	if code.Content() != "04252614" {
+		t.Errorf("Expected the check digit to be added, got %s", code.Content())
+	}
+}
+
+func TestRender2DCodes(t *testing.T) {
+	for _, typ := range []string{"pdf417", "datamatrix", "aztec"} {
+		r, err := New("80mm")
+		if err != nil {
+			t.Fatalf("Failed to create renderer: %v", err)
+		}
+		if err := r.RenderCommand(&receiptformat.Command{Type: typ, Value: "https://example.com/r/42"}); err != nil {
+			t.Errorf("Failed to render %s: %v", typ, err)
+		}
+	}
+}
+
+func TestRenderBarcode_ModuleWidth(t *testing.T) {
+	r, err := New("80mm")
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	if err := r.RenderCommand(&receiptformat.Command{Type: "barcode", Format: "EAN8", Value: "9638507", Width: 3}); err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+
+	// EAN-8 is 67 modules wide, so 201 dots at 3 dots per module
+	img := r.GetImage()
+	left, right := img.Bounds().Max.X, 0
+	for y := 0; y < 40; y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if gray, _, _, _ := img.At(x, y).RGBA(); gray < 0x8000 {
+				left, right = min(left, x), max(right, x)
+			}
+		}
+	}
+	if right-left+1 != 201 {
+		t.Errorf("Expected bars 201 dots wide, got %d", right-left+1)
+	}
+}
+
+func TestRenderBarcode_TooWide(t *testing.T) {
+	r, err := New("58mm")
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	cmd := &receiptformat.Command{Type: "barcode", Value: "ORDER-2024-000123456", Width: 4}
+	if err := r.RenderCommand(cmd); err == nil {
+		t.Error("Expected an error for a barcode wider than the paper")
+	}
+}
+
+func TestRenderBarcode_Text(t *testing.T) {
+	heights := map[string]int{}
+	for _, position := range []string{"none", "below", "both"} {
+		r, err := New("80mm")
+		if err != nil {
+			t.Fatalf("Failed to create renderer: %v", err)
+		}
+		if err := r.RenderCommand(&receiptformat.Command{Type: "barcode", Value: "12345", Position: position}); err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+		heights[position] = int(r.y)
+	}
+	if !(heights["none"] < heights["below"] && heights["below"] < heights["both"]) {
+		t.Errorf("Expected each line of text to add height, got %v", heights)
+	}
+}
+
+func TestQRModuleSize(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  receiptformat.Command
+		want int
+	}{
+		{"default", receiptformat.Command{}, 6},
+		{"module size", receiptformat.Command{Size: 3}, 3},
+		{"width in dots", receiptformat.Command{Width: 200}, 6},
+		{"width in mm", receiptformat.Command{WidthMM: 25}, 6}, // 199 dots at 203 DPI
+		{"too wide for the paper", receiptformat.Command{Width: 1000}, 17},
+	}
+	for _, tt := range tests {
+		if got := QRModuleSize(&tt.cmd, 33, 576, 203); got != tt.want {
+			t.Errorf("%s: QRModuleSize() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Dither methods turn a greyscale image into the black and white dots a
+// thermal printer can print
+const (
+	DitherNone           = "none"            // Keep the greys; the printer thresholds them
+	DitherThreshold      = "threshold"       // Hard threshold, best for logos and line art
+	DitherFloydSteinberg = "floyd-steinberg" // Error diffusion, best for photos
+	DitherAtkinson       = "atkinson"        // Lighter error diffusion with more contrast
+	DitherBayer          = "bayer"           // 8x8 ordered dither, a regular pattern
+)
+
+// DitherOptions controls how an image is converted for printing
+type DitherOptions struct {
+	Method     string  // One of the Dither methods, threshold if empty
+	Threshold  uint8   // Grey level below which a dot prints, 128 if zero
+	Gamma      float64 // Above 1 lightens midtones, below 1 darkens them; 0 means 1
+	Contrast   int     // -100 to 100
+	Brightness int     // -100 to 100
+}
+
+// bayer8 is the 8x8 Bayer threshold matrix
+var bayer8 = [8][8]float64{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// Error diffusion kernels: the share of a pixel's error passed to each neighbour
+var (
+	floydSteinberg = []diffusion{
+		{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+	}
+	// Atkinson only passes on 6/8 of the error, which keeps highlights clean
+	atkinson = []diffusion{
+		{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8}, {-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8}, {0, 2, 1.0 / 8},
+	}
+)
+
+// diffusion passes a share of a pixel's error to the pixel at (dx, dy)
+type diffusion struct {
+	dx, dy int
+	share  float64
+}
+
+// Dither converts an image to black and white (or adjusted grey for
+// DitherNone). Transparent pixels count as paper.
+func Dither(img image.Image, opts DitherOptions) *image.Gray {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	out := image.NewGray(image.Rect(0, 0, width, height))
+
+	threshold := float64(opts.Threshold)
+	if threshold == 0 {
+		threshold = 128
+	}
+	levels := adjustLevels(opts)
+
+	var kernel []diffusion
+	switch opts.Method {
+	case DitherFloydSteinberg:
+		kernel = floydSteinberg
+	case DitherAtkinson:
+		kernel = atkinson
+	}
+
+	// Error carried into this row and the next two, with room either side
+	// for kernels that reach past the edges
+	var carried [3][]float64
+	for i := range carried {
+		carried[i] = make([]float64, width+4)
+	}
+
+	for y := 0; y < height; y++ {
+		row := out.Pix[y*out.Stride:]
+		for x := 0; x < width; x++ {
+			v := levels[luminance(img.At(bounds.Min.X+x, bounds.Min.Y+y))] + carried[0][x+2]
+
+			var dot float64
+			switch opts.Method {
+			case DitherNone:
+				dot = v
+			case DitherBayer:
+				dot = blackOrWhite(v, (bayer8[y%8][x%8]+0.5)*256/64)
+			default:
+				dot = blackOrWhite(v, threshold)
+			}
+
+			for _, d := range kernel {
+				carried[d.dy][x+2+d.dx] += (v - dot) * d.share
+			}
+
+			row[x] = uint8(math.Round(math.Max(0, math.Min(255, dot))))
+		}
+
+		carried[0], carried[1], carried[2] = carried[1], carried[2], carried[0]
+		clear(carried[2])
+	}
+
+	return out
+}
+
+func blackOrWhite(v, threshold float64) float64 {
+	if v < threshold {
+		return 0
+	}
+	return 255
+}
+
+// luminance returns a pixel's perceived brightness (0-255, Rec. 601 weights),
+// composited over white paper
+func luminance(c color.Color) uint8 {
+	r, g, b, a := c.RGBA()
+	// Colours are alpha-premultiplied, so add the paper showing through
+	y := (299*r + 587*g + 114*b) / 1000
+	y += 0xFFFF - a
+	return uint8(y >> 8)
+}
+
+// adjustLevels builds a lookup table applying brightness, contrast and gamma
+func adjustLevels(opts DitherOptions) [256]float64 {
+	gamma := opts.Gamma
+	if gamma <= 0 {
+		gamma = 1
+	}
+	contrast := float64(opts.Contrast) / 100
+	brightness := float64(opts.Brightness) / 100
+
+	var levels [256]float64
+	for i := range levels {
+		v := float64(i) / 255
+
+		v = math.Pow(v, 1/gamma)
+		v = (v-0.5)*(1+contrast) + 0.5
+		v += brightness
+
+		levels[i] = math.Max(0, math.Min(1, v)) * 255
+	}
+	return levels
+}
@@ -0,0 +1,79 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// greyImage returns a width x height image filled with one grey level
+func greyImage(width, height int, level uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = level
+	}
+	return img
+}
+
+// blackRatio returns the share of pixels that print
+func blackRatio(img *image.Gray) float64 {
+	black := 0
+	for _, v := range img.Pix {
+		if v == 0 {
+			black++
+		}
+	}
+	return float64(black) / float64(len(img.Pix))
+}
+
+func TestDither_Threshold(t *testing.T) {
+	if got := blackRatio(Dither(greyImage(16, 16, 100), DitherOptions{})); got != 1 {
+		t.Errorf("Expected dark grey to print solid, got %.2f", got)
+	}
+	if got := blackRatio(Dither(greyImage(16, 16, 100), DitherOptions{Threshold: 90})); got != 0 {
+		t.Errorf("Expected grey above the threshold not to print, got %.2f", got)
+	}
+}
+
+func TestDither_MidGrey(t *testing.T) {
+	// Every dithering method should print roughly half of a mid-grey square
+	for _, method := range []string{DitherFloydSteinberg, DitherBayer} {
+		got := blackRatio(Dither(greyImage(64, 64, 128), DitherOptions{Method: method}))
+		if got < 0.4 || got > 0.6 {
+			t.Errorf("%s: expected about half the dots to print, got %.2f", method, got)
+		}
+	}
+
+	// Atkinson drops a quarter of the error, so it prints less
+	got := blackRatio(Dither(greyImage(64, 64, 128), DitherOptions{Method: DitherAtkinson}))
+	if got < 0.2 || got > 0.6 {
+		t.Errorf("atkinson: expected some of the dots to print, got %.2f", got)
+	}
+}
+
+func TestDither_Transparent(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	img.SetNRGBA(0, 0, color.NRGBA{A: 255})
+
+	out := Dither(img, DitherOptions{})
+	if out.GrayAt(0, 0).Y != 0 {
+		t.Error("Expected an opaque black pixel to print")
+	}
+	if out.GrayAt(1, 1).Y != 255 {
+		t.Error("Expected transparent pixels to be paper")
+	}
+}
+
+func TestDither_Adjustments(t *testing.T) {
+	img := greyImage(8, 8, 100)
+
+	if got := blackRatio(Dither(img, DitherOptions{Brightness: 30})); got != 0 {
+		t.Errorf("Expected brightness to lift dark grey above the threshold, got %.2f", got)
+	}
+	if got := blackRatio(Dither(img, DitherOptions{Gamma: 2})); got != 0 {
+		t.Errorf("Expected gamma 2 to lighten the midtones, got %.2f", got)
+	}
+	if got := Dither(img, DitherOptions{Method: DitherNone}).GrayAt(0, 0).Y; got != 100 {
+		t.Errorf("Expected none to keep the grey level, got %d", got)
+	}
+}
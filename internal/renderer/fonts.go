@@ -0,0 +1,292 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// builtinPrefix marks font paths that name a bundled font instead of a file
+const builtinPrefix = "builtin:"
+
+// builtinFonts are bundled into the binary so receipts without their own
+// fonts render the same on every host
+var builtinFonts = map[string][]byte{
+	builtinPrefix + "regular":     goregular.TTF,
+	builtinPrefix + "bold":        gobold.TTF,
+	builtinPrefix + "italic":      goitalic.TTF,
+	builtinPrefix + "bold-italic": gobolditalic.TTF,
+}
+
+// builtinFontPath returns the bundled font closest to a weight and style
+func builtinFontPath(weight string, italic bool) string {
+	variant := "regular"
+	switch strings.ToLower(weight) {
+	case "bold", "semibold", "extrabold", "black", "heavy", "600", "700", "800", "900":
+		variant = "bold"
+	}
+	if italic {
+		if variant == "regular" {
+			variant = "italic"
+		} else {
+			variant += "-italic"
+		}
+	}
+	return builtinPrefix + variant
+}
+
+// fontHeight is the line height of a font size, as gg measures a font it
+// loads itself. Receipts were laid out with it before faces were cached.
+func fontHeight(size float64) float64 {
+	return size * 72 / 96
+}
+
+type faceKey struct {
+	path string
+	size float64
+}
+
+// fontCache holds parsed fonts and their faces for the whole process, so a
+// font file is read once however many receipts and commands use it
+var fontCache = struct {
+	sync.Mutex
+	fonts map[string]*truetype.Font
+	faces map[faceKey]font.Face
+}{
+	fonts: make(map[string]*truetype.Font),
+	faces: make(map[faceKey]font.Face),
+}
+
+// fallbackFonts are font files tried, in order, for characters missing from
+// a receipt's fonts and their fallbacks
+var fallbackFonts struct {
+	sync.RWMutex
+	paths []string
+}
+
+// SetFallbackFonts sets font files used for characters no receipt font has,
+// such as a CJK or Arabic font for the whole server
+func SetFallbackFonts(paths []string) {
+	fallbackFonts.Lock()
+	defer fallbackFonts.Unlock()
+	fallbackFonts.paths = append([]string(nil), paths...)
+}
+
+// parseFont returns the parsed font for a font file or bundled font
+func parseFont(path string) (*truetype.Font, error) {
+	if f, ok := fontCache.fonts[path]; ok {
+		return f, nil
+	}
+
+	data, builtin := builtinFonts[path]
+	if !builtin {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	fontCache.fonts[path] = f
+	return f, nil
+}
+
+// loadFace returns a face for a font file or bundled font at a size in points
+func loadFace(path string, size float64) (font.Face, error) {
+	face, _, err := loadFontFace(path, size)
+	return face, err
+}
+
+// loadFontFace is loadFace, also returning the font for checking which
+// characters it has
+func loadFontFace(path string, size float64) (font.Face, *truetype.Font, error) {
+	fontCache.Lock()
+	defer fontCache.Unlock()
+
+	f, err := parseFont(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := faceKey{path, size}
+	if face, ok := fontCache.faces[key]; ok {
+		return face, f, nil
+	}
+
+	face := &lockedFace{face: truetype.NewFace(f, &truetype.Options{Size: size})}
+	fontCache.faces[key] = face
+	return face, f, nil
+}
+
+// fontFace returns the face for a font family, weight and style at a size.
+// Fonts the receipt declares must load; anything else uses a bundled font.
+// Characters the font lacks are drawn from the family's fallbacks, then the
+// server's fallback fonts, then the bundled font.
+func (r *Renderer) fontFace(family, weight string, italic bool, size float64) (font.Face, error) {
+	if family == "" {
+		family = "default"
+	}
+
+	// Each family's own font, then its fallbacks in order
+	var paths []string
+	seen := map[string]bool{}
+	var addFamily func(name string)
+	addFamily = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		paths = append(paths, r.getFontPath(name, weight, italic))
+
+		if r.receipt != nil {
+			for _, fallback := range r.receipt.Fonts[name].Fallbacks {
+				addFamily(fallback)
+			}
+		}
+	}
+	addFamily(family)
+
+	faces := &fallbackFace{}
+	for i, path := range paths {
+		face, f, err := loadFontFace(path, size)
+		if err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("failed to load font '%s': %w", family, err)
+			}
+			return nil, fmt.Errorf("failed to load fallback font for '%s': %w", family, err)
+		}
+		faces.add(face, f)
+	}
+
+	// The server's fallbacks are optional; one that won't load is skipped
+	fallbackFonts.RLock()
+	optional := append(append([]string(nil), fallbackFonts.paths...), builtinFontPath(weight, italic))
+	fallbackFonts.RUnlock()
+	for _, path := range optional {
+		if face, f, err := loadFontFace(path, size); err == nil {
+			faces.add(face, f)
+		}
+	}
+
+	if len(faces.faces) == 1 {
+		return faces.faces[0], nil
+	}
+	return faces, nil
+}
+
+// fallbackFace draws each character in the first of its faces that has it
+type fallbackFace struct {
+	faces []font.Face
+	fonts []*truetype.Font
+}
+
+func (f *fallbackFace) add(face font.Face, fnt *truetype.Font) {
+	for _, existing := range f.fonts {
+		if existing == fnt {
+			return // Already in the chain
+		}
+	}
+	f.faces = append(f.faces, face)
+	f.fonts = append(f.fonts, fnt)
+}
+
+// pick returns the face for a character, the first face if none has it
+func (f *fallbackFace) pick(r rune) int {
+	for i, fnt := range f.fonts {
+		if fnt.Index(r) != 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+func (f *fallbackFace) Close() error {
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphAdvance(r)
+}
+
+// Kern only applies between characters from the same face
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	if i := f.pick(r0); i == f.pick(r1) {
+		return f.faces[i].Kern(r0, r1)
+	}
+	return 0
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
+
+// lockedFace lets renderers on different goroutines share a cached face.
+// Truetype faces keep a glyph cache that isn't safe for concurrent use.
+type lockedFace struct {
+	mu   sync.Mutex
+	face font.Face
+}
+
+func (f *lockedFace) Close() error {
+	return nil // Shared by the cache, so never closed
+}
+
+// Glyph copies the mask, which points into the face's glyph cache and can be
+// overwritten once the lock is released
+func (f *lockedFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dr, mask, maskp, advance, ok := f.face.Glyph(dot, r)
+	if !ok || mask == nil {
+		return dr, mask, maskp, advance, ok
+	}
+	copied := image.NewAlpha(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	draw.Draw(copied, copied.Bounds(), mask, maskp, draw.Src)
+	return dr, copied, image.Point{}, advance, ok
+}
+
+func (f *lockedFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.GlyphBounds(r)
+}
+
+func (f *lockedFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.GlyphAdvance(r)
+}
+
+func (f *lockedFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.Kern(r0, r1)
+}
+
+func (f *lockedFace) Metrics() font.Metrics {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.Metrics()
+}
@@ -0,0 +1,108 @@
+package renderer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+func TestLoadFace_Cached(t *testing.T) {
+	first, err := loadFace(builtinFontPath("bold", false), 24)
+	if err != nil {
+		t.Fatalf("Failed to load bundled font: %v", err)
+	}
+	second, _ := loadFace(builtinFontPath("bold", false), 24)
+	if first != second {
+		t.Error("Expected the same face for the same font and size")
+	}
+	if other, _ := loadFace(builtinFontPath("bold", false), 32); other == first {
+		t.Error("Expected a different face for a different size")
+	}
+}
+
+func TestBuiltinFontPath(t *testing.T) {
+	tests := []struct {
+		weight string
+		italic bool
+		want   string
+	}{
+		{"regular", false, "builtin:regular"},
+		{"bold", false, "builtin:bold"},
+		{"700", true, "builtin:bold-italic"},
+		{"light", true, "builtin:italic"},
+	}
+	for _, tt := range tests {
+		if got := builtinFontPath(tt.weight, tt.italic); got != tt.want {
+			t.Errorf("builtinFontPath(%q, %v) = %q, want %q", tt.weight, tt.italic, got, tt.want)
+		}
+	}
+}
+
+func TestRenderText_MissingDeclaredFont(t *testing.T) {
+	r, err := New("80mm")
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	r.SetReceipt(&receiptformat.Receipt{
+		Fonts: map[string]receiptformat.FontFamily{
+			"brand": {Type: "variable", Path: "/nonexistent/brand.ttf"},
+		},
+	})
+
+	err = r.RenderCommand(&receiptformat.Command{Type: "text", Value: "Hello", FontFamily: "brand"})
+	if err == nil || !strings.Contains(err.Error(), "brand") {
+		t.Errorf("Expected an error naming the font, got %v", err)
+	}
+
+	// Undeclared families use the bundled font
+	if err := r.RenderCommand(&receiptformat.Command{Type: "text", Value: "Hello", FontFamily: "serif"}); err != nil {
+		t.Errorf("Expected the bundled font for an undeclared family, got %v", err)
+	}
+}
+
+func TestFontFace_Fallbacks(t *testing.T) {
+	dir := t.TempDir()
+	brand := filepath.Join(dir, "brand.ttf")
+	symbols := filepath.Join(dir, "symbols.ttf")
+	os.WriteFile(brand, gomono.TTF, 0644)
+	os.WriteFile(symbols, gobold.TTF, 0644)
+
+	r, _ := New("80mm")
+	r.SetReceipt(&receiptformat.Receipt{
+		Fonts: map[string]receiptformat.FontFamily{
+			"brand":   {Type: "variable", Path: brand, Fallbacks: []string{"symbols"}},
+			"symbols": {Type: "variable", Path: symbols, Fallbacks: []string{"brand"}},
+		},
+	})
+
+	face, err := r.fontFace("brand", "regular", false, 24)
+	if err != nil {
+		t.Fatalf("Failed to load font: %v", err)
+	}
+	chain, ok := face.(*fallbackFace)
+	if !ok {
+		t.Fatalf("Expected a fallback chain, got %T", face)
+	}
+
+	// The family, its fallback (whose own fallback loops back), then the bundled font
+	if len(chain.faces) != 3 {
+		t.Errorf("Expected 3 faces, got %d", len(chain.faces))
+	}
+	if chain.pick('A') != 0 {
+		t.Error("Expected characters the family has to use it")
+	}
+
+	os.Remove(symbols)
+	fontCache.Lock()
+	delete(fontCache.fonts, symbols)
+	fontCache.Unlock()
+	if _, err := r.fontFace("brand", "regular", false, 25); err == nil {
+		t.Error("Expected an error for a fallback font that can't be loaded")
+	}
+}
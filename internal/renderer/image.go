@@ -1,62 +1,60 @@
 package renderer
 
 import (
+	"bytes"
 	"encoding/base64"
+	"fmt"
 	"image"
-	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"os"
-	"strings"
 	
 	"github.com/disintegration/imaging"
+	"github.com/thereceipt/receipt-engine/internal/imagecache"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
 func (r *Renderer) renderImage(cmd *receiptformat.Command) error {
-	var img image.Image
-	var err error
+	data, err := loadImageData(cmd)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
 	
-	if cmd.Base64 != "" {
-		// Decode base64
-		data, decodeErr := base64.StdEncoding.DecodeString(cmd.Base64)
-		if decodeErr != nil {
-			return decodeErr
-		}
-		
-		img, _, err = image.Decode(strings.NewReader(string(data)))
+	opts := DitherOptions{
+		Method:     cmd.Dither,
+		Threshold:  uint8(cmd.Threshold),
+		Gamma:      cmd.Gamma,
+		Contrast:   cmd.Contrast,
+		Brightness: cmd.Brightness,
+	}
+	
+	// The same logo printed at the same width comes out the same every time,
+	// so reuse the resized and dithered image instead of redoing it
+	cache := imagecache.Default()
+	variant := fmt.Sprintf("width=%d %+v", r.width, opts)
+	bwImg, ok := cache.Variant(data, variant)
+	if !ok {
+		img, _, err := image.Decode(bytes.NewReader(data))
 		if err != nil {
 			return err
 		}
-	} else if cmd.Path != "" {
-		// Load from file
-		file, err := os.Open(cmd.Path)
-		if err != nil {
-			return err
+		
+		// Resize to fit printer width
+		if img.Bounds().Dx() != r.width {
+			img = imaging.Resize(img, r.width, 0, imaging.Lanczos)
 		}
-		defer file.Close()
 		
-		img, _, err = image.Decode(file)
-		if err != nil {
-			return err
+		// Convert to 1-bit (black & white) with the requested dithering
+		bwImg = Dither(img, opts)
+		
+		if err := cache.StoreVariant(data, variant, bwImg); err != nil {
+			// Warning: failed to cache the image - it will be processed again next time
 		}
-	} else {
-		return nil
 	}
 	
-	// Resize to fit printer width
-	if img.Bounds().Dx() != r.width {
-		img = imaging.Resize(img, r.width, 0, imaging.Lanczos)
-	}
-	
-	// Convert to 1-bit (black & white) with threshold
-	threshold := cmd.Threshold
-	if threshold == 0 {
-		threshold = 128
-	}
-	
-	bwImg := convertToBlackWhite(img, uint8(threshold))
-	
 	// Ensure we have enough height
 	imgHeight := bwImg.Bounds().Dy()
 	r.ensureHeight(imgHeight)
@@ -69,29 +67,15 @@ func (r *Renderer) renderImage(cmd *receiptformat.Command) error {
 	return nil
 }
 
-func convertToBlackWhite(img image.Image, threshold uint8) image.Image {
-	bounds := img.Bounds()
-	bw := image.NewGray(bounds)
-	
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			oldPixel := img.At(x, y)
-			r, g, b, _ := oldPixel.RGBA()
-			
-			// Convert to grayscale
-			gray := uint8((r + g + b) / 3 / 256)
-			
-			// Apply threshold
-			var newGray uint8
-			if gray < threshold {
-				newGray = 0 // Black
-			} else {
-				newGray = 255 // White
-			}
-			
-			bw.SetGray(x, y, color.Gray{Y: newGray})
-		}
+// loadImageData returns the encoded image an image command refers to, or nil if it has none
+func loadImageData(cmd *receiptformat.Command) ([]byte, error) {
+	switch {
+	case cmd.Base64 != "":
+		return base64.StdEncoding.DecodeString(cmd.Base64)
+	case cmd.Path != "":
+		return os.ReadFile(cmd.Path)
+	case cmd.URL != "":
+		return imagecache.Default().Fetch(cmd.URL)
 	}
-	
-	return bw
+	return nil, nil
 }
@@ -5,7 +5,6 @@ import (
 	"image"
 	"image/color"
 	
-	"github.com/fogleman/gg"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
@@ -28,39 +27,21 @@ func (r *Renderer) renderItem(cmd *receiptformat.Command) error {
 	rightWidth := availableWidth - leftWidth
 	
 	// Render left side to its own context
-	leftCtx := gg.NewContext(leftWidth, 1000)
-	leftCtx.SetColor(color.White)
-	leftCtx.Clear()
-	leftCtx.SetColor(color.Black)
-	
-	leftRenderer := &Renderer{
-		width:  leftWidth,
-		height: 1000,
-		ctx:    leftCtx,
-		y:      0,
-	}
-	
+	leftRenderer := r.child(leftWidth)
 	for _, subCmd := range cmd.LeftSide {
-		leftRenderer.renderCommand(&subCmd)
+		if err := leftRenderer.renderCommand(&subCmd); err != nil {
+			return err
+		}
 	}
 	
 	leftImg := leftRenderer.cropToContent()
 	
 	// Render right side
-	rightCtx := gg.NewContext(rightWidth, 1000)
-	rightCtx.SetColor(color.White)
-	rightCtx.Clear()
-	rightCtx.SetColor(color.Black)
-	
-	rightRenderer := &Renderer{
-		width:  rightWidth,
-		height: 1000,
-		ctx:    rightCtx,
-		y:      0,
-	}
-	
+	rightRenderer := r.child(rightWidth)
 	for _, subCmd := range cmd.RightSide {
-		rightRenderer.renderCommand(&subCmd)
+		if err := rightRenderer.renderCommand(&subCmd); err != nil {
+			return err
+		}
 	}
 	
 	rightImg := rightRenderer.cropToContent()
@@ -76,6 +57,7 @@ func (r *Renderer) renderItem(cmd *receiptformat.Command) error {
 	
 	// Draw left side
 	r.ctx.DrawImage(leftImg, 0, int(r.y))
+	r.adoptControls(int(r.y), leftRenderer, rightRenderer)
 	
 	// Draw divider if needed
 	if cmd.ShowDivider {
@@ -144,17 +126,7 @@ func (r *Renderer) renderBox(cmd *receiptformat.Command) error {
 	
 	// Render box contents to temporary context
 	contentWidth := width - 2*border - 2*padding
-	contentCtx := gg.NewContext(contentWidth, 2000)
-	contentCtx.SetColor(color.White)
-	contentCtx.Clear()
-	contentCtx.SetColor(color.Black)
-	
-	contentRenderer := &Renderer{
-		width:  contentWidth,
-		height: 2000,
-		ctx:    contentCtx,
-		y:      0,
-	}
+	contentRenderer := r.child(contentWidth)
 	
 	// Render title if present
 	if cmd.Title != "" {
@@ -165,12 +137,16 @@ func (r *Renderer) renderBox(cmd *receiptformat.Command) error {
 			Weight: "bold",
 			Align:  "center",
 		}
-		contentRenderer.renderCommand(&titleCmd)
+		if err := contentRenderer.renderCommand(&titleCmd); err != nil {
+			return err
+		}
 	}
 	
 	// Render nested commands
 	for _, subCmd := range cmd.Commands {
-		contentRenderer.renderCommand(&subCmd)
+		if err := contentRenderer.renderCommand(&subCmd); err != nil {
+			return err
+		}
 	}
 	
 	contentImg := contentRenderer.cropToContent()
@@ -235,6 +211,7 @@ func (r *Renderer) renderBox(cmd *receiptformat.Command) error {
 	// Draw content (inverted if needed)
 	contentX := boxX + border + padding
 	contentY := boxY + border + padding
+	r.adoptControls(contentY, contentRenderer)
 	
 	if cmd.Inverted {
 		// Invert content colors
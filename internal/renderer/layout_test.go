@@ -0,0 +1,58 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+func TestRenderBox_Controls(t *testing.T) {
+	r, err := New("80mm")
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	r.RenderCommand(&receiptformat.Command{Type: "feed", Lines: 2})
+	err = r.RenderCommand(&receiptformat.Command{
+		Type: "box",
+		Commands: []receiptformat.Command{
+			{Type: "text", Value: "Paid"},
+			{Type: "drawer", Pin: 2},
+			{Type: "cut"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to render box: %v", err)
+	}
+
+	controls := r.Controls()
+	if len(controls) != 2 || controls[0].Type != ControlDrawer || controls[1].Type != ControlCut {
+		t.Fatalf("Expected the box's drawer kick and cut, got %+v", controls)
+	}
+	// Offset by the feed above the box, its border and its padding
+	if controls[0].Y <= 40+2+10 {
+		t.Errorf("Expected the drawer kick below the box's text, got y=%d", controls[0].Y)
+	}
+}
+
+func TestRenderItem_InheritsReceipt(t *testing.T) {
+	r, err := New("80mm")
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	r.SetReceipt(&receiptformat.Receipt{
+		Fonts: map[string]receiptformat.FontFamily{
+			"brand": {Type: "variable", Path: "/nonexistent/brand.ttf"},
+		},
+	})
+
+	err = r.RenderCommand(&receiptformat.Command{
+		Type:      "item",
+		LeftSide:  []receiptformat.Command{{Type: "text", Value: "Coffee", FontFamily: "brand"}},
+		RightSide: []receiptformat.Command{{Type: "text", Value: "$3.50"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "brand") {
+		t.Errorf("Expected the column's font error, got %v", err)
+	}
+}
@@ -1,6 +1,10 @@
 package renderer
 
 import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+	"github.com/thereceipt/receipt-engine/internal/profile"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
@@ -8,3 +12,31 @@ import (
 func (r *Renderer) RenderCommand(cmd *receiptformat.Command) error {
 	return r.renderCommand(cmd)
 }
+
+// Controls returns the cuts and drawer kicks recorded so far, in the order they occur
+func (r *Renderer) Controls() []Control {
+	return append([]Control(nil), r.controls...)
+}
+
+// PaperWidthPixels returns the printable width in dots for a paper width
+func PaperWidthPixels(paperWidth string) int {
+	return paperWidthToPixels(paperWidth)
+}
+
+// SetProfile narrows the canvas to what the printer can actually print, so a
+// printer with a 72mm printable area on 80mm paper doesn't clip the right
+// edge. Call it before rendering anything.
+func (r *Renderer) SetProfile(p *profile.Profile) {
+	r.dpi = p.Resolution()
+
+	width := p.Width(r.width)
+	if width == r.width {
+		return
+	}
+
+	r.width = width
+	r.ctx = gg.NewContext(r.width, r.height)
+	r.ctx.SetColor(color.White)
+	r.ctx.Clear()
+	r.ctx.SetColor(color.Black)
+}
@@ -5,18 +5,41 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"sort"
 	
 	"github.com/fogleman/gg"
+	"github.com/thereceipt/receipt-engine/internal/profile"
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
 // Renderer converts receipt commands to images
 type Renderer struct {
-	width   int // Paper width in pixels
-	height  int // Current canvas height
-	ctx     *gg.Context
-	y       float64 // Current Y position
-	receipt *receiptformat.Receipt // For accessing fonts
+	width    int                    // Paper width in pixels
+	height   int                    // Current canvas height
+	ctx      *gg.Context
+	y        float64                // Current Y position
+	dpi      int                    // For sizes given in mm
+	receipt  *receiptformat.Receipt // For accessing fonts
+	controls []Control              // Cuts and drawer kicks, in receipt order
+}
+
+// Control types
+const (
+	ControlCut    = "cut"
+	ControlDrawer = "drawer"
+)
+
+// Control is a printer action at a point in the receipt, such as a paper cut
+// or a cash drawer kick. Everything above Y prints before it and everything
+// below it after.
+type Control struct {
+	Type    string `json:"type"`
+	Y       int    `json:"y"`
+	Partial bool   `json:"partial,omitempty"`  // Cut: leave a small uncut bridge
+	Feed    int    `json:"feed,omitempty"`     // Cut: extra lines fed before cutting
+	Pin     int    `json:"pin,omitempty"`      // Drawer: kick-out connector pin, 2 or 5
+	OnTime  int    `json:"on_time,omitempty"`  // Drawer: pulse on time in ms
+	OffTime int    `json:"off_time,omitempty"` // Drawer: pulse off time in ms
 }
 
 // New creates a new renderer
@@ -36,6 +59,7 @@ func New(paperWidth string) (*Renderer, error) {
 		height: initialHeight,
 		ctx:    ctx,
 		y:      0,
+		dpi:    profile.DefaultDPI,
 	}, nil
 }
 
@@ -64,6 +88,8 @@ func (r *Renderer) renderCommand(cmd *receiptformat.Command) error {
 		return r.renderFeed(cmd)
 	case "cut":
 		return r.renderCut(cmd)
+	case "drawer":
+		return r.renderDrawer(cmd)
 	case "divider":
 		return r.renderDivider(cmd)
 	case "image":
@@ -72,6 +98,8 @@ func (r *Renderer) renderCommand(cmd *receiptformat.Command) error {
 		return r.renderBarcode(cmd)
 	case "qrcode":
 		return r.renderQRCode(cmd)
+	case "pdf417", "datamatrix", "aztec":
+		return r.render2DCode(cmd)
 	case "item":
 		return r.renderItem(cmd)
 	case "box":
@@ -117,6 +145,7 @@ func (r *Renderer) ensureHeight(neededHeight int) {
 		newCtx := gg.NewContext(r.width, newHeight)
 		newCtx.SetColor(color.White)
 		newCtx.Clear()
+		newCtx.SetColor(color.Black)
 		
 		// Copy existing content
 		newCtx.DrawImage(r.ctx.Image(), 0, 0)
@@ -126,6 +155,43 @@ func (r *Renderer) ensureHeight(neededHeight int) {
 	}
 }
 
+// child returns a renderer for a column or box of the given width. It shares
+// the receipt's fonts and the printer's resolution with r.
+func (r *Renderer) child(width int) *Renderer {
+	height := 1000
+
+	ctx := gg.NewContext(width, height)
+	ctx.SetColor(color.White)
+	ctx.Clear()
+	ctx.SetColor(color.Black)
+
+	return &Renderer{
+		width:   width,
+		height:  height,
+		ctx:     ctx,
+		y:       0,
+		dpi:     r.dpi,
+		receipt: r.receipt,
+	}
+}
+
+// adoptControls records the cuts and drawer kicks of child renderers whose
+// content was drawn at y, keeping them in receipt order
+func (r *Renderer) adoptControls(y int, children ...*Renderer) {
+	var controls []Control
+	for _, child := range children {
+		for _, control := range child.controls {
+			control.Y += y
+			controls = append(controls, control)
+		}
+	}
+
+	sort.SliceStable(controls, func(i, j int) bool {
+		return controls[i].Y < controls[j].Y
+	})
+	r.controls = append(r.controls, controls...)
+}
+
 func paperWidthToPixels(width string) int {
 	switch width {
 	case "58mm":
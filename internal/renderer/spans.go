@@ -0,0 +1,398 @@
+package renderer
+
+import (
+	"image/color"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/text/unicode/bidi"
+
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+// spanPiece is a word, a space or a line break from a span, measured in the
+// span's font
+type spanPiece struct {
+	text   string
+	span   receiptformat.Span // With the text command's defaults filled in
+	face   font.Face
+	width  float64
+	height float64 // Font height
+	space  bool
+	brk    bool // Newline
+
+	breakBefore bool // A line can break before this piece though no space precedes it
+}
+
+// spanLine is a line of laid out pieces
+type spanLine struct {
+	pieces []spanPiece
+	width  float64
+	height float64 // Tallest piece
+}
+
+// renderSpans lays out a text command's spans on shared baselines, wrapping
+// between words like plain text
+func (r *Renderer) renderSpans(cmd *receiptformat.Command) error {
+	var pieces []spanPiece
+
+	for _, span := range cmd.Spans {
+		if span.Size == 0 {
+			span.Size = cmd.Size
+		}
+		if span.Size == 0 {
+			span.Size = 32
+		}
+		if span.Weight == "" {
+			span.Weight = cmd.Weight
+		}
+		if span.Weight == "" {
+			span.Weight = "normal"
+		}
+		span.Italic = span.Italic || cmd.Italic
+
+		face, err := r.fontFace(cmd.FontFamily, span.Weight, span.Italic, float64(span.Size))
+		if err != nil {
+			return err
+		}
+		span.Value = shapeArabic(span.Value)
+		for _, token := range splitSpan(span.Value) {
+			piece := spanPiece{
+				text:   token,
+				span:   span,
+				face:   face,
+				height: fontHeight(float64(span.Size)),
+				space:  token == " ",
+				brk:    token == "\n",
+			}
+			if !piece.brk {
+				piece.width = r.measureWith(face, token)
+			}
+			pieces = append(pieces, piece)
+		}
+	}
+
+	// Chinese and Japanese words can break between characters, even across spans
+	for i := 1; i < len(pieces); i++ {
+		prev, piece := pieces[i-1], &pieces[i]
+		if !prev.space && !prev.brk && !piece.space && !piece.brk {
+			last, _ := utf8.DecodeLastRuneInString(prev.text)
+			first, _ := utf8.DecodeRuneInString(piece.text)
+			piece.breakBefore = canBreakBetween(last, first)
+		}
+	}
+
+	maxWidth := float64(r.width - 10)
+	lines := layoutSpans(pieces, maxWidth, r.measureWith)
+	if cmd.MaxLines > 0 && len(lines) > cmd.MaxLines {
+		lines = lines[:cmd.MaxLines]
+		r.endWithEllipsis(&lines[len(lines)-1], maxWidth)
+	}
+
+	var text strings.Builder
+	for _, span := range cmd.Spans {
+		text.WriteString(span.Value)
+	}
+	rtl := isRTL(text.String())
+	if ContainsRTL(text.String()) {
+		for i := range lines {
+			reorderPieces(&lines[i], rtl)
+		}
+	}
+
+	// Right to left text lines up on the right unless told otherwise
+	align := cmd.Align
+	if align == "" && rtl {
+		align = "right"
+	}
+
+	lineSpacing := cmd.LineSpacing
+	if lineSpacing == 0 {
+		lineSpacing = 1.25
+	}
+
+	totalHeight := 0.0
+	for i, line := range lines {
+		if i < len(lines)-1 {
+			totalHeight += line.height * lineSpacing
+		} else {
+			totalHeight += line.height
+		}
+	}
+
+	// Ensure we have enough height. A grown canvas has its own font, but
+	// every piece sets its face before drawing.
+	r.ensureHeight(int(totalHeight) + 20)
+
+	y := r.y
+	for _, line := range lines {
+		var x float64
+		switch align {
+		case "center":
+			x = float64(r.width)/2 - line.width/2
+		case "right":
+			x = float64(r.width) - line.width - 5
+		default: // left
+			x = 5
+		}
+
+		baseline := y + line.height
+		for _, piece := range line.pieces {
+			r.drawPiece(piece, x, baseline)
+			x += piece.width
+		}
+
+		y += line.height * lineSpacing
+	}
+
+	r.y += totalHeight + 10
+
+	return nil
+}
+
+// measureWith measures text in a face
+func (r *Renderer) measureWith(face font.Face, text string) float64 {
+	r.ctx.SetFontFace(face)
+	w, _ := r.ctx.MeasureString(text)
+	return w
+}
+
+// drawPiece draws a piece with its highlight and decorations
+func (r *Renderer) drawPiece(piece spanPiece, x, baseline float64) {
+	r.ctx.SetFontFace(piece.face)
+	span := piece.span
+	thickness := math.Max(1, float64(span.Size)/16)
+
+	if span.Inverted {
+		r.ctx.DrawRectangle(x, baseline-piece.height*1.05, piece.width, piece.height*1.35)
+		r.ctx.Fill()
+		r.ctx.SetColor(color.White)
+	}
+
+	if !piece.space {
+		r.ctx.DrawString(piece.text, x, baseline)
+	}
+	if span.Underline {
+		r.ctx.DrawRectangle(x, baseline+thickness, piece.width, thickness)
+		r.ctx.Fill()
+	}
+	if span.Strikethrough {
+		r.ctx.DrawRectangle(x, baseline-piece.height*0.35, piece.width, thickness)
+		r.ctx.Fill()
+	}
+
+	r.ctx.SetColor(color.Black)
+}
+
+// splitSpan splits span text into words, single spaces and newlines
+func splitSpan(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, c := range text {
+		switch {
+		case c == '\n':
+			flush()
+			tokens = append(tokens, "\n")
+		case isBreakingSpace(c):
+			flush()
+			tokens = append(tokens, " ")
+		default:
+			word.WriteRune(c)
+		}
+	}
+	flush()
+
+	// Chinese and Japanese characters are pieces of their own, so lines can
+	// break between them
+	var split []string
+	for _, token := range tokens {
+		split = append(split, cjkSegments(token)...)
+	}
+	return split
+}
+
+// reorderPieces puts a line's pieces in the order they're drawn. Each piece
+// takes the direction of its first letter; right to left pieces are reversed.
+func reorderPieces(line *spanLine, rtl bool) {
+	var runes []rune
+	var starts []int
+	for _, piece := range line.pieces {
+		starts = append(starts, len(runes))
+		runes = append(runes, []rune(piece.text)...)
+	}
+	levels := bidiLevels(runes, rtl)
+
+	pieceLevels := make([]int, len(line.pieces))
+	for i, piece := range line.pieces {
+		pieceLevels[i] = levels[starts[i]]
+		for j, c := range []rune(piece.text) {
+			if props, _ := bidi.LookupRune(c); props.Class() == bidi.L || props.Class() == bidi.R || props.Class() == bidi.AL {
+				pieceLevels[i] = levels[starts[i]+j]
+				break
+			}
+		}
+	}
+
+	reordered := make([]spanPiece, 0, len(line.pieces))
+	for _, i := range visualOrder(pieceLevels) {
+		piece := line.pieces[i]
+		piece.text = visualLine(piece.text, pieceLevels[i]%2 == 1)
+		reordered = append(reordered, piece)
+	}
+	line.pieces = reordered
+}
+
+// layoutSpans wraps pieces into lines no wider than width. Consecutive word
+// pieces, even from different spans, stay together; a word too long for a
+// line of its own is broken like plain text, measuring with measure.
+func layoutSpans(pieces []spanPiece, width float64, measure func(font.Face, string) float64) []spanLine {
+	lines := []spanLine{{}}
+	var pendingSpaces []spanPiece
+
+	addPiece := func(piece spanPiece) {
+		lines[len(lines)-1].add(piece)
+	}
+
+	for i := 0; i < len(pieces); {
+		piece := pieces[i]
+		if piece.brk {
+			lines = append(lines, spanLine{})
+			pendingSpaces = nil
+			i++
+			continue
+		}
+		if piece.space {
+			pendingSpaces = append(pendingSpaces, piece)
+			i++
+			continue
+		}
+
+		// Collect the whole word
+		end := i
+		wordWidth := 0.0
+		for end < len(pieces) && !pieces[end].space && !pieces[end].brk && (end == i || !pieces[end].breakBefore) {
+			wordWidth += pieces[end].width
+			end++
+		}
+
+		spaceWidth := 0.0
+		for _, space := range pendingSpaces {
+			spaceWidth += space.width
+		}
+
+		line := &lines[len(lines)-1]
+		if wordWidth > width {
+			// Too long for any line: start a fresh one and break the word
+			if len(line.pieces) > 0 {
+				lines = append(lines, spanLine{})
+			}
+			pendingSpaces = nil
+			for _, wordPiece := range pieces[i:end] {
+				lines = breakPiece(lines, wordPiece, width, measure)
+			}
+			i = end
+			continue
+		}
+		if len(line.pieces) > 0 && line.width+spaceWidth+wordWidth > width {
+			lines = append(lines, spanLine{})
+		} else {
+			for _, space := range pendingSpaces {
+				addPiece(space)
+			}
+		}
+		pendingSpaces = nil
+
+		for _, wordPiece := range pieces[i:end] {
+			addPiece(wordPiece)
+		}
+		i = end
+	}
+
+	// Empty lines are as tall as the text before them
+	for i := range lines {
+		if lines[i].height > 0 {
+			continue
+		}
+		if i > 0 {
+			lines[i].height = lines[i-1].height
+		} else if len(pieces) > 0 {
+			lines[i].height = pieces[0].height
+		}
+	}
+
+	return lines
+}
+
+// breakPiece adds a piece of an overlong word to the last line, breaking it
+// with breakWord onto new lines where it doesn't fit
+func breakPiece(lines []spanLine, piece spanPiece, width float64, measure func(font.Face, string) float64) []spanLine {
+	measurePiece := func(text string) float64 {
+		return measure(piece.face, text)
+	}
+
+	for {
+		line := &lines[len(lines)-1]
+		remaining := width - line.width
+		if piece.width <= remaining {
+			line.add(piece)
+			return lines
+		}
+
+		first, _ := utf8.DecodeRuneInString(piece.text)
+		if len(line.pieces) > 0 && measurePiece(string(first)) > remaining {
+			// Break between this piece and the last one
+			lines = append(lines, spanLine{})
+			continue
+		}
+
+		head, tail := breakWord(piece.text, remaining, measurePiece)
+		headPiece := piece
+		headPiece.text, headPiece.width = head, measurePiece(head)
+		line.add(headPiece)
+		if tail == "" {
+			return lines
+		}
+
+		lines = append(lines, spanLine{})
+		piece.text, piece.width = tail, measurePiece(tail)
+	}
+}
+
+// add appends a piece to a line
+func (line *spanLine) add(piece spanPiece) {
+	line.pieces = append(line.pieces, piece)
+	line.width += piece.width
+	line.height = math.Max(line.height, piece.height)
+}
+
+// endWithEllipsis marks a line as cut short, dropping pieces from its end
+// until the ellipsis fits. The ellipsis takes the style of the last word.
+func (r *Renderer) endWithEllipsis(line *spanLine, width float64) {
+	for len(line.pieces) > 0 && line.pieces[len(line.pieces)-1].space {
+		line.width -= line.pieces[len(line.pieces)-1].width
+		line.pieces = line.pieces[:len(line.pieces)-1]
+	}
+	if len(line.pieces) == 0 {
+		return
+	}
+
+	ellipsis := line.pieces[len(line.pieces)-1]
+	ellipsis.text = Ellipsis
+	ellipsis.width = r.measureWith(ellipsis.face, Ellipsis)
+
+	for len(line.pieces) > 1 && line.width+ellipsis.width > width {
+		line.width -= line.pieces[len(line.pieces)-1].width
+		line.pieces = line.pieces[:len(line.pieces)-1]
+	}
+	line.pieces = append(line.pieces, ellipsis)
+	line.width += ellipsis.width
+}
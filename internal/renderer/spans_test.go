@@ -0,0 +1,107 @@
+package renderer
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font"
+
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+// pieces makes spanPieces from tokens, one unit wide per character
+func pieces(tokens ...string) []spanPiece {
+	var result []spanPiece
+	for _, token := range tokens {
+		result = append(result, spanPiece{
+			text:   token,
+			width:  chars(token),
+			height: 10,
+			space:  token == " ",
+			brk:    token == "\n",
+		})
+	}
+	return result
+}
+
+// measureChars measures text one unit per character, like pieces
+func measureChars(_ font.Face, text string) float64 {
+	return chars(text)
+}
+
+func lineTexts(lines []spanLine) []string {
+	var texts []string
+	for _, line := range lines {
+		text := ""
+		for _, piece := range line.pieces {
+			text += piece.text
+		}
+		texts = append(texts, text)
+	}
+	return texts
+}
+
+func TestLayoutSpans(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		width  float64
+		want   []string
+	}{
+		{"fits", []string{"Total:", " ", "4.50"}, 20, []string{"Total: 4.50"}},
+		{"wraps between words", []string{"Large", " ", "oat", " ", "milk", " ", "latte"}, 10, []string{"Large oat", "milk latte"}},
+		// "$4" and ".50" are separate spans but one word
+		{"word across spans", []string{"Total:", " ", "$4", ".50"}, 8, []string{"Total:", "$4.50"}},
+		{"newline", []string{"Table", "\n", "\n", "4"}, 20, []string{"Table", "", "4"}},
+		{"overlong word", []string{"Supercalifragilistic", " ", "x"}, 10, []string{"Supercali-", "fragilist-", "ic x"}},
+		{"overlong word across spans", []string{"See", " ", "https://example.com/", "receipts/42"}, 12, []string{"See", "https://", "example.com/", "receipts/42"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineTexts(layoutSpans(pieces(tt.tokens...), tt.width, measureChars)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("layoutSpans() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutSpans_LineHeight(t *testing.T) {
+	input := pieces("small", " ", "BIG", "\n", "\n", "small")
+	input[2].height = 30
+
+	lines := layoutSpans(input, 100, measureChars)
+	var heights []float64
+	for _, line := range lines {
+		heights = append(heights, line.height)
+	}
+	if want := []float64{30, 30, 10}; !reflect.DeepEqual(heights, want) {
+		t.Errorf("Expected line heights %v, got %v", want, heights)
+	}
+}
+
+func TestRenderSpans(t *testing.T) {
+	heights := map[int]float64{}
+	for _, maxLines := range []int{1, 0} {
+		r, err := New("58mm")
+		if err != nil {
+			t.Fatalf("Failed to create renderer: %v", err)
+		}
+		if err := r.RenderCommand(&receiptformat.Command{
+			Type: "text",
+			Spans: []receiptformat.Span{
+				{Value: "Sale ", Inverted: true},
+				{Value: "was $9.99", Strikethrough: true},
+				{Value: " now ", Italic: true},
+				{Value: "$4.99", Weight: "bold", Size: 48, Underline: true},
+				{Value: " while stocks last, one per customer, see in store for details"},
+			},
+			MaxLines: maxLines,
+		}); err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+		heights[maxLines] = r.y
+	}
+	if heights[0] <= heights[1] {
+		t.Errorf("Expected wrapped spans to be taller than one line, got %v", heights)
+	}
+}
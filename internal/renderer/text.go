@@ -1,13 +1,17 @@
 package renderer
 
 import (
-	"os"
-
 	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
 )
 
 func (r *Renderer) renderText(cmd *receiptformat.Command) error {
-	text := cmd.Value
+	if len(cmd.Spans) > 0 {
+		return r.renderSpans(cmd)
+	}
+
+	// Arabic letters take their joined forms before anything is measured
+	text := shapeArabic(cmd.Value)
+	rtl := isRTL(text)
 
 	// Get size - handle both int and potential float64 from JSON
 	size := float64(cmd.Size)
@@ -27,73 +31,71 @@ func (r *Renderer) renderText(cmd *receiptformat.Command) error {
 		weight = "normal"
 	}
 
+	// Right to left text lines up on the right unless told otherwise
 	align := cmd.Align
-	if align == "" {
+	if align == "" && rtl {
+		align = "right"
+	} else if align == "" {
 		align = "left"
 	}
 
 	// Load font with the specified size
-	// If no font_family is specified, use "default"
-	fontFamily := cmd.FontFamily
-	if fontFamily == "" {
-		fontFamily = "default"
+	face, err := r.fontFace(cmd.FontFamily, weight, cmd.Italic, size)
+	if err != nil {
+		return err
 	}
-	fontPath := r.getFontPath(fontFamily, weight, cmd.Italic)
-
-	// Always try to load a font with the specified size
-	// If the preferred font fails, fall back to system fonts
-	loaded := false
-	if fontPath != "" {
-		if err := r.ctx.LoadFontFace(fontPath, size); err == nil {
-			loaded = true
-		} else {
-			// Warning: failed to load font - will fall back to system font
-		}
+	r.ctx.SetFontFace(face)
+
+	// Wrap to the width between the 5 dot margins
+	measure := func(s string) float64 {
+		w, _ := r.ctx.MeasureString(s)
+		return w
 	}
+	maxWidth := float64(r.width - 10)
+	lines := TruncateLines(WrapText(text, maxWidth, measure), cmd.MaxLines, maxWidth, measure)
 
-	// If preferred font didn't load, try system fonts
-	if !loaded {
-		systemFonts := []string{
-			"/System/Library/Fonts/Helvetica.ttc",
-			"/System/Library/Fonts/Supplemental/Arial.ttf",
-			"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
-			"/usr/share/fonts/truetype/liberation/LiberationSans-Regular.ttf",
-		}
-		for _, font := range systemFonts {
-			if _, err := os.Stat(font); err == nil {
-				if err := r.ctx.LoadFontFace(font, size); err == nil {
-					loaded = true
-					break
-				}
-			}
-		}
-		if !loaded {
-			// Warning: could not load any font - using system default
+	// Lines are wrapped in reading order, then put in the order they're drawn
+	if ContainsRTL(text) {
+		for i, line := range lines {
+			lines[i] = visualLine(line, rtl)
 		}
 	}
 
-	// Measure text
-	textWidth, textHeight := r.ctx.MeasureString(text)
-
-	// Calculate X position based on alignment
-	var x float64
-	switch align {
-	case "center":
-		x = float64(r.width)/2 - textWidth/2
-	case "right":
-		x = float64(r.width) - textWidth - 5
-	default: // left
-		x = 5
+	lineSpacing := cmd.LineSpacing
+	if lineSpacing == 0 {
+		lineSpacing = 1.25
 	}
 
-	// Ensure we have enough height
-	r.ensureHeight(int(textHeight) + 20)
+	// Measure text
+	textHeight := fontHeight(size)
+	lineAdvance := textHeight * lineSpacing
+	totalHeight := textHeight + lineAdvance*float64(len(lines)-1)
+
+	// Ensure we have enough height. A grown canvas starts with the default
+	// font, so set ours again.
+	r.ensureHeight(int(totalHeight) + 20)
+	r.ctx.SetFontFace(face)
+
+	for i, line := range lines {
+		textWidth := measure(line)
+
+		// Calculate X position based on alignment
+		var x float64
+		switch align {
+		case "center":
+			x = float64(r.width)/2 - textWidth/2
+		case "right":
+			x = float64(r.width) - textWidth - 5
+		default: // left
+			x = 5
+		}
 
-	// Draw text
-	r.ctx.DrawString(text, x, r.y+textHeight)
+		// Draw text
+		r.ctx.DrawString(line, x, r.y+textHeight+lineAdvance*float64(i))
+	}
 
 	// Move Y position
-	r.y += textHeight + 10
+	r.y += totalHeight + 10
 
 	return nil
 }
@@ -127,23 +129,8 @@ func (r *Renderer) getFontPath(family, weight string, italic bool) string {
 		}
 	}
 
-	// Fallback to system fonts
-	fontPaths := []string{
-		"/System/Library/Fonts/Helvetica.ttc",
-		"/System/Library/Fonts/Supplemental/Arial.ttf",
-		"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
-		"/usr/share/fonts/truetype/liberation/LiberationSans-Regular.ttf",
-		"C:\\Windows\\Fonts\\arial.ttf",
-	}
-
-	for _, path := range fontPaths {
-		if _, err := os.Stat(path); err == nil {
-			return path
-		}
-	}
-
-	// Last resort: use gg default
-	return ""
+	// Everything else uses the bundled fonts
+	return builtinFontPath(weight, italic)
 }
 
 func (r *Renderer) renderFeed(cmd *receiptformat.Command) error {
@@ -159,10 +146,30 @@ func (r *Renderer) renderFeed(cmd *receiptformat.Command) error {
 }
 
 func (r *Renderer) renderCut(cmd *receiptformat.Command) error {
-	// Just add some space before the cut - the actual cut is handled by the printer
-	// No visual divider needed
+	// Record where the paper is cut; the encoder sends the actual cut command
+	r.controls = append(r.controls, Control{
+		Type:    ControlCut,
+		Y:       int(r.y),
+		Partial: cmd.Mode == "partial",
+		Feed:    cmd.Lines,
+	})
+
+	// Leave some space so the cut is visible in previews. No visual divider needed.
 	r.ensureHeight(20)
 	r.y += 20
 
 	return nil
 }
+
+func (r *Renderer) renderDrawer(cmd *receiptformat.Command) error {
+	// Nothing to draw; the encoder sends the kick at this point in the receipt
+	r.controls = append(r.controls, Control{
+		Type:    ControlDrawer,
+		Y:       int(r.y),
+		Pin:     cmd.Pin,
+		OnTime:  cmd.OnTime,
+		OffTime: cmd.OffTime,
+	})
+
+	return nil
+}
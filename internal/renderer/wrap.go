@@ -0,0 +1,151 @@
+package renderer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Ellipsis marks text cut short by max_lines. Plain dots print in every font,
+// including the printer's own.
+const Ellipsis = "..."
+
+// urlBreaks are characters a long token like a URL can be broken after
+const urlBreaks = "/-._?&=#:"
+
+// WrapText splits text into lines no wider than width as measured by
+// measure: at newlines, between words, and inside words too long for a line
+// of their own. Those are broken after a URL separator if there is one,
+// hyphenated between letters, or cut where the line ends.
+func WrapText(text string, width float64, measure func(string) float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		// Lines that fit keep their spacing, which may line up columns
+		if measure(paragraph) <= width {
+			lines = append(lines, paragraph)
+			continue
+		}
+
+		words := strings.FieldsFunc(paragraph, isBreakingSpace)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+
+		line := ""
+		for _, word := range words {
+			// Chinese and Japanese can break between characters
+			for i, segment := range cjkSegments(word) {
+				candidate := segment
+				if line != "" && i == 0 {
+					candidate = line + " " + segment
+				} else if line != "" {
+					candidate = line + segment
+				}
+				if measure(candidate) <= width {
+					line = candidate
+					continue
+				}
+
+				if line != "" {
+					lines = append(lines, line)
+				}
+				line = segment
+				for measure(line) > width {
+					head, tail := breakWord(line, width, measure)
+					lines = append(lines, head)
+					line = tail
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// isBreakingSpace reports whether a line can break at a space. No-break
+// spaces, like the one between an amount and its currency, hold.
+func isBreakingSpace(c rune) bool {
+	return unicode.IsSpace(c) && c != '\u00a0' && c != '\u2007' && c != '\u202f'
+}
+
+// Line breaking rules for Chinese and Japanese: characters that can't start a
+// line, such as closing brackets and small kana, and ones that can't end one
+const (
+	noLineStart = ")]}.,;:!?%、。，．・：；？！ー）」』】〕〉》｝〙〗〟ぁぃぅぇぉっゃゅょゎァィゥェォッャュョヮヵヶ々"
+	noLineEnd   = "([{（「『【〔〈《｛〘〖〝"
+)
+
+// isCJK reports whether a character is from a script written without spaces
+// between words
+func isCJK(c rune) bool {
+	return unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana) ||
+		(c >= 0x3000 && c <= 0x303F) || // CJK punctuation
+		(c >= 0xFF00 && c <= 0xFFEF) // Fullwidth forms
+}
+
+// canBreakBetween reports whether a line can break between two characters
+// with no space between them
+func canBreakBetween(a, b rune) bool {
+	return (isCJK(a) || isCJK(b)) && !strings.ContainsRune(noLineStart, b) && !strings.ContainsRune(noLineEnd, a)
+}
+
+// cjkSegments splits a word wherever a line can break inside it, which is
+// only between Chinese or Japanese characters
+func cjkSegments(word string) []string {
+	runes := []rune(word)
+	var segments []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if canBreakBetween(runes[i-1], runes[i]) {
+			segments = append(segments, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(segments, string(runes[start:]))
+}
+
+// breakWord splits a word too wide for a line into the part that fits and the rest
+func breakWord(word string, width float64, measure func(string) float64) (string, string) {
+	runes := []rune(word)
+
+	// The longest prefix that fits, but always at least one character
+	fit := 1
+	for fit < len(runes) && measure(string(runes[:fit+1])) <= width {
+		fit++
+	}
+
+	// Prefer breaking after a separator in the second half of the line
+	for i := fit; i > fit/2; i-- {
+		if strings.ContainsRune(urlBreaks, runes[i-1]) {
+			return string(runes[:i]), string(runes[i:])
+		}
+	}
+
+	// Hyphenate between letters, leaving room for the hyphen
+	for i := fit; i > 1 && i < len(runes); i-- {
+		if unicode.IsLetter(runes[i-1]) && unicode.IsLetter(runes[i]) && measure(string(runes[:i])+"-") <= width {
+			return string(runes[:i]) + "-", string(runes[i:])
+		}
+		if i <= fit/2 {
+			break
+		}
+	}
+
+	return string(runes[:fit]), string(runes[fit:])
+}
+
+// TruncateLines keeps the first maxLines lines, ending the last one with an
+// ellipsis if any were dropped. maxLines 0 keeps them all.
+func TruncateLines(lines []string, maxLines int, width float64, measure func(string) float64) []string {
+	if maxLines <= 0 || len(lines) <= maxLines {
+		return lines
+	}
+
+	lines = append([]string(nil), lines[:maxLines]...)
+	last := []rune(strings.TrimRight(lines[maxLines-1], " "))
+	for len(last) > 0 && measure(string(last)+Ellipsis) > width {
+		last = last[:len(last)-1]
+	}
+	lines[maxLines-1] = strings.TrimRight(string(last), " ") + Ellipsis
+	return lines
+}
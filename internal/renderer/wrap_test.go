@@ -0,0 +1,77 @@
+package renderer
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/thereceipt/receipt-engine/pkg/receiptformat"
+)
+
+// chars measures text one unit per character, like a fixed width font
+func chars(s string) float64 {
+	return float64(utf8.RuneCountInString(s))
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width float64
+		want  []string
+	}{
+		{"fits", "Flat  white", 20, []string{"Flat  white"}},
+		{"words", "Large oat milk flat white with an extra shot", 16, []string{"Large oat milk", "flat white with", "an extra shot"}},
+		{"newlines", "Table 4\n\nNo onions", 20, []string{"Table 4", "", "No onions"}},
+		{"url", "https://example.com/receipts/abc", 16, []string{"https://example.", "com/receipts/abc"}},
+		{"hyphenated", "Supercalifragilistic", 10, []string{"Supercali-", "fragilist-", "ic"}},
+		{"no-break space", "Total 12,50\u00a0€", 9, []string{"Total", "12,50\u00a0€"}},
+		{"hard break", "12345678901234", 6, []string{"123456", "789012", "34"}},
+		{"chinese", "谢谢光临欢迎再来", 3, []string{"谢谢光", "临欢迎", "再来"}},
+		// A closing mark stays with the character before it
+		{"japanese punctuation", "ありがとう。またね", 5, []string{"ありがと", "う。またね"}},
+		{"mixed", "Latte 拿铁咖啡", 8, []string{"Latte 拿铁", "咖啡"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WrapText(tt.text, tt.width, chars); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WrapText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	lines := []string{"Large oat milk", "flat white with", "an extra shot"}
+
+	got := TruncateLines(lines, 2, 15, chars)
+	want := []string{"Large oat milk", "flat white w..."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TruncateLines() = %q, want %q", got, want)
+	}
+
+	if got := TruncateLines(lines, 0, 15, chars); len(got) != 3 {
+		t.Errorf("Expected max_lines 0 to keep every line, got %q", got)
+	}
+}
+
+func TestRenderText_Wraps(t *testing.T) {
+	heights := map[int]float64{}
+	for _, maxLines := range []int{1, 0} {
+		r, err := New("58mm")
+		if err != nil {
+			t.Fatalf("Failed to create renderer: %v", err)
+		}
+		if err := r.RenderCommand(&receiptformat.Command{
+			Type:     "text",
+			Value:    "A very long product description that cannot possibly fit on one line of a 58mm receipt",
+			MaxLines: maxLines,
+		}); err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+		heights[maxLines] = r.y
+	}
+	if heights[0] <= heights[1] {
+		t.Errorf("Expected wrapped text to be taller than one line, got %v", heights)
+	}
+}
@@ -93,6 +93,73 @@ func (m JobsModel) Update(msg tea.Msg) (JobsModel, tea.Cmd) {
 			m.Refresh()
 			m.message = "Cleared completed"
 			m.msgType = "success"
+		case "e":
+			// Requeue a dead job
+			if m.cursor < len(m.jobs) {
+				if err := m.queue.Requeue(m.jobs[m.cursor].ID); err != nil {
+					m.message = err.Error()
+					m.msgType = "error"
+				} else {
+					m.message = "Requeued job"
+					m.msgType = "success"
+				}
+				m.Refresh()
+			}
+		case "d":
+			// Cancel a queued or dead job
+			if m.cursor < len(m.jobs) {
+				if err := m.queue.Cancel(m.jobs[m.cursor].ID); err != nil {
+					m.message = err.Error()
+					m.msgType = "error"
+				} else {
+					m.message = "Cancelled job"
+					m.msgType = "success"
+				}
+				m.Refresh()
+			}
+		case "+", "-":
+			// Raise or lower a queued job's priority
+			if m.cursor < len(m.jobs) {
+				job := m.jobs[m.cursor]
+				priority := job.Priority + 1
+				if msg.String() == "-" {
+					priority = job.Priority - 1
+				}
+				if err := m.queue.SetPriority(job.ID, priority); err != nil {
+					m.message = err.Error()
+					m.msgType = "error"
+				} else {
+					m.message = fmt.Sprintf("Priority set to %d", priority)
+					m.msgType = "success"
+				}
+				m.Refresh()
+			}
+		case "p":
+			// Pause or resume the selected job's printer
+			if m.cursor < len(m.jobs) {
+				printerID := m.jobs[m.cursor].PrinterID
+				if m.queue.IsPrinterPaused(printerID) {
+					m.queue.ResumePrinter(printerID)
+					m.message = "Resumed printer " + printerID
+				} else {
+					m.queue.PausePrinter(printerID)
+					m.message = "Paused printer " + printerID
+				}
+				m.msgType = "success"
+				m.Refresh()
+			}
+		case "x":
+			// Discard a dead job
+			if m.cursor < len(m.jobs) {
+				if err := m.queue.Discard(m.jobs[m.cursor].ID); err != nil {
+					m.message = err.Error()
+					m.msgType = "error"
+				} else {
+					m.message = "Discarded job"
+					m.msgType = "success"
+				}
+				m.Refresh()
+			}
 		}
 	}
 
@@ -119,7 +186,7 @@ func (m JobsModel) View() string {
 		b.WriteString(TextMuted.Render("Go to Print tab to send a job.\n"))
 	} else {
 		// Stats bar
-		queued, printing, completed, failed := 0, 0, 0, 0
+		queued, printing, completed, dead, cancelled := 0, 0, 0, 0, 0
 		for _, j := range m.jobs {
 			switch j.Status {
 			case "queued":
@@ -128,8 +195,10 @@ func (m JobsModel) View() string {
 				printing++
 			case "completed":
 				completed++
-			case "failed":
-				failed++
+			case "dead":
+				dead++
+			case "cancelled":
+				cancelled++
 			}
 		}
 
@@ -143,8 +212,11 @@ func (m JobsModel) View() string {
 		if completed > 0 {
 			statsLine += SuccessStyle.Render(fmt.Sprintf("%d completed", completed)) + "  "
 		}
-		if failed > 0 {
-			statsLine += ErrorStyle.Render(fmt.Sprintf("%d failed", failed))
+		if dead > 0 {
+			statsLine += ErrorStyle.Render(fmt.Sprintf("%d dead", dead)) + "  "
+		}
+		if cancelled > 0 {
+			statsLine += TextMuted.Render(fmt.Sprintf("%d cancelled", cancelled))
 		}
 		b.WriteString(statsLine)
 		b.WriteString("\n\n")
@@ -180,7 +252,7 @@ func (m JobsModel) View() string {
 				statusStyle = lipgloss.NewStyle().Foreground(Secondary)
 			case "completed":
 				statusStyle = lipgloss.NewStyle().Foreground(Success)
-			case "failed":
+			case "dead":
 				statusStyle = lipgloss.NewStyle().Foreground(Error)
 			default:
 				statusStyle = TextMuted.Copy()
@@ -197,6 +269,9 @@ func (m JobsModel) View() string {
 
 			status := statusStyle.Render(job.Status)
 			line := fmt.Sprintf("%s%s  %s  %s", cursor, Truncate(jobID, 18), status, TextMuted.Render(age))
+			if job.Priority != 0 {
+				line += "  " + InfoStyle.Render(fmt.Sprintf("p%d", job.Priority))
+			}
 
 			b.WriteString(style.Render(line))
 			b.WriteString("\n")
@@ -221,15 +296,31 @@ func (m JobsModel) View() string {
 
 			b.WriteString(TextMuted.Render("ID: ") + TextNormal.Render(job.ID))
 			b.WriteString("\n")
-			b.WriteString(TextMuted.Render("Printer: ") + TextNormal.Render(job.PrinterID))
+			printerLabel := TextNormal.Render(job.PrinterID)
+			if m.queue.IsPrinterPaused(job.PrinterID) {
+				printerLabel += " " + WarningStyle.Render("(paused)")
+			}
+			b.WriteString(TextMuted.Render("Printer: ") + printerLabel)
+			b.WriteString("\n")
+			b.WriteString(TextMuted.Render("Priority: ") + TextNormal.Render(fmt.Sprintf("%d", job.Priority)))
 			b.WriteString("\n")
 			b.WriteString(TextMuted.Render("Created: ") + TextNormal.Render(job.CreatedAt.Format("15:04:05")))
 
+			if job.Status == "printing" && job.BandsTotal > 0 {
+				b.WriteString("\n")
+				b.WriteString(TextMuted.Render("Progress: ") + InfoStyle.Render(fmt.Sprintf("%d/%d bands", job.BandsSent, job.BandsTotal)))
+			}
+
 			if job.Retries > 0 {
 				b.WriteString("\n")
 				b.WriteString(TextMuted.Render("Retries: ") + WarningStyle.Render(fmt.Sprintf("%d", job.Retries)))
 			}
 
+			if job.Status == "queued" && time.Until(job.NextAttemptAt) > 0 {
+				b.WriteString("\n")
+				b.WriteString(TextMuted.Render("Next attempt: ") + WarningStyle.Render("in "+time.Until(job.NextAttemptAt).Truncate(time.Second).String()))
+			}
+
 			if job.Error != nil {
 				b.WriteString("\n")
 				b.WriteString(ErrorStyle.Render(fmt.Sprintf("Error: %v", job.Error)))
@@ -258,6 +349,11 @@ func (m JobsModel) Help() string {
 	return RenderHelp("↑/↓", "select") + "  " +
 		RenderHelp("click", "select") + "  " +
 		RenderHelp("c", "clear done") + "  " +
+		RenderHelp("d", "cancel") + "  " +
+		RenderHelp("+/-", "priority") + "  " +
+		RenderHelp("p", "pause printer") + "  " +
+		RenderHelp("e", "requeue dead") + "  " +
+		RenderHelp("x", "discard dead") + "  " +
 		RenderHelp("r", "refresh")
 }
 
@@ -285,8 +285,8 @@ func (m *PrintModel) print() {
 		pars.SetVariableData(variableData)
 	}
 
-	// Execute
-	img, err := pars.Execute()
+	// Execute as an image or native ESC/POS, depending on the printer and receipt
+	payload, err := printer.RenderReceipt(pars, m.manager.GetOutputMode(selectedPrinter.ID), m.manager.GetProfile(selectedPrinter.ID))
 	if err != nil {
 		m.message = fmt.Sprintf("Render error: %v", err)
 		m.msgType = "error"
@@ -294,7 +294,12 @@ func (m *PrintModel) print() {
 	}
 
 	// Queue print job
-	jobID := m.queue.Enqueue(selectedPrinter.ID, img)
+	jobID, err := m.queue.EnqueuePayload(selectedPrinter.ID, payload, printer.JobOptions{})
+	if err != nil {
+		m.message = fmt.Sprintf("Queue error: %v", err)
+		m.msgType = "error"
+		return
+	}
 
 	printerName := selectedPrinter.Name
 	if printerName == "" {
@@ -276,8 +276,15 @@ func (m PrintersModel) View() string {
 				Foreground(Secondary).
 				Render(fmt.Sprintf("[%s]", strings.ToUpper(p.Type)))
 
-			// Status icon
+			// Status icon from the printer's last reported status
 			status := StatusIcon("online")
+			var problem string
+			if printerStatus, ok := m.manager.GetPrinterStatus(p.ID); ok {
+				if !printerStatus.Ready() {
+					status = StatusIcon("offline")
+				}
+				problem = printerStatus.Problem()
+			}
 
 			// Connection info
 			var connInfo string
@@ -291,6 +298,9 @@ func (m PrintersModel) View() string {
 			if connInfo != "" {
 				line += TextMuted.Render(fmt.Sprintf(" • %s", connInfo))
 			}
+			if problem != "" {
+				line += " " + WarningStyle.Render(problem)
+			}
 
 			b.WriteString(style.Render(line))
 			b.WriteString("\n")
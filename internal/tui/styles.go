@@ -207,7 +207,7 @@ func StatusIcon(status string) string {
 	switch status {
 	case "online", "connected", "completed":
 		return StatusOnline.String()
-	case "offline", "disconnected", "failed":
+	case "offline", "disconnected", "failed", "dead":
 		return StatusOffline.String()
 	case "pending", "queued", "printing":
 		return StatusPending.String()
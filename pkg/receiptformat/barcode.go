@@ -0,0 +1,242 @@
+package receiptformat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BarcodeFormats are the formats a barcode command can use. An empty format is CODE128.
+var BarcodeFormats = []string{"EAN13", "EAN8", "UPC_A", "UPC_E", "ITF", "CODE39", "CODE93", "CODE128", "CODABAR", "GS1_128"}
+
+// NormalizeBarcode checks a barcode value and returns it in the form printed:
+// EAN and UPC codes gain their check digit (or have it verified if given),
+// UPC-E is always number system, six digits and check digit, and Codabar
+// gets A...A start and stop characters if it has none
+func NormalizeBarcode(format, value string) (string, error) {
+	switch format {
+	case "", "CODE128":
+		for _, c := range value {
+			if c > 127 {
+				return "", fmt.Errorf("CODE128 can only encode ASCII characters")
+			}
+		}
+		return value, nil
+	case "EAN13":
+		return withCheckDigit(format, value, 12)
+	case "EAN8":
+		return withCheckDigit(format, value, 7)
+	case "UPC_A":
+		return withCheckDigit(format, value, 11)
+	case "UPC_E":
+		return normalizeUPCE(value)
+	case "ITF":
+		if !isDigits(value) || len(value)%2 != 0 {
+			return "", fmt.Errorf("ITF value must be an even number of digits")
+		}
+		return value, nil
+	case "CODE39":
+		for _, c := range value {
+			if !strings.ContainsRune("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ-. $/+%", c) {
+				return "", fmt.Errorf("CODE39 cannot encode '%c' (use 0-9, A-Z, space and -.$/+%%)", c)
+			}
+		}
+		return value, nil
+	case "CODE93":
+		for _, c := range value {
+			if c > 127 {
+				return "", fmt.Errorf("CODE93 can only encode ASCII characters")
+			}
+		}
+		return value, nil
+	case "CODABAR":
+		return normalizeCodabar(value)
+	case "GS1_128":
+		if _, err := ParseGS1(value); err != nil {
+			return "", err
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid barcode format '%s'", format)
+}
+
+// withCheckDigit appends the GS1 check digit to a code of length digits, or
+// verifies it if the code already has one
+func withCheckDigit(format, value string, length int) (string, error) {
+	if !isDigits(value) || (len(value) != length && len(value) != length+1) {
+		return "", fmt.Errorf("%s value must be %d digits, or %d with its check digit", format, length, length+1)
+	}
+	check := CheckDigit(value[:length])
+	if len(value) == length {
+		return value + string(check), nil
+	}
+	if value[length] != check {
+		return "", fmt.Errorf("invalid %s check digit %c (expected %c)", format, value[length], check)
+	}
+	return value, nil
+}
+
+// CheckDigit returns the GS1 mod 10 check digit for a string of digits
+func CheckDigit(digits string) byte {
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 3 // Weights alternate 3, 1 from the right
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// normalizeUPCE accepts six digits (number system 0), number system and six
+// digits, or all eight with the check digit
+func normalizeUPCE(value string) (string, error) {
+	if !isDigits(value) || len(value) < 6 || len(value) > 8 {
+		return "", fmt.Errorf("UPC_E value must be 6 to 8 digits")
+	}
+	if len(value) == 6 {
+		value = "0" + value
+	}
+	if value[0] != '0' && value[0] != '1' {
+		return "", fmt.Errorf("UPC_E number system must be 0 or 1")
+	}
+
+	check := CheckDigit(ExpandUPCE(value[:7]))
+	if len(value) == 7 {
+		return value + string(check), nil
+	}
+	if value[7] != check {
+		return "", fmt.Errorf("invalid UPC_E check digit %c (expected %c)", value[7], check)
+	}
+	return value, nil
+}
+
+// ExpandUPCE returns the 11 digit UPC-A code (without check digit) that a
+// number system and six digit UPC-E code stands for
+func ExpandUPCE(code string) string {
+	ns, d := code[:1], code[1:7]
+	switch d[5] {
+	case '0', '1', '2':
+		return ns + d[0:2] + d[5:6] + "0000" + d[2:5]
+	case '3':
+		return ns + d[0:3] + "00000" + d[3:5]
+	case '4':
+		return ns + d[0:4] + "00000" + d[4:5]
+	default:
+		return ns + d[0:5] + "0000" + d[5:6]
+	}
+}
+
+func normalizeCodabar(value string) (string, error) {
+	value = strings.ToUpper(value)
+	isStartStop := func(c byte) bool { return c >= 'A' && c <= 'D' }
+
+	if value != "" && isStartStop(value[0]) {
+		if len(value) < 2 || !isStartStop(value[len(value)-1]) {
+			return "", fmt.Errorf("CODABAR value starting with %c must end with A, B, C or D", value[0])
+		}
+	} else {
+		value = "A" + value + "A"
+	}
+
+	for _, c := range value[1 : len(value)-1] {
+		if !strings.ContainsRune("0123456789-$:/.+", c) {
+			return "", fmt.Errorf("CODABAR cannot encode '%c' (use 0-9 and -$:/.+)", c)
+		}
+	}
+	return value, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// GS1Element is one application identifier and its data in a GS1-128 barcode
+type GS1Element struct {
+	AI   string
+	Data string
+}
+
+// Fixed reports whether the element's length is set by its AI. Variable
+// length elements need an FNC1 separator if anything follows them.
+func (e GS1Element) Fixed() bool {
+	_, ok := gs1FixedLengths[e.AI[:2]]
+	return ok
+}
+
+// gs1FixedLengths are the data lengths of AIs whose length is predefined,
+// by the AI's first two digits
+var gs1FixedLengths = map[string]int{
+	"00": 18, "01": 14, "02": 14, "03": 14, "04": 16,
+	"11": 6, "12": 6, "13": 6, "14": 6, "15": 6, "16": 6, "17": 6, "18": 6, "19": 6,
+	"20": 2,
+	"31": 6, "32": 6, "33": 6, "34": 6, "35": 6, "36": 6,
+	"41": 13,
+}
+
+// gs1CheckDigitAIs carry a GTIN or SSCC ending in a check digit
+var gs1CheckDigitAIs = map[string]bool{"00": true, "01": true, "02": true}
+
+// ParseGS1 splits a GS1-128 value written as "(01)09501101530003(10)ABC123"
+// into its elements, checking the lengths of fixed-length data and the check
+// digits of GTINs and SSCCs
+func ParseGS1(value string) ([]GS1Element, error) {
+	var elements []GS1Element
+	rest := value
+	for rest != "" {
+		if rest[0] != '(' {
+			return nil, fmt.Errorf("GS1_128 value must be written as (AI)data, e.g. (01)09501101530003")
+		}
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed application identifier in GS1_128 value")
+		}
+
+		ai := rest[1:end]
+		rest = rest[end+1:]
+		next := strings.IndexByte(rest, '(')
+		if next < 0 {
+			next = len(rest)
+		}
+		data := rest[:next]
+		rest = rest[next:]
+
+		if !isDigits(ai) || len(ai) < 2 || len(ai) > 4 {
+			return nil, fmt.Errorf("invalid GS1 application identifier '%s' (must be 2 to 4 digits)", ai)
+		}
+		if data == "" {
+			return nil, fmt.Errorf("GS1 application identifier (%s) has no data", ai)
+		}
+		if length, ok := gs1FixedLengths[ai[:2]]; ok {
+			if !isDigits(data) || len(data) != length {
+				return nil, fmt.Errorf("GS1 (%s) data must be %d digits", ai, length)
+			}
+			if gs1CheckDigitAIs[ai] {
+				if check := CheckDigit(data[:length-1]); data[length-1] != check {
+					return nil, fmt.Errorf("invalid check digit %c in GS1 (%s) (expected %c)", data[length-1], ai, check)
+				}
+			}
+		} else if len(data) > 90 {
+			return nil, fmt.Errorf("GS1 (%s) data is longer than 90 characters", ai)
+		}
+		for _, c := range data {
+			if c < 0x21 || c > 0x7E {
+				return nil, fmt.Errorf("GS1 (%s) data contains '%c' (must be printable ASCII)", ai, c)
+			}
+		}
+
+		elements = append(elements, GS1Element{AI: ai, Data: data})
+	}
+	if len(elements) == 0 {
+		return nil, fmt.Errorf("GS1_128 value has no application identifiers")
+	}
+	return elements, nil
+}
@@ -0,0 +1,809 @@
+package receiptformat
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expression is a parsed expression computing a value from variables and
+// variable arrays, such as "sum(products.price * products.qty) * 1.2".
+//
+// Values are numbers, strings, booleans and lists. A variable is named as
+// it's declared. An array field, written array.field, is the current entry's
+// value in a command bound to that array and a list of every entry's value
+// anywhere else. Arithmetic on lists works element by element, so
+// products.price * products.qty is each entry's line total.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// ExprEnv is what an expression is evaluated against
+type ExprEnv struct {
+	// Lookup returns the value of a variable or array field
+	Lookup func(name string) (interface{}, error)
+	// Locale is used by format(), as for variable formats
+	Locale string
+}
+
+// exprFunctions are the functions expressions can call, with the least and
+// most arguments each takes (-1 for any number)
+var exprFunctions = map[string][2]int{
+	"sum":    {1, -1},
+	"count":  {1, -1},
+	"min":    {1, -1},
+	"max":    {1, -1},
+	"avg":    {1, -1},
+	"round":  {1, 2},
+	"floor":  {1, 1},
+	"ceil":   {1, 1},
+	"abs":    {1, 1},
+	"upper":  {1, 1},
+	"lower":  {1, 1},
+	"trim":   {1, 1},
+	"len":    {1, 1},
+	"format": {2, 2},
+}
+
+// Limits that keep a hostile expression from exhausting the stack
+const (
+	MaxExpressionLength = 4096 // Bytes
+	MaxExpressionDepth  = 100  // Nested parentheses, function calls and unary operators
+)
+
+// ParseExpression parses an expression, checking its syntax and function calls
+func ParseExpression(source string) (*Expression, error) {
+	if len(source) > MaxExpressionLength {
+		return nil, fmt.Errorf("expression too long: %d bytes (max %d)", len(source), MaxExpressionLength)
+	}
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos+1)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the expression as it was written
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Identifiers returns the variables and array fields the expression uses
+func (e *Expression) Identifiers() []string {
+	var names []string
+	seen := make(map[string]bool)
+	var walk func(n exprNode)
+	walk = func(n exprNode) {
+		switch n := n.(type) {
+		case identNode:
+			if !seen[string(n)] {
+				seen[string(n)] = true
+				names = append(names, string(n))
+			}
+		case unaryNode:
+			walk(n.x)
+		case binaryNode:
+			walk(n.left)
+			walk(n.right)
+		case callNode:
+			for _, arg := range n.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(e.root)
+	return names
+}
+
+// Eval computes the expression's value: a float64, string, bool or
+// []interface{} of those
+func (e *Expression) Eval(env ExprEnv) (interface{}, error) {
+	return e.root.eval(&env)
+}
+
+// ExprValue converts a variable's or array field's value for use in an
+// expression. Number and boolean values given as text become numbers and
+// booleans, so "2" + 1 is 3 for a number variable.
+func ExprValue(value interface{}, valueType string) interface{} {
+	switch valueType {
+	case "number", "double":
+		if n, ok := toFloat(value); ok {
+			return n
+		}
+	case "boolean":
+		if s, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+				return b
+			}
+		}
+	}
+	return value
+}
+
+// ExprString returns an expression's value as printed. Numbers print as
+// written, without float noise, and lists as comma separated values.
+func ExprString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return plainNumber(v)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = ExprString(item)
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// exprOperators are longest first, so <= is read before <
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "(", ")", ","}
+
+func lexExpression(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c, size := utf8.DecodeRuneInString(source[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, source[start:i], start})
+
+		case c == '"' || c == '\'':
+			start := i
+			var b strings.Builder
+			i += size
+			for {
+				if i >= len(source) {
+					return nil, fmt.Errorf("unterminated string at position %d", start+1)
+				}
+				r, rs := utf8.DecodeRuneInString(source[i:])
+				i += rs
+				if r == c {
+					break
+				}
+				if r == '\\' && i < len(source) {
+					r, rs = utf8.DecodeRuneInString(source[i:])
+					i += rs
+				}
+				b.WriteRune(r)
+			}
+			tokens = append(tokens, token{tokString, b.String(), start})
+
+		case unicode.IsLetter(c) || c == '_':
+			// Array fields are one identifier, dot included
+			start := i
+			for i < len(source) {
+				r, rs := utf8.DecodeRuneInString(source[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+					break
+				}
+				i += rs
+			}
+			tokens = append(tokens, token{tokIdent, source[start:i], start})
+
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{tokOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected '%c' at position %d", c, i+1)
+			}
+		}
+	}
+	return append(tokens, token{tokEOF, "end of expression", len(source)}), nil
+}
+
+// Parser
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	depth  int // Nesting of the operand being parsed
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it's one of the operators
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected '%s' but found '%s' at position %d", op, tok.text, tok.pos+1)
+	}
+	return nil
+}
+
+// binaryLevel parses operands joined by any of ops, left to right
+func (p *exprParser) binaryLevel(operand func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op, left, right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.binaryLevel(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.binaryLevel(p.parseComparison, "&&")
+}
+
+// parseComparison allows one comparison, since a < b < c rarely means what it says
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return binaryNode{op, left, right}, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	return p.binaryLevel(p.parseMultiplicative, "+", "-")
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	return p.binaryLevel(p.parseUnary, "*", "/", "%")
+}
+
+// parseUnary parses an operand. Every nested operand passes through here,
+// so this is where nesting is limited.
+func (p *exprParser) parseUnary() (exprNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > MaxExpressionDepth {
+		return nil, fmt.Errorf("expression nested too deeply at position %d (max %d levels)", p.peek().pos+1, MaxExpressionDepth)
+	}
+
+	if op, ok := p.accept("-", "!"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op, x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", tok.text, tok.pos+1)
+		}
+		return numberNode(n), nil
+
+	case tokString:
+		return stringNode(tok.text), nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return boolNode(true), nil
+		case "false":
+			return boolNode(false), nil
+		}
+
+		if _, ok := p.accept("("); !ok {
+			if strings.HasPrefix(tok.text, ".") || strings.HasSuffix(tok.text, ".") || strings.Count(tok.text, ".") > 1 {
+				return nil, fmt.Errorf("invalid name '%s' at position %d (use variable or array.field)", tok.text, tok.pos+1)
+			}
+			return identNode(tok.text), nil
+		}
+
+		arity, ok := exprFunctions[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown function '%s' at position %d", tok.text, tok.pos+1)
+		}
+		var args []exprNode
+		if _, ok := p.accept(")"); !ok {
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if _, ok := p.accept(","); !ok {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		if len(args) < arity[0] || (arity[1] >= 0 && len(args) > arity[1]) {
+			return nil, fmt.Errorf("wrong number of arguments to %s() at position %d", tok.text, tok.pos+1)
+		}
+		return callNode{tok.text, args}, nil
+
+	case tokOp:
+		if tok.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos+1)
+}
+
+// Evaluation
+
+type exprNode interface {
+	eval(env *ExprEnv) (interface{}, error)
+}
+
+type (
+	numberNode float64
+	stringNode string
+	boolNode   bool
+	identNode  string
+	unaryNode  struct {
+		op string
+		x  exprNode
+	}
+	binaryNode struct {
+		op          string
+		left, right exprNode
+	}
+	callNode struct {
+		name string
+		args []exprNode
+	}
+)
+
+func (n numberNode) eval(*ExprEnv) (interface{}, error) { return float64(n), nil }
+func (n stringNode) eval(*ExprEnv) (interface{}, error) { return string(n), nil }
+func (n boolNode) eval(*ExprEnv) (interface{}, error)   { return bool(n), nil }
+
+func (n identNode) eval(env *ExprEnv) (interface{}, error) {
+	if env.Lookup == nil {
+		return nil, fmt.Errorf("unknown variable '%s'", string(n))
+	}
+	return env.Lookup(string(n))
+}
+
+func (n unaryNode) eval(env *ExprEnv) (interface{}, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !Truthy(x), nil
+	}
+	return elementwise(x, func(v interface{}) (interface{}, error) {
+		f, err := exprNumber(v)
+		return -f, err
+	})
+}
+
+func (n binaryNode) eval(env *ExprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logical operators only evaluate their right side if they need it
+	switch n.op {
+	case "&&", "||":
+		if Truthy(left) == (n.op == "||") {
+			return n.op == "||", nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		return Truthy(right), nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	}
+	return pairwise(left, right, func(a, b interface{}) (interface{}, error) {
+		return arithmetic(n.op, a, b)
+	})
+}
+
+func (n callNode) eval(env *ExprEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	switch n.name {
+	case "sum", "count", "min", "max", "avg":
+		return aggregate(n.name, flatten(args))
+	case "round":
+		digits := 0.0
+		if len(args) == 2 {
+			d, err := exprNumber(args[1])
+			if err != nil {
+				return nil, err
+			}
+			digits = d
+		}
+		scale := math.Pow(10, digits)
+		return numeric(args[0], func(f float64) float64 { return math.Round(f*scale) / scale })
+	case "floor":
+		return numeric(args[0], math.Floor)
+	case "ceil":
+		return numeric(args[0], math.Ceil)
+	case "abs":
+		return numeric(args[0], math.Abs)
+	case "upper":
+		return elementwise(args[0], func(v interface{}) (interface{}, error) { return strings.ToUpper(ExprString(v)), nil })
+	case "lower":
+		return elementwise(args[0], func(v interface{}) (interface{}, error) { return strings.ToLower(ExprString(v)), nil })
+	case "trim":
+		return elementwise(args[0], func(v interface{}) (interface{}, error) { return strings.TrimSpace(ExprString(v)), nil })
+	case "len":
+		if list, ok := args[0].([]interface{}); ok {
+			return float64(len(list)), nil
+		}
+		return float64(utf8.RuneCountInString(ExprString(args[0]))), nil
+	case "format":
+		return formatCall(args[0], args[1], env.Locale)
+	}
+	return nil, fmt.Errorf("unknown function '%s'", n.name)
+}
+
+// formatCall formats numbers with a number of decimals, a currency code or
+// "percent", like a variable's format
+func formatCall(value, spec interface{}, locale string) (interface{}, error) {
+	format := &Format{}
+	switch s := spec.(type) {
+	case float64:
+		decimals := int(s)
+		format.Decimals = &decimals
+	case string:
+		if s == "percent" {
+			format.Percent = true
+		} else {
+			format.Currency = s
+		}
+	default:
+		return nil, fmt.Errorf("format() takes a number of decimals, a currency code or \"percent\"")
+	}
+	if err := format.Validate("double"); err != nil {
+		return nil, fmt.Errorf("format(): %w", err)
+	}
+
+	return elementwise(value, func(v interface{}) (interface{}, error) {
+		n, err := exprNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		return FormatValue(n, "double", format, locale), nil
+	})
+}
+
+func aggregate(name string, values []interface{}) (interface{}, error) {
+	if name == "count" {
+		return float64(len(values)), nil
+	}
+	if len(values) == 0 {
+		if name == "sum" {
+			return 0.0, nil
+		}
+		return nil, fmt.Errorf("%s() of an empty list", name)
+	}
+
+	numbers := make([]float64, len(values))
+	for i, v := range values {
+		n, err := exprNumber(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s(): %w", name, err)
+		}
+		numbers[i] = n
+	}
+
+	result := numbers[0]
+	for _, n := range numbers[1:] {
+		switch name {
+		case "sum", "avg":
+			result += n
+		case "min":
+			result = math.Min(result, n)
+		case "max":
+			result = math.Max(result, n)
+		}
+	}
+	if name == "avg" {
+		result /= float64(len(numbers))
+	}
+	return result, nil
+}
+
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	// + joins text if either side is text
+	if op == "+" {
+		_, aText := a.(string)
+		_, bText := b.(string)
+		if aText || bText {
+			return ExprString(a) + ExprString(b), nil
+		}
+	}
+
+	x, err := exprNumber(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := exprNumber(b)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return x / y, nil
+	case "%":
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(x, y), nil
+	}
+	return nil, fmt.Errorf("unknown operator '%s'", op)
+}
+
+func compare(op string, a, b interface{}) (interface{}, error) {
+	if _, ok := a.([]interface{}); ok {
+		return nil, fmt.Errorf("cannot compare a list; use sum, count, min or max")
+	}
+	if _, ok := b.([]interface{}); ok {
+		return nil, fmt.Errorf("cannot compare a list; use sum, count, min or max")
+	}
+
+	var c int
+	x, xErr := exprNumber(a)
+	y, yErr := exprNumber(b)
+	_, aText := a.(string)
+	_, bText := b.(string)
+	switch {
+	case xErr == nil && yErr == nil && !(aText && bText):
+		c = cmpFloat(x, y)
+	case op == "==" || op == "!=":
+		c = strings.Compare(ExprString(a), ExprString(b))
+	case aText && bText:
+		c = strings.Compare(a.(string), b.(string))
+	default:
+		return nil, fmt.Errorf("cannot compare %s and %s", ExprString(a), ExprString(b))
+	}
+
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func cmpFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// exprNumber reads a value as a number. Missing values count as 0, and text
+// that is a number as that number.
+func exprNumber(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case []interface{}:
+		return 0, fmt.Errorf("expected a number but got a list; use sum, count, min or max")
+	}
+	if n, ok := toFloat(v); ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("expected a number but got '%s'", ExprString(v))
+}
+
+// Truthy reports whether a value counts as true in a condition: true,
+// numbers other than 0, and text and lists that aren't empty
+func Truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// elementwise applies fn to a value, or to each element of a list
+func elementwise(v interface{}, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fn(v)
+	}
+	result := make([]interface{}, len(list))
+	for i, item := range list {
+		value, err := fn(item)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value
+	}
+	return result, nil
+}
+
+func numeric(v interface{}, fn func(float64) float64) (interface{}, error) {
+	return elementwise(v, func(item interface{}) (interface{}, error) {
+		n, err := exprNumber(item)
+		if err != nil {
+			return nil, err
+		}
+		return fn(n), nil
+	})
+}
+
+// pairwise applies fn to two values. Lists are combined element by element,
+// and a single value is used with every element of a list.
+func pairwise(a, b interface{}, fn func(a, b interface{}) (interface{}, error)) (interface{}, error) {
+	aList, aIsList := a.([]interface{})
+	bList, bIsList := b.([]interface{})
+	switch {
+	case aIsList && bIsList:
+		if len(aList) != len(bList) {
+			return nil, fmt.Errorf("lists have different lengths (%d and %d)", len(aList), len(bList))
+		}
+		result := make([]interface{}, len(aList))
+		for i := range aList {
+			value, err := fn(aList[i], bList[i])
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	case aIsList:
+		return elementwise(a, func(item interface{}) (interface{}, error) { return fn(item, b) })
+	case bIsList:
+		return elementwise(b, func(item interface{}) (interface{}, error) { return fn(a, item) })
+	}
+	return fn(a, b)
+}
+
+// flatten returns function arguments with lists expanded into their elements
+func flatten(args []interface{}) []interface{} {
+	var values []interface{}
+	for _, arg := range args {
+		if list, ok := arg.([]interface{}); ok {
+			values = append(values, list...)
+		} else {
+			values = append(values, arg)
+		}
+	}
+	return values
+}
@@ -0,0 +1,281 @@
+package receiptformat
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Timezones work on hosts without a zoneinfo database
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// Format controls how a variable's value is printed. Number options apply to
+// number and double variables, date options to date variables.
+type Format struct {
+	Decimals *int   `json:"decimals,omitempty"` // Digits after the decimal point (default: the currency's, or as many as needed)
+	Grouping bool   `json:"grouping,omitempty"` // Thousands separators
+	Currency string `json:"currency,omitempty"` // ISO 4217 code, printed with the locale's symbol on the locale's side
+	Percent  bool   `json:"percent,omitempty"`  // Print 0.15 as 15%
+	Locale   string `json:"locale,omitempty"`   // BCP 47 tag, e.g. de-DE (default: the receipt's locale, then en-US)
+	Layout   string `json:"layout,omitempty"`   // Date: date, time, datetime or a Go layout (default datetime, or date for dates without a time)
+	Timezone string `json:"timezone,omitempty"` // Date: IANA zone to print the time in, e.g. Europe/Berlin
+}
+
+// Named date layouts
+var dateLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"time":     "15:04",
+	"datetime": "2006-01-02 15:04",
+}
+
+// dateInputs are the layouts date values are read in, besides unix seconds
+var dateInputs = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// Where a currency symbol goes relative to the amount
+const (
+	symbolBefore       = iota // $12.50
+	symbolBeforeSpaced        // R$ 12,50
+	symbolAfter               // 12,50 €
+)
+
+// symbolPlacements follow CLDR's usual currency pattern for each locale. A
+// locale that isn't listed takes its parent's placement, so de-DE uses de
+// and es-MX uses es-419, and the symbol goes first if no parent is listed.
+var symbolPlacements = map[string]int{
+	"bg": symbolAfter, "cs": symbolAfter, "da": symbolAfter, "de": symbolAfter,
+	"el": symbolAfter, "es": symbolAfter, "et": symbolAfter, "fi": symbolAfter,
+	"fr": symbolAfter, "hr": symbolAfter, "hu": symbolAfter, "is": symbolAfter,
+	"it": symbolAfter, "lt": symbolAfter, "lv": symbolAfter, "nb": symbolAfter,
+	"no": symbolAfter, "pl": symbolAfter, "pt-PT": symbolAfter, "ro": symbolAfter,
+	"ru": symbolAfter, "sk": symbolAfter, "sl": symbolAfter, "sr": symbolAfter,
+	"sv": symbolAfter, "uk": symbolAfter, "vi": symbolAfter,
+
+	"nl": symbolBeforeSpaced, "pt": symbolBeforeSpaced,
+	"de-AT": symbolBeforeSpaced, "de-CH": symbolBeforeSpaced, "de-LI": symbolBeforeSpaced,
+	"fr-CH": symbolBeforeSpaced, "it-CH": symbolBeforeSpaced,
+	"es-AR": symbolBeforeSpaced, "es-CO": symbolBeforeSpaced,
+
+	"es-419": symbolBefore,
+}
+
+// symbolPlacement returns where a locale puts the currency symbol
+func symbolPlacement(tag language.Tag) int {
+	base, script, region := tag.Raw()
+	tag, _ = language.Compose(base, script, region) // Without extensions
+	for {
+		if placement, ok := symbolPlacements[tag.String()]; ok {
+			return placement
+		}
+		if tag.IsRoot() {
+			return symbolBefore
+		}
+		tag = tag.Parent()
+	}
+}
+
+// Validate checks a format's options make sense for a value type
+func (f *Format) Validate(valueType string) error {
+	if f.Locale != "" {
+		if _, err := language.Parse(f.Locale); err != nil {
+			return fmt.Errorf("invalid locale '%s'", f.Locale)
+		}
+	}
+
+	numeric := f.Decimals != nil || f.Grouping || f.Currency != "" || f.Percent
+	if numeric && valueType != "number" && valueType != "double" {
+		return fmt.Errorf("decimals, grouping, currency and percent only apply to number and double values")
+	}
+	if (f.Layout != "" || f.Timezone != "") && valueType != "date" {
+		return fmt.Errorf("layout and timezone only apply to date values")
+	}
+
+	if f.Decimals != nil && (*f.Decimals < 0 || *f.Decimals > 15) {
+		return fmt.Errorf("decimals must be between 0 and 15")
+	}
+	if f.Currency != "" {
+		if _, err := currency.ParseISO(f.Currency); err != nil {
+			return fmt.Errorf("invalid currency '%s' (must be an ISO 4217 code like EUR)", f.Currency)
+		}
+		if f.Percent {
+			return fmt.Errorf("a value can't be both a currency and a percent")
+		}
+	}
+	if f.Timezone != "" {
+		if _, err := time.LoadLocation(f.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone '%s'", f.Timezone)
+		}
+	}
+	return nil
+}
+
+// FormatValue returns a variable's value as printed, formatted for its value
+// type. locale is the receipt's, used if the format doesn't set one. Values
+// that don't match their type are printed as they are.
+func FormatValue(value interface{}, valueType string, format *Format, locale string) string {
+	if value == nil {
+		return ""
+	}
+	if format == nil {
+		format = &Format{}
+	}
+	if format.Locale != "" {
+		locale = format.Locale
+	}
+
+	switch valueType {
+	case "number", "double":
+		if n, ok := toFloat(value); ok {
+			return format.number(n, locale)
+		}
+	case "date":
+		if t, dateOnly, ok := toTime(value); ok {
+			return format.date(t, dateOnly)
+		}
+	}
+
+	return ExprString(value)
+}
+
+func (f *Format) number(n float64, locale string) string {
+	// Without options or a locale, numbers print as written
+	if locale == "" && f.Decimals == nil && !f.Grouping && f.Currency == "" && !f.Percent {
+		return plainNumber(n)
+	}
+
+	tag := language.AmericanEnglish
+	if parsed, err := language.Parse(locale); err == nil && locale != "" {
+		tag = parsed
+	}
+	printer := message.NewPrinter(tag)
+
+	var unit currency.Unit
+	if f.Currency != "" {
+		unit, _ = currency.ParseISO(f.Currency)
+	}
+
+	var opts []number.Option
+	switch {
+	case f.Decimals != nil:
+		opts = append(opts, number.Scale(*f.Decimals))
+	case f.Currency != "":
+		scale, _ := currency.Standard.Rounding(unit)
+		opts = append(opts, number.Scale(scale))
+	case f.Percent:
+		opts = append(opts, number.MaxFractionDigits(fractionDigits(n*100)))
+	default:
+		opts = append(opts, number.MaxFractionDigits(fractionDigits(n)))
+	}
+	if !f.Grouping {
+		opts = append(opts, number.NoSeparator())
+	}
+
+	if f.Percent {
+		return printable(printer.Sprint(number.Percent(n, opts...)))
+	}
+	if f.Currency == "" {
+		return printable(printer.Sprint(number.Decimal(n, opts...)))
+	}
+
+	amount := printable(printer.Sprint(number.Decimal(math.Abs(n), opts...)))
+	symbol := printer.Sprint(currency.Symbol(unit))
+	sign := ""
+	if n < 0 && strings.Trim(amount, "0.,") != "" {
+		sign = "-"
+	}
+
+	// A no-break space keeps the symbol on the amount's line
+	switch symbolPlacement(tag) {
+	case symbolAfter:
+		return sign + amount + "\u00a0" + symbol
+	case symbolBeforeSpaced:
+		return sign + symbol + "\u00a0" + amount
+	}
+	return sign + symbol + amount
+}
+
+func (f *Format) date(t time.Time, dateOnly bool) string {
+	// A date without a time names a calendar day, not an instant, so it
+	// isn't shifted into the timezone
+	if f.Timezone != "" && !dateOnly {
+		if loc, err := time.LoadLocation(f.Timezone); err == nil {
+			t = t.In(loc)
+		}
+	}
+
+	layout := f.Layout
+	if named, ok := dateLayouts[layout]; ok {
+		layout = named
+	} else if layout == "" && dateOnly {
+		layout = dateLayouts["date"]
+	} else if layout == "" {
+		layout = dateLayouts["datetime"]
+	}
+	return t.Format(layout)
+}
+
+// plainNumber prints a number without separators, rounded to 15 significant
+// digits so float noise like 0.30000000000000004 doesn't show
+func plainNumber(n float64) string {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(n, 'g', 15, 64), 64)
+	if err != nil {
+		rounded = n
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// fractionDigits is how many decimals plainNumber prints for a number
+func fractionDigits(n float64) int {
+	s := plainNumber(n)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// printable swaps the narrow no-break space some locales group digits with
+// for a no-break space, which printer code pages and fonts have
+func printable(s string) string {
+	return strings.ReplaceAll(s, "\u202f", "\u00a0")
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// toTime reads a date value: a time, an RFC 3339 or similar string, or unix
+// seconds. dateOnly is true for strings with no time of day.
+func toTime(value interface{}) (t time.Time, dateOnly bool, ok bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, false, true
+	case string:
+		for _, layout := range dateInputs {
+			if parsed, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return parsed, layout == "2006-01-02", true
+			}
+		}
+	default:
+		if seconds, isNumber := toFloat(value); isNumber {
+			return time.Unix(int64(seconds), 0).UTC(), false, true
+		}
+	}
+	return time.Time{}, false, false
+}
@@ -0,0 +1,217 @@
+package receiptformat
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// QRPayload builds a QR code's content from named fields instead of a
+// hand-formatted value
+type QRPayload struct {
+	Type          string            `json:"type"`                    // wifi, vcard, url or epc
+	Fields        map[string]string `json:"fields,omitempty"`        // Field values
+	DynamicFields map[string]string `json:"dynamicFields,omitempty"` // Fields taken from variables, by variable name
+}
+
+// QRPayloadFields lists the fields each payload type accepts. The first
+// ones listed for a type are required.
+var QRPayloadFields = map[string][]string{
+	"wifi":  {"ssid", "password", "security", "hidden"},
+	"vcard": {"name", "organization", "title", "phone", "email", "url", "address", "note"},
+	"url":   {"url"},
+	"epc":   {"name", "iban", "amount", "bic", "purpose", "reference", "text", "info"},
+}
+
+// qrPayloadRequired is how many of a type's QRPayloadFields are required
+var qrPayloadRequired = map[string]int{"wifi": 1, "vcard": 1, "url": 1, "epc": 3}
+
+// Build returns the QR code content for the payload's fields. Dynamic fields
+// must already have been resolved into Fields.
+func (p *QRPayload) Build() (string, error) {
+	if err := p.checkFields(false); err != nil {
+		return "", err
+	}
+
+	switch p.Type {
+	case "wifi":
+		return p.buildWiFi()
+	case "vcard":
+		return p.buildVCard(), nil
+	case "url":
+		return p.buildURL()
+	case "epc":
+		return p.buildEPC()
+	}
+	return "", fmt.Errorf("unknown payload type '%s'", p.Type)
+}
+
+// checkFields checks the type is known, every field belongs to it and the
+// required ones are set. Dynamic fields count as set if allowDynamic.
+func (p *QRPayload) checkFields(allowDynamic bool) error {
+	known, ok := QRPayloadFields[p.Type]
+	if !ok {
+		return fmt.Errorf("invalid payload type '%s' (must be wifi, vcard, url or epc)", p.Type)
+	}
+
+	isKnown := func(field string) bool {
+		for _, k := range known {
+			if k == field {
+				return true
+			}
+		}
+		return false
+	}
+	for field := range p.Fields {
+		if !isKnown(field) {
+			return fmt.Errorf("unknown %s payload field '%s'", p.Type, field)
+		}
+	}
+	for field := range p.DynamicFields {
+		if !isKnown(field) {
+			return fmt.Errorf("unknown %s payload field '%s'", p.Type, field)
+		}
+		if !allowDynamic {
+			return fmt.Errorf("%s payload field '%s' has not been resolved", p.Type, field)
+		}
+	}
+
+	for _, field := range known[:qrPayloadRequired[p.Type]] {
+		if p.Fields[field] == "" && p.DynamicFields[field] == "" {
+			return fmt.Errorf("%s payload requires %s", p.Type, field)
+		}
+	}
+	return nil
+}
+
+// buildWiFi returns a WIFI: network configuration, as read by phone cameras
+func (p *QRPayload) buildWiFi() (string, error) {
+	escape := strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, `:`, `\:`, `"`, `\"`)
+
+	security := strings.ToUpper(p.Fields["security"])
+	switch security {
+	case "":
+		security = "WPA"
+		if p.Fields["password"] == "" {
+			security = "nopass"
+		}
+	case "WPA", "WEP":
+	case "NOPASS":
+		security = "nopass"
+	default:
+		return "", fmt.Errorf("invalid wifi security '%s' (must be WPA, WEP or nopass)", p.Fields["security"])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "WIFI:T:%s;S:%s;", security, escape.Replace(p.Fields["ssid"]))
+	if security != "nopass" {
+		fmt.Fprintf(&b, "P:%s;", escape.Replace(p.Fields["password"]))
+	}
+	if hidden, _ := strconv.ParseBool(p.Fields["hidden"]); hidden {
+		b.WriteString("H:true;")
+	}
+	b.WriteString(";")
+	return b.String(), nil
+}
+
+// buildVCard returns a vCard 3.0 contact
+func (p *QRPayload) buildVCard() string {
+	escape := strings.NewReplacer(`\`, `\\`, `,`, `\,`, `;`, `\;`, "\n", `\n`)
+	lines := []string{"BEGIN:VCARD", "VERSION:3.0"}
+
+	name := escape.Replace(p.Fields["name"])
+	lines = append(lines, "N:"+name+";;;;", "FN:"+name)
+	for _, property := range []struct{ field, prefix string }{
+		{"organization", "ORG:"},
+		{"title", "TITLE:"},
+		{"phone", "TEL:"},
+		{"email", "EMAIL:"},
+		{"url", "URL:"},
+		{"address", "ADR:;;"}, // Street field of the structured address
+		{"note", "NOTE:"},
+	} {
+		if value := p.Fields[property.field]; value != "" {
+			lines = append(lines, property.prefix+escape.Replace(value))
+		}
+	}
+
+	lines = append(lines, "END:VCARD")
+	return strings.Join(lines, "\r\n")
+}
+
+func (p *QRPayload) buildURL() (string, error) {
+	url := p.Fields["url"]
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("url payload must start with http:// or https://")
+	}
+	return url, nil
+}
+
+// buildEPC returns a European Payments Council SEPA credit transfer (EPC069-12
+// version 002), which banking apps turn into a prefilled payment
+func (p *QRPayload) buildEPC() (string, error) {
+	f := p.Fields
+
+	iban := strings.ToUpper(strings.ReplaceAll(f["iban"], " ", ""))
+	if !validIBAN(iban) {
+		return "", fmt.Errorf("invalid IBAN '%s'", f["iban"])
+	}
+
+	amount, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(f["amount"]), "EUR"), 64)
+	if err != nil || amount < 0.01 || amount > 999999999.99 {
+		return "", fmt.Errorf("invalid epc amount '%s' (must be 0.01 to 999999999.99 EUR)", f["amount"])
+	}
+
+	if f["reference"] != "" && f["text"] != "" {
+		return "", fmt.Errorf("epc payload can have a reference or a text, not both")
+	}
+	for _, limit := range []struct {
+		field  string
+		length int
+	}{{"name", 70}, {"bic", 11}, {"purpose", 4}, {"reference", 35}, {"text", 140}, {"info", 70}} {
+		if utf8.RuneCountInString(f[limit.field]) > limit.length {
+			return "", fmt.Errorf("epc %s is longer than %d characters", limit.field, limit.length)
+		}
+	}
+
+	payload := strings.Join([]string{
+		"BCD", "002", "1", "SCT",
+		strings.ToUpper(f["bic"]),
+		f["name"],
+		iban,
+		fmt.Sprintf("EUR%.2f", amount),
+		strings.ToUpper(f["purpose"]),
+		f["reference"],
+		f["text"],
+		f["info"],
+	}, "\n")
+	if len(payload) > 331 {
+		return "", fmt.Errorf("epc payload is longer than 331 bytes")
+	}
+	return payload, nil
+}
+
+// validIBAN checks an IBAN's length and mod 97 checksum
+func validIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	// Move the country code and check digits to the end, then letters become 10-35
+	var digits strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			digits.WriteString(strconv.Itoa(int(c-'A') + 10))
+		default:
+			return false
+		}
+	}
+
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -8,6 +8,8 @@ type Receipt struct {
 	Description    string                    `json:"description,omitempty"`
 	CreatedWith    string                    `json:"created_with,omitempty"`
 	PaperWidth     string                    `json:"paper_width,omitempty"` // "58mm", "80mm", "112mm"
+	Output         string                    `json:"output,omitempty"`      // "raster" or "native"; defaults to the printer's setting
+	Locale         string                    `json:"locale,omitempty"`      // Default locale for formatted variables, e.g. "de-DE"
 	Fonts          map[string]FontFamily     `json:"fonts,omitempty"`
 	Variables      []Variable                `json:"variables,omitempty"`
 	VariableArrays []VariableArray           `json:"variableArrays,omitempty"`
@@ -16,9 +18,10 @@ type Receipt struct {
 
 // FontFamily can be either static or variable
 type FontFamily struct {
-	Type    string       `json:"type"` // "static" or "variable"
-	Path    string       `json:"path,omitempty"`
-	Weights []FontWeight `json:"weights,omitempty"`
+	Type      string       `json:"type"` // "static" or "variable"
+	Path      string       `json:"path,omitempty"`
+	Weights   []FontWeight `json:"weights,omitempty"`
+	Fallbacks []string     `json:"fallbacks,omitempty"` // Families tried in order for characters this one lacks
 }
 
 // FontWeight defines a single weight variant for static fonts
@@ -31,10 +34,12 @@ type FontWeight struct {
 // Variable represents a template variable
 type Variable struct {
 	Let          string      `json:"let"`
-	ValueType    string      `json:"valueType"` // string, number, double, boolean
+	ValueType    string      `json:"valueType"` // string, number, double, boolean, date
 	DefaultValue interface{} `json:"defaultValue,omitempty"`
 	Prefix       string      `json:"prefix,omitempty"`
 	Suffix       string      `json:"suffix,omitempty"`
+	Format       *Format     `json:"format,omitempty"`
+	Expression   string      `json:"expression,omitempty"` // Computes the value from other variables and arrays instead of data
 	Description  string      `json:"description,omitempty"`
 }
 
@@ -45,39 +50,84 @@ type VariableArray struct {
 	Schema      []VariableArrayField `json:"schema"`
 }
 
-// VariableArrayField defines a field in a variable array
+// VariableArrayField defines a field in a variable array. A field of type
+// array holds a nested list of entries, such as a line item's modifiers.
 type VariableArrayField struct {
-	Field        string      `json:"field"`
-	ValueType    string      `json:"valueType"`
-	DefaultValue interface{} `json:"defaultValue,omitempty"`
-	Prefix       string      `json:"prefix,omitempty"`
-	Suffix       string      `json:"suffix,omitempty"`
-	Description  string      `json:"description,omitempty"`
+	Field        string               `json:"field"`
+	ValueType    string               `json:"valueType"` // string, number, double, boolean, date or array
+	DefaultValue interface{}          `json:"defaultValue,omitempty"`
+	Prefix       string               `json:"prefix,omitempty"`
+	Suffix       string               `json:"suffix,omitempty"`
+	Format       *Format              `json:"format,omitempty"`
+	Schema       []VariableArrayField `json:"schema,omitempty"` // Fields of a nested array's entries
+	Description  string               `json:"description,omitempty"`
+}
+
+// Span is a run of text with its own style inside a text command. Size,
+// weight and italic default to the text command's.
+type Span struct {
+	Value         string `json:"value,omitempty"`
+	DynamicValue  string `json:"dynamicValue,omitempty"`
+	ArrayField    string `json:"arrayField,omitempty"`
+	Weight        string `json:"weight,omitempty"`
+	Italic        bool   `json:"italic,omitempty"`
+	Underline     bool   `json:"underline,omitempty"`
+	Strikethrough bool   `json:"strikethrough,omitempty"`
+	Inverted      bool   `json:"inverted,omitempty"` // White on a black highlight
+	Size          int    `json:"size,omitempty"`
+}
+
+// SwitchCase is a branch of a switch command, printed when the switch's
+// expression equals its value
+type SwitchCase struct {
+	Value    string    `json:"value"`
+	Commands []Command `json:"commands"`
 }
 
 // Command represents any receipt command
 type Command struct {
-	Type         string      `json:"type"`
-	ArrayBinding string      `json:"arrayBinding,omitempty"`
+	Type         string    `json:"type"`
+	ArrayBinding string    `json:"arrayBinding,omitempty"` // A receipt array, or an array field of the entry this command is nested in
+	Condition    string    `json:"condition,omitempty"`    // Expression; the command is left out when it's false
+	GroupBy      string    `json:"group_by,omitempty"`     // Array field to group entries by, printing each group under a header
+	GroupHeader  []Command `json:"group_header,omitempty"` // Printed before each group (default: the group's value in bold)
+	GroupFooter  []Command `json:"group_footer,omitempty"` // Printed after each group, e.g. a subtotal
 	
 	// Text command
-	Value        string `json:"value,omitempty"`
-	DynamicValue string `json:"dynamicValue,omitempty"`
-	ArrayField   string `json:"arrayField,omitempty"`
-	Weight       string `json:"weight,omitempty"`
-	Italic       bool   `json:"italic,omitempty"`
-	FontFamily   string `json:"font_family,omitempty"`
-	Size         int    `json:"size,omitempty"`
-	Align        string `json:"align,omitempty"`
+	Value        string  `json:"value,omitempty"`
+	DynamicValue string  `json:"dynamicValue,omitempty"`
+	ArrayField   string  `json:"arrayField,omitempty"`
+	Expression   string  `json:"expression,omitempty"` // Computes the value, e.g. "sum(products.price * products.qty)"; also for code values
+	Weight       string  `json:"weight,omitempty"`
+	Italic       bool    `json:"italic,omitempty"`
+	FontFamily   string  `json:"font_family,omitempty"`
+	Size         int     `json:"size,omitempty"`
+	Align        string  `json:"align,omitempty"`
+	LineSpacing  float64 `json:"line_spacing,omitempty"` // Distance between wrapped lines, as a multiple of the font height (default 1.25)
+	MaxLines     int     `json:"max_lines,omitempty"`    // Lines shown before the rest is cut off with an ellipsis, 0 for all
+	Spans        []Span  `json:"spans,omitempty"`        // Differently styled runs of text, instead of a value
 	
 	// Image command
-	Path      string `json:"path,omitempty"`
-	Base64    string `json:"base64,omitempty"`
-	Threshold int    `json:"threshold,omitempty"`
+	Path       string  `json:"path,omitempty"`
+	Base64     string  `json:"base64,omitempty"`
+	URL        string  `json:"url,omitempty"` // http(s), fetched through the image cache
+	Threshold  int     `json:"threshold,omitempty"`
+	Dither     string  `json:"dither,omitempty"`     // none, threshold (default), floyd-steinberg, atkinson, bayer
+	Gamma      float64 `json:"gamma,omitempty"`      // Midtone correction, 1 is unchanged
+	Contrast   int     `json:"contrast,omitempty"`   // -100 to 100
+	Brightness int     `json:"brightness,omitempty"` // -100 to 100
 	
-	// Feed command
+	// Feed command (also the lines fed before a cut)
 	Lines int `json:"lines,omitempty"`
 	
+	// Cut command
+	Mode string `json:"mode,omitempty"` // "full" (default) or "partial"
+	
+	// Drawer command
+	Pin     int `json:"pin,omitempty"`      // Kick-out connector pin: 2 (default) or 5
+	OnTime  int `json:"on_time,omitempty"`  // Pulse on time in ms (default 100)
+	OffTime int `json:"off_time,omitempty"` // Pulse off time in ms (default 500)
+	
 	// Item command
 	LeftSide     []Command `json:"left_side,omitempty"`
 	RightSide    []Command `json:"right_side,omitempty"`
@@ -93,11 +143,26 @@ type Command struct {
 	// Barcode command
 	Format   string `json:"format,omitempty"`
 	Height   int    `json:"height,omitempty"`
-	Width    int    `json:"width,omitempty"`
-	Position string `json:"position,omitempty"`
+	Width    int    `json:"width,omitempty"`    // Module width in dots, 1-6 (default 2)
+	Position string `json:"position,omitempty"` // Human-readable text: none (default), above, below or both
+	
+	// QR code command (Size is the module size in dots, default 6, Width the
+	// overall width in dots, and Align places the code)
+	ErrorCorrection string     `json:"error_correction,omitempty"`
+	WidthMM         float64    `json:"width_mm,omitempty"` // Overall width in mm
+	Caption         string     `json:"caption,omitempty"`  // Text printed under the code
+	Payload         *QRPayload `json:"payload,omitempty"`  // Builds the value from fields
+	
+	// PDF417, DataMatrix and Aztec commands (Size is the module size in dots)
+	ECCLevel int `json:"ecc_level,omitempty"` // PDF417 security level 0-8 (default 2), Aztec minimum error correction percent (default 23)
+	
+	// If command (Condition picks the branch)
+	Then []Command `json:"then,omitempty"`
+	Else []Command `json:"else,omitempty"`
 	
-	// QR code command
-	ErrorCorrection string `json:"error_correction,omitempty"`
+	// Switch command (Expression is compared to each case's value)
+	Cases   []SwitchCase `json:"cases,omitempty"`
+	Default []Command    `json:"default,omitempty"`
 	
 	// Folder/Box command
 	Commands     []Command `json:"commands,omitempty"`
@@ -1,6 +1,7 @@
 package receiptformat
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -199,6 +200,11 @@ func TestValidate_TextCommand(t *testing.T) {
 		{"valid align right", Command{Type: "text", Value: "Hello", Align: "right"}, false},
 		{"invalid align", Command{Type: "text", Value: "Hello", Align: "invalid"}, true},
 		{"no value", Command{Type: "text"}, true},
+		{"spans", Command{Type: "text", Spans: []Span{{Value: "Total: "}, {Value: "€4.50", Weight: "bold", Size: 40}}}, false},
+		{"value and spans", Command{Type: "text", Value: "Hello", Spans: []Span{{Value: "Hello"}}}, true},
+		{"empty span", Command{Type: "text", Spans: []Span{{Weight: "bold"}}}, true},
+		{"span with unknown variable", Command{Type: "text", Spans: []Span{{DynamicValue: "missing"}}}, true},
+		{"span arrayField without binding", Command{Type: "text", Spans: []Span{{ArrayField: "name"}}}, true},
 	}
 	
 	for _, tt := range tests {
@@ -226,6 +232,12 @@ func TestValidate_ImageCommand(t *testing.T) {
 		{"valid with base64", Command{Type: "image", Base64: "base64data"}, false},
 		{"invalid - no path or base64", Command{Type: "image"}, true},
 		{"invalid - both path and base64", Command{Type: "image", Path: "/path", Base64: "data"}, true},
+		{"valid with url", Command{Type: "image", URL: "https://example.com/logo.png"}, false},
+		{"invalid - both url and path", Command{Type: "image", URL: "https://example.com/logo.png", Path: "/path"}, true},
+		{"invalid - url scheme", Command{Type: "image", URL: "file:///etc/passwd"}, true},
+		{"valid dithering", Command{Type: "image", Path: "/path", Dither: "atkinson", Gamma: 1.8, Contrast: 20, Brightness: -10}, false},
+		{"invalid - unknown dither", Command{Type: "image", Path: "/path", Dither: "halftone"}, true},
+		{"invalid - contrast out of range", Command{Type: "image", Path: "/path", Contrast: 150}, true},
 	}
 	
 	for _, tt := range tests {
@@ -267,6 +279,465 @@ func TestValidate_BarcodeCommand(t *testing.T) {
 	}
 }
 
+func TestValidate_BarcodeFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     Command
+		wantErr bool
+	}{
+		{"EAN13 without check digit", Command{Type: "barcode", Format: "EAN13", Value: "400638133393"}, false},
+		{"EAN13 with check digit", Command{Type: "barcode", Format: "EAN13", Value: "4006381333931"}, false},
+		{"EAN13 wrong check digit", Command{Type: "barcode", Format: "EAN13", Value: "4006381333932"}, true},
+		{"EAN8 wrong length", Command{Type: "barcode", Format: "EAN8", Value: "12345"}, true},
+		{"UPC_A", Command{Type: "barcode", Format: "UPC_A", Value: "036000291452"}, false},
+		{"UPC_A wrong check digit", Command{Type: "barcode", Format: "UPC_A", Value: "036000291453"}, true},
+		{"UPC_E", Command{Type: "barcode", Format: "UPC_E", Value: "04252614"}, false},
+		{"UPC_E bad number system", Command{Type: "barcode", Format: "UPC_E", Value: "2425261"}, true},
+		{"ITF odd length", Command{Type: "barcode", Format: "ITF", Value: "12345"}, true},
+		{"CODE39 lowercase", Command{Type: "barcode", Format: "CODE39", Value: "abc"}, true},
+		{"CODABAR", Command{Type: "barcode", Format: "CODABAR", Value: "A40156B"}, false},
+		{"CODABAR missing stop", Command{Type: "barcode", Format: "CODABAR", Value: "A40156"}, true},
+		{"GS1_128", Command{Type: "barcode", Format: "GS1_128", Value: "(01)09501101530003(10)ABC123(17)250101"}, false},
+		{"GS1_128 wrong GTIN check digit", Command{Type: "barcode", Format: "GS1_128", Value: "(01)09501101530004"}, true},
+		{"GS1_128 without AI", Command{Type: "barcode", Format: "GS1_128", Value: "0109501101530003"}, true},
+		{"unknown format", Command{Type: "barcode", Format: "MAXICODE", Value: "123"}, true},
+		{"text below", Command{Type: "barcode", Value: "123", Position: "below"}, false},
+		{"invalid position", Command{Type: "barcode", Value: "123", Position: "left"}, true},
+		{"module width too large", Command{Type: "barcode", Value: "123", Width: 8}, true},
+		{"pdf417", Command{Type: "pdf417", Value: "data", ECCLevel: 4}, false},
+		{"pdf417 ecc too high", Command{Type: "pdf417", Value: "data", ECCLevel: 9}, true},
+		{"datamatrix", Command{Type: "datamatrix", Value: "data", Size: 4}, false},
+		{"aztec without value", Command{Type: "aztec"}, true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := &Receipt{Version: "1.0", Commands: []Command{tt.cmd}}
+			err := Validate(receipt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandUPCE(t *testing.T) {
+	tests := map[string]string{
+		"0425261": "04210000526",
+		"0123453": "01230000045",
+		"0123454": "01234000005",
+		"0123457": "01234500007",
+	}
+	for upce, upca := range tests {
+		if got := ExpandUPCE(upce); got != upca {
+			t.Errorf("ExpandUPCE(%s) = %s, want %s", upce, got, upca)
+		}
+	}
+}
+
+func TestQRPayload_Build(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload QRPayload
+		want    string
+		wantErr bool
+	}{
+		{
+			"wifi",
+			QRPayload{Type: "wifi", Fields: map[string]string{"ssid": "Cafe;Guest", "password": "beans"}},
+			`WIFI:T:WPA;S:Cafe\;Guest;P:beans;;`, false,
+		},
+		{
+			"open wifi",
+			QRPayload{Type: "wifi", Fields: map[string]string{"ssid": "Cafe", "hidden": "true"}},
+			"WIFI:T:nopass;S:Cafe;H:true;;", false,
+		},
+		{
+			"vcard",
+			QRPayload{Type: "vcard", Fields: map[string]string{"name": "Coffee Shop", "phone": "+44 20 7946 0000"}},
+			"BEGIN:VCARD\r\nVERSION:3.0\r\nN:Coffee Shop;;;;\r\nFN:Coffee Shop\r\nTEL:+44 20 7946 0000\r\nEND:VCARD", false,
+		},
+		{
+			"url",
+			QRPayload{Type: "url", Fields: map[string]string{"url": "https://example.com/pay/42"}},
+			"https://example.com/pay/42", false,
+		},
+		{
+			"epc",
+			QRPayload{Type: "epc", Fields: map[string]string{"name": "Coffee Shop", "iban": "DE89 3704 0044 0532 0130 00", "amount": "3.5", "reference": "RF18539007547034"}},
+			"BCD\n002\n1\nSCT\n\nCoffee Shop\nDE89370400440532013000\nEUR3.50\n\nRF18539007547034\n\n", false,
+		},
+		{"epc bad IBAN", QRPayload{Type: "epc", Fields: map[string]string{"name": "Shop", "iban": "DE89370400440532013001", "amount": "1"}}, "", true},
+		{"epc missing amount", QRPayload{Type: "epc", Fields: map[string]string{"name": "Shop", "iban": "DE89370400440532013000"}}, "", true},
+		{"url without scheme", QRPayload{Type: "url", Fields: map[string]string{"url": "example.com"}}, "", true},
+		{"unknown field", QRPayload{Type: "wifi", Fields: map[string]string{"ssid": "Cafe", "channel": "6"}}, "", true},
+		{"unknown type", QRPayload{Type: "sms"}, "", true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.payload.Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Build() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_QRCodeCommand(t *testing.T) {
+	payload := &QRPayload{Type: "url", DynamicFields: map[string]string{"url": "link"}}
+	tests := []struct {
+		name    string
+		cmd     Command
+		wantErr bool
+	}{
+		{"value", Command{Type: "qrcode", Value: "hello", Size: 4, Align: "right", Caption: "Scan me"}, false},
+		{"payload from a variable", Command{Type: "qrcode", Payload: payload}, false},
+		{"unknown variable", Command{Type: "qrcode", Payload: &QRPayload{Type: "url", DynamicFields: map[string]string{"url": "missing"}}}, true},
+		{"value and payload", Command{Type: "qrcode", Value: "hello", Payload: payload}, true},
+		{"width and width_mm", Command{Type: "qrcode", Value: "hello", Width: 200, WidthMM: 25}, true},
+		{"module size too large", Command{Type: "qrcode", Value: "hello", Size: 20}, true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := &Receipt{
+				Version:   "1.0",
+				Variables: []Variable{{Let: "link", ValueType: "string"}},
+				Commands:  []Command{tt.cmd},
+			}
+			err := Validate(receipt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_FontFallbacks(t *testing.T) {
+	tests := []struct {
+		name    string
+		fonts   map[string]FontFamily
+		wantErr bool
+	}{
+		{"declared fallback", map[string]FontFamily{"brand": {Path: "brand.ttf", Fallbacks: []string{"cjk"}}, "cjk": {Path: "cjk.ttf"}}, false},
+		{"unknown fallback", map[string]FontFamily{"brand": {Path: "brand.ttf", Fallbacks: []string{"cjk"}}}, true},
+		{"own fallback", map[string]FontFamily{"brand": {Path: "brand.ttf", Fallbacks: []string{"brand"}}}, true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := &Receipt{
+				Version:  "1.0",
+				Fonts:    tt.fonts,
+				Commands: []Command{{Type: "text", Value: "Hello"}},
+			}
+			err := Validate(receipt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	zero, two := 0, 2
+	tests := []struct {
+		name      string
+		value     interface{}
+		valueType string
+		format    *Format
+		locale    string
+		want      string
+	}{
+		{"plain double", 12.5, "double", nil, "", "12.5"},
+		{"float noise", 0.1 + 0.2, "double", nil, "", "0.3"},
+		{"decimals", 12.5, "double", &Format{Decimals: &two}, "", "12.50"},
+		{"rounded", 2.675, "double", &Format{Decimals: &zero}, "", "3"},
+		{"grouping", 1234567.891, "double", &Format{Decimals: &two, Grouping: true}, "", "1,234,567.89"},
+		{"german grouping", 1234567.891, "double", &Format{Decimals: &two, Grouping: true}, "de-DE", "1.234.567,89"},
+		{"dollars", 12.5, "double", &Format{Currency: "USD"}, "", "$12.50"},
+		{"negative dollars", -3, "double", &Format{Currency: "USD"}, "en-US", "-$3.00"},
+		{"euros in germany", 12.5, "double", &Format{Currency: "EUR"}, "de-DE", "12,50\u00a0€"},
+		{"euros in the netherlands", 12.5, "double", &Format{Currency: "EUR", Locale: "nl-NL"}, "", "€\u00a012,50"},
+		{"francs in switzerland", 12.5, "double", &Format{Currency: "CHF"}, "de-CH", "CHF\u00a012.50"},
+		{"francs in french switzerland", 12.5, "double", &Format{Currency: "CHF"}, "fr-CH", "CHF\u00a012,50"},
+		{"reais in brazil", 12.5, "double", &Format{Currency: "BRL"}, "pt-BR", "R$\u00a012,50"},
+		{"euros in portugal", 12.5, "double", &Format{Currency: "EUR"}, "pt-PT", "12,50\u00a0€"},
+		{"pesos in mexico", 12.5, "double", &Format{Currency: "MXN"}, "es-MX", "$12.50"},
+		{"yen has no decimals", 1200, "number", &Format{Currency: "JPY", Grouping: true}, "ja-JP", "￥1,200"},
+		{"percent", 0.155, "double", &Format{Percent: true}, "", "15.5%"},
+		{"number from a string", "7.25", "double", &Format{Decimals: &two}, "", "7.25"},
+		{"not a number", "n/a", "double", &Format{Decimals: &two}, "", "n/a"},
+		{"date only", "2024-03-01", "date", nil, "", "2024-03-01"},
+		{"datetime", "2024-03-01T18:30:00Z", "date", nil, "", "2024-03-01 18:30"},
+		{"timezone", "2024-03-01T18:30:00Z", "date", &Format{Layout: "time", Timezone: "America/New_York"}, "", "13:30"},
+		{"timezone date only", "2026-03-15", "date", &Format{Timezone: "America/New_York"}, "", "2026-03-15"},
+		{"unix seconds", 1709317800.0, "date", &Format{Layout: "Jan 2, 2006"}, "", "Mar 1, 2024"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatValue(tt.value, tt.valueType, tt.format, tt.locale); got != tt.want {
+				t.Errorf("FormatValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_VariableFormat(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		name      string
+		valueType string
+		format    Format
+		wantErr   bool
+	}{
+		{"currency", "double", Format{Currency: "EUR", Locale: "fr-FR"}, false},
+		{"date layout", "date", Format{Layout: "datetime", Timezone: "Europe/Berlin"}, false},
+		{"unknown currency", "double", Format{Currency: "EURO"}, true},
+		{"currency percent", "double", Format{Currency: "EUR", Percent: true}, true},
+		{"negative decimals", "double", Format{Decimals: &negative}, true},
+		{"currency on a string", "string", Format{Currency: "EUR"}, true},
+		{"layout on a number", "number", Format{Layout: "date"}, true},
+		{"unknown timezone", "date", Format{Timezone: "Mars/Olympus"}, true},
+		{"invalid locale", "double", Format{Locale: "not a locale"}, true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := tt.format
+			receipt := &Receipt{
+				Version:   "1.0",
+				Variables: []Variable{{Let: "value", ValueType: tt.valueType, Format: &format}},
+				Commands:  []Command{{Type: "text", DynamicValue: "value"}},
+			}
+			err := Validate(receipt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpression_Eval(t *testing.T) {
+	values := map[string]interface{}{
+		"name":           "ada",
+		"rate":           0.2,
+		"products.price": []interface{}{2.5, 4.0},
+		"products.qty":   []interface{}{2.0, 3.0},
+	}
+	env := ExprEnv{Lookup: func(name string) (interface{}, error) { return values[name], nil }}
+	
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"-2 * -3 % 4", "2"},
+		{"sum(products.price * products.qty)", "17"},
+		{"sum(products.price * products.qty) * (1 + rate)", "20.4"},
+		{"count(products.qty)", "2"},
+		{"max(products.price) - min(products.price)", "1.5"},
+		{"avg(products.qty)", "2.5"},
+		{"round(2.675, 2)", "2.68"},
+		{"floor(2.7) + ceil(2.1) + abs(-1)", "6"},
+		{"'Hello ' + upper(name)", "Hello ADA"},
+		{"len(trim('  ab  '))", "2"},
+		{"products.price * 2", "5, 8"},
+		{"format(1234.5, 'EUR')", "€1234.50"},
+		{"format(rate, 'percent')", "20%"},
+		{"format(2, 2)", "2.00"},
+		{"sum(products.qty) >= 5 && name == 'ada'", "true"},
+		{"!(rate > 1) || missing", "true"},
+		{"'b' < 'a'", "false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseExpression() error = %v", err)
+			}
+			got, err := expr.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if ExprString(got) != tt.want {
+				t.Errorf("Eval() = %q, want %q", ExprString(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestExpression_Errors(t *testing.T) {
+	parseErrors := []string{"1 +", "(1", "'open", "1 $ 2", "nope(1)", "round()", "a < b < c", "products."}
+	for _, src := range parseErrors {
+		if _, err := ParseExpression(src); err == nil {
+			t.Errorf("ParseExpression(%q) expected an error", src)
+		}
+	}
+	
+	list := []interface{}{1.0, 2.0}
+	env := ExprEnv{Lookup: func(name string) (interface{}, error) { return list, nil }}
+	evalErrors := []string{"1 / 0", "'a' * 2", "items.a > 1", "items.a * 'x'", "min(items.a) + max(upper('x'))"}
+	for _, src := range evalErrors {
+		expr, err := ParseExpression(src)
+		if err != nil {
+			t.Fatalf("ParseExpression(%q) error = %v", src, err)
+		}
+		if _, err := expr.Eval(env); err == nil {
+			t.Errorf("Eval(%q) expected an error", src)
+		}
+	}
+}
+
+func TestExpression_Limits(t *testing.T) {
+	tooDeep := []string{
+		strings.Repeat("(", 2000000) + "1" + strings.Repeat(")", 2000000),
+		strings.Repeat("(", MaxExpressionDepth+1) + "1" + strings.Repeat(")", MaxExpressionDepth+1),
+		strings.Repeat("-", MaxExpressionDepth+1) + "1",
+		strings.Repeat("!", MaxExpressionDepth+1) + "true",
+		strings.Repeat("abs(", MaxExpressionDepth+1) + "1" + strings.Repeat(")", MaxExpressionDepth+1),
+	}
+	for _, src := range tooDeep {
+		if _, err := ParseExpression(src); err == nil {
+			t.Errorf("ParseExpression() of %d bytes expected an error", len(src))
+		}
+	}
+
+	nested := strings.Repeat("(", 50) + "-1" + strings.Repeat(")", 50)
+	if _, err := ParseExpression(nested); err != nil {
+		t.Errorf("ParseExpression() of 50 levels error = %v", err)
+	}
+}
+
+func TestValidate_Expressions(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables []Variable
+		command   Command
+		wantErr   bool
+	}{
+		{"text", nil, Command{Type: "text", Expression: "sum(products.price) * tax"}, false},
+		{"computed variable", []Variable{{Let: "total", ValueType: "double", Expression: "sum(products.price)"}}, Command{Type: "text", DynamicValue: "total"}, false},
+		{"qrcode", nil, Command{Type: "qrcode", Expression: "'https://example.com/' + tax"}, false},
+		{"nested", nil, Command{Type: "item", LeftSide: []Command{{Type: "text", Value: "Total"}}, RightSide: []Command{{Type: "text", Expression: "missing + 1"}}}, true},
+		{"unknown variable", nil, Command{Type: "text", Expression: "missing * 2"}, true},
+		{"unknown array", nil, Command{Type: "text", Expression: "sum(orders.price)"}, true},
+		{"unknown field", nil, Command{Type: "text", Expression: "sum(products.cost)"}, true},
+		{"syntax error", nil, Command{Type: "text", Expression: "tax *"}, true},
+		{"value and expression", nil, Command{Type: "text", Value: "x", Expression: "tax"}, true},
+		{"barcode value and expression", nil, Command{Type: "barcode", Format: "CODE128", Value: "x", Expression: "tax"}, true},
+		{"cycle", []Variable{{Let: "a", ValueType: "double", Expression: "b + 1"}, {Let: "b", ValueType: "double", Expression: "a * 2"}}, Command{Type: "text", DynamicValue: "a"}, true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := &Receipt{
+				Version:        "1.0",
+				Variables:      append([]Variable{{Let: "tax", ValueType: "double"}}, tt.variables...),
+				VariableArrays: []VariableArray{{Name: "products", Schema: []VariableArrayField{{Field: "price", ValueType: "double"}}}},
+				Commands:       []Command{tt.command},
+			}
+			err := Validate(receipt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_Conditionals(t *testing.T) {
+	text := func(value string) Command { return Command{Type: "text", Value: value} }
+	tests := []struct {
+		name    string
+		command Command
+		wantErr bool
+	}{
+		{"condition", Command{Type: "text", Value: "Member", Condition: "member != ''"}, false},
+		{"if", Command{Type: "if", Condition: "paid", Then: []Command{text("PAID")}, Else: []Command{text("BALANCE DUE")}}, false},
+		{"if without then", Command{Type: "if", Condition: "!paid", Else: []Command{text("BALANCE DUE")}}, false},
+		{"switch", Command{Type: "switch", Expression: "member", Cases: []SwitchCase{{Value: "gold", Commands: []Command{text("Gold")}}}, Default: []Command{text("Guest")}}, false},
+		{"unknown variable in condition", Command{Type: "text", Value: "x", Condition: "missing"}, true},
+		{"if without condition", Command{Type: "if", Then: []Command{text("x")}}, true},
+		{"if without branches", Command{Type: "if", Condition: "paid"}, true},
+		{"invalid branch command", Command{Type: "if", Condition: "paid", Then: []Command{{Type: "text"}}}, true},
+		{"unknown variable in branch", Command{Type: "if", Condition: "paid", Else: []Command{{Type: "text", Expression: "missing"}}}, true},
+		{"switch without expression", Command{Type: "switch", Cases: []SwitchCase{{Value: "a", Commands: []Command{text("a")}}}}, true},
+		{"switch without cases", Command{Type: "switch", Expression: "member"}, true},
+		{"duplicate case", Command{Type: "switch", Expression: "member", Cases: []SwitchCase{{Value: "a"}, {Value: "a"}}}, true},
+		{"unknown variable in case", Command{Type: "switch", Expression: "member", Cases: []SwitchCase{{Value: "a", Commands: []Command{{Type: "text", Value: "x", Condition: "missing"}}}}}, true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := &Receipt{
+				Version: "1.0",
+				Variables: []Variable{
+					{Let: "paid", ValueType: "boolean"},
+					{Let: "member", ValueType: "string"},
+				},
+				Commands: []Command{tt.command},
+			}
+			err := Validate(receipt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_NestedArrays(t *testing.T) {
+	text := func(field string) Command { return Command{Type: "text", ArrayField: field} }
+	tests := []struct {
+		name    string
+		fields  []VariableArrayField
+		command Command
+		wantErr bool
+	}{
+		{"nested binding", nil, Command{Type: "box", ArrayBinding: "products", Commands: []Command{text("name"), {Type: "text", ArrayBinding: "modifiers", ArrayField: "label"}}}, false},
+		{"nested expression", nil, Command{Type: "text", ArrayBinding: "products", Expression: "products.price + sum(modifiers.price)"}, false},
+		{"group by", nil, Command{Type: "text", ArrayBinding: "products", ArrayField: "name", GroupBy: "category", GroupFooter: []Command{{Type: "text", Expression: "sum(products.price)"}}}, false},
+		{"nested array outside its entry", nil, Command{Type: "text", Expression: "sum(modifiers.price)"}, true},
+		{"nested binding outside its entry", nil, Command{Type: "text", ArrayBinding: "modifiers", ArrayField: "label"}, true},
+		{"field of the outer array", nil, Command{Type: "box", ArrayBinding: "products", Commands: []Command{{Type: "text", ArrayBinding: "modifiers", ArrayField: "category"}}}, true},
+		{"unknown field", nil, Command{Type: "text", ArrayBinding: "products", ArrayField: "color"}, true},
+		{"arrayField in a box without binding", nil, Command{Type: "box", Commands: []Command{text("name")}}, true},
+		{"array field without schema", []VariableArrayField{{Field: "tags", ValueType: "array"}}, Command{Type: "text", Value: "x"}, true},
+		{"schema on a string field", []VariableArrayField{{Field: "tags", ValueType: "string", Schema: []VariableArrayField{{Field: "a", ValueType: "string"}}}}, Command{Type: "text", Value: "x"}, true},
+		{"group by without binding", nil, Command{Type: "text", Value: "x", GroupBy: "category"}, true},
+		{"group by unknown field", nil, Command{Type: "text", ArrayBinding: "products", ArrayField: "name", GroupBy: "color"}, true},
+		{"group by array field", nil, Command{Type: "text", ArrayBinding: "products", ArrayField: "name", GroupBy: "modifiers"}, true},
+		{"group header without group by", nil, Command{Type: "text", ArrayBinding: "products", ArrayField: "name", GroupHeader: []Command{text("category")}}, true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := []VariableArrayField{
+				{Field: "name", ValueType: "string"},
+				{Field: "category", ValueType: "string"},
+				{Field: "price", ValueType: "double"},
+				{Field: "modifiers", ValueType: "array", Schema: []VariableArrayField{
+					{Field: "label", ValueType: "string"},
+					{Field: "price", ValueType: "double"},
+				}},
+			}
+			receipt := &Receipt{
+				Version:        "1.0",
+				VariableArrays: []VariableArray{{Name: "products", Schema: append(fields, tt.fields...)}},
+				Commands:       []Command{tt.command},
+			}
+			err := Validate(receipt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestParse_ValidJSON(t *testing.T) {
 	jsonData := `{
 		"version": "1.0",
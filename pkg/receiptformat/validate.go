@@ -3,6 +3,8 @@ package receiptformat
 import (
 	"fmt"
 	"strings"
+	
+	"golang.org/x/text/language"
 )
 
 // Validate validates a Receipt structure
@@ -30,6 +32,30 @@ func Validate(r *Receipt) error {
 		}
 	}
 	
+	// Validate output mode if specified
+	if r.Output != "" && r.Output != "raster" && r.Output != "native" {
+		return fmt.Errorf("invalid output: %s (must be raster or native)", r.Output)
+	}
+	
+	// Validate locale if specified
+	if r.Locale != "" {
+		if _, err := language.Parse(r.Locale); err != nil {
+			return fmt.Errorf("invalid locale: %s", r.Locale)
+		}
+	}
+	
+	// Validate font fallbacks
+	for name, family := range r.Fonts {
+		for _, fallback := range family.Fallbacks {
+			if fallback == name {
+				return fmt.Errorf("font '%s' cannot be its own fallback", name)
+			}
+			if _, ok := r.Fonts[fallback]; !ok {
+				return fmt.Errorf("font '%s': unknown fallback font '%s'", name, fallback)
+			}
+		}
+	}
+	
 	// Validate variables
 	variableNames := make(map[string]bool)
 	for i, v := range r.Variables {
@@ -44,6 +70,11 @@ func Validate(r *Receipt) error {
 		if err := validateValueType(v.ValueType); err != nil {
 			return fmt.Errorf("variable[%d] '%s': %w", i, v.Let, err)
 		}
+		if v.Format != nil {
+			if err := v.Format.Validate(v.ValueType); err != nil {
+				return fmt.Errorf("variable[%d] '%s': %w", i, v.Let, err)
+			}
+		}
 	}
 	
 	// Validate variable arrays
@@ -58,29 +89,32 @@ func Validate(r *Receipt) error {
 		arrayNames[arr.Name] = true
 		
 		// Validate schema fields
-		fieldNames := make(map[string]bool)
-		for j, field := range arr.Schema {
-			if field.Field == "" {
-				return fmt.Errorf("variableArray[%d] '%s' field[%d]: 'field' is required", i, arr.Name, j)
-			}
-			if fieldNames[field.Field] {
-				return fmt.Errorf("variableArray[%d] '%s' field[%d]: duplicate field name '%s'", i, arr.Name, j, field.Field)
-			}
-			fieldNames[field.Field] = true
-			
-			if err := validateValueType(field.ValueType); err != nil {
-				return fmt.Errorf("variableArray[%d] '%s' field[%d] '%s': %w", i, arr.Name, j, field.Field, err)
-			}
+		if err := validateArrayFields(arr.Schema); err != nil {
+			return fmt.Errorf("variableArray[%d] '%s' %w", i, arr.Name, err)
 		}
 	}
 	
+	// Validate computed variables, now every name they can use is known
+	top := &bindingScope{receipt: r}
+	for i, v := range r.Variables {
+		if v.Expression == "" {
+			continue
+		}
+		if err := top.checkExpression(v.Expression); err != nil {
+			return fmt.Errorf("variable[%d] '%s': expression: %w", i, v.Let, err)
+		}
+	}
+	if err := checkVariableCycles(r); err != nil {
+		return err
+	}
+	
 	// Validate commands
 	if len(r.Commands) == 0 {
 		return fmt.Errorf("at least one command is required")
 	}
 	
 	for i, cmd := range r.Commands {
-		if err := validateCommand(&cmd, variableNames, arrayNames); err != nil {
+		if err := validateCommand(&cmd, variableNames, top); err != nil {
 			return fmt.Errorf("command[%d]: %w", i, err)
 		}
 	}
@@ -88,41 +122,262 @@ func Validate(r *Receipt) error {
 	return nil
 }
 
+// validateArrayFields checks an array's fields, and the fields of arrays
+// nested in it
+func validateArrayFields(fields []VariableArrayField) error {
+	fieldNames := make(map[string]bool)
+	for j, field := range fields {
+		if field.Field == "" {
+			return fmt.Errorf("field[%d]: 'field' is required", j)
+		}
+		if fieldNames[field.Field] {
+			return fmt.Errorf("field[%d]: duplicate field name '%s'", j, field.Field)
+		}
+		fieldNames[field.Field] = true
+		
+		if field.ValueType == "array" {
+			if len(field.Schema) == 0 {
+				return fmt.Errorf("field[%d] '%s': array field requires schema", j, field.Field)
+			}
+			if err := validateArrayFields(field.Schema); err != nil {
+				return fmt.Errorf("field[%d] '%s' %w", j, field.Field, err)
+			}
+			continue
+		}
+		
+		if err := validateValueType(field.ValueType); err != nil {
+			return fmt.Errorf("field[%d] '%s': %w", j, field.Field, err)
+		}
+		if len(field.Schema) > 0 {
+			return fmt.Errorf("field[%d] '%s': only array fields have a schema", j, field.Field)
+		}
+		if field.Format != nil {
+			if err := field.Format.Validate(field.ValueType); err != nil {
+				return fmt.Errorf("field[%d] '%s': %w", j, field.Field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// bindingScope is what a command can refer to: the receipt's variables and
+// arrays, and the arrays it's bound to, innermost first
+type bindingScope struct {
+	receipt *Receipt
+	array   string               // Name of the bound array, "" outside array-bound commands
+	fields  []VariableArrayField // Fields of the bound array's entries
+	parent  *bindingScope
+}
+
+// bind returns the scope inside an arrayBinding. The name is an array field
+// of an entry the command is already bound to, or one of the receipt's arrays.
+func (s *bindingScope) bind(name string) (*bindingScope, error) {
+	for outer := s; outer != nil; outer = outer.parent {
+		if field := findField(outer.fields, name); field != nil && field.ValueType == "array" {
+			return &bindingScope{receipt: s.receipt, array: name, fields: field.Schema, parent: s}, nil
+		}
+	}
+	if array := s.receipt.variableArray(name); array != nil {
+		return &bindingScope{receipt: s.receipt, array: name, fields: array.Schema, parent: s}, nil
+	}
+	return nil, fmt.Errorf("unknown array '%s' in arrayBinding", name)
+}
+
+// arrayFields returns the fields of an array an expression names: a bound
+// array, an array field of a bound array's entries, or one of the receipt's
+// arrays
+func (s *bindingScope) arrayFields(name string) ([]VariableArrayField, bool) {
+	for outer := s; outer != nil; outer = outer.parent {
+		if outer.array == name {
+			return outer.fields, true
+		}
+		if field := findField(outer.fields, name); field != nil && field.ValueType == "array" {
+			return field.Schema, true
+		}
+	}
+	if array := s.receipt.variableArray(name); array != nil {
+		return array.Schema, true
+	}
+	return nil, false
+}
+
+// findField returns the field with a name, or nil
+func findField(fields []VariableArrayField, name string) *VariableArrayField {
+	for i := range fields {
+		if fields[i].Field == name {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// checkExpression parses an expression and checks every variable and array
+// field it uses is declared
+func (s *bindingScope) checkExpression(source string) error {
+	expr, err := ParseExpression(source)
+	if err != nil {
+		return err
+	}
+	
+	for _, name := range expr.Identifiers() {
+		arrayName, field, isField := strings.Cut(name, ".")
+		if !isField {
+			if s.receipt.variable(name) == nil {
+				return fmt.Errorf("unknown variable '%s'", name)
+			}
+			continue
+		}
+		
+		fields, ok := s.arrayFields(arrayName)
+		if !ok {
+			return fmt.Errorf("unknown array '%s' in '%s'", arrayName, name)
+		}
+		if findField(fields, field) == nil {
+			return fmt.Errorf("unknown field '%s' in array '%s'", field, arrayName)
+		}
+	}
+	return nil
+}
+
+// checkVariableCycles rejects computed variables that depend on themselves,
+// directly or through other computed variables
+func checkVariableCycles(r *Receipt) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	
+	var visit func(name string) error
+	visit = func(name string) error {
+		v := r.variable(name)
+		if v == nil || v.Expression == "" || state[name] == done {
+			return nil
+		}
+		if state[name] == visiting {
+			return fmt.Errorf("variable '%s' depends on itself", name)
+		}
+		state[name] = visiting
+		
+		expr, err := ParseExpression(v.Expression)
+		if err != nil {
+			return err
+		}
+		for _, used := range expr.Identifiers() {
+			if err := visit(used); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	
+	for _, v := range r.Variables {
+		if err := visit(v.Let); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variable returns the declared variable with a name, or nil
+func (r *Receipt) variable(name string) *Variable {
+	for i := range r.Variables {
+		if r.Variables[i].Let == name {
+			return &r.Variables[i]
+		}
+	}
+	return nil
+}
+
+// variableArray returns the declared variable array with a name, or nil
+func (r *Receipt) variableArray(name string) *VariableArray {
+	for i := range r.VariableArrays {
+		if r.VariableArrays[i].Name == name {
+			return &r.VariableArrays[i]
+		}
+	}
+	return nil
+}
+
 func validateValueType(vt string) error {
-	validTypes := []string{"string", "number", "double", "boolean"}
+	validTypes := []string{"string", "number", "double", "boolean", "date"}
 	for _, t := range validTypes {
 		if vt == t {
 			return nil
 		}
 	}
-	return fmt.Errorf("invalid valueType '%s' (must be string, number, double, or boolean)", vt)
+	return fmt.Errorf("invalid valueType '%s' (must be string, number, double, boolean, or date)", vt)
 }
 
-func validateCommand(cmd *Command, variables map[string]bool, arrays map[string]bool) error {
+func validateCommand(cmd *Command, variables map[string]bool, scope *bindingScope) error {
 	if cmd.Type == "" {
 		return fmt.Errorf("command type is required")
 	}
 	
-	// Validate array binding if present
+	// Validate array binding if present. The command and the commands in it
+	// are then bound to the array's entries.
 	if cmd.ArrayBinding != "" {
-		if !arrays[cmd.ArrayBinding] {
-			return fmt.Errorf("unknown array '%s' in arrayBinding", cmd.ArrayBinding)
+		bound, err := scope.bind(cmd.ArrayBinding)
+		if err != nil {
+			return err
 		}
+		scope = bound
+	}
+	
+	if cmd.Expression != "" {
+		if err := scope.checkExpression(cmd.Expression); err != nil {
+			return fmt.Errorf("expression: %w", err)
+		}
+	}
+	if cmd.Condition != "" {
+		if err := scope.checkExpression(cmd.Condition); err != nil {
+			return fmt.Errorf("condition: %w", err)
+		}
+	}
+	if err := validateGrouping(cmd, variables, scope); err != nil {
+		return err
 	}
 	
 	// Type-specific validation
 	switch cmd.Type {
 	case "text":
-		return validateTextCommand(cmd, variables)
+		return validateTextCommand(cmd, variables, scope)
 	case "item":
-		return validateItemCommand(cmd, variables, arrays)
+		return validateItemCommand(cmd, variables, scope)
+	case "if":
+		return validateIfCommand(cmd, variables, scope)
+	case "switch":
+		return validateSwitchCommand(cmd, variables, scope)
+	case "folder", "box":
+		for i, nestedCmd := range cmd.Commands {
+			if err := validateCommand(&nestedCmd, variables, scope); err != nil {
+				return fmt.Errorf("commands[%d]: %w", i, err)
+			}
+		}
+		return nil
 	case "image":
 		return validateImageCommand(cmd)
 	case "barcode":
 		return validateBarcodeCommand(cmd)
 	case "qrcode":
-		return validateQRCodeCommand(cmd)
-	case "feed", "cut", "align", "divider", "folder", "box":
+		return validateQRCodeCommand(cmd, variables)
+	case "pdf417", "datamatrix", "aztec":
+		return validate2DCodeCommand(cmd)
+	case "cut":
+		if cmd.Mode != "" && cmd.Mode != "full" && cmd.Mode != "partial" {
+			return fmt.Errorf("invalid cut mode '%s' (must be full or partial)", cmd.Mode)
+		}
+		return nil
+	case "drawer":
+		if cmd.Pin != 0 && cmd.Pin != 2 && cmd.Pin != 5 {
+			return fmt.Errorf("invalid drawer pin %d (must be 2 or 5)", cmd.Pin)
+		}
+		if cmd.OnTime < 0 || cmd.OnTime > 510 || cmd.OffTime < 0 || cmd.OffTime > 510 {
+			return fmt.Errorf("drawer on_time and off_time must be between 0 and 510 ms")
+		}
+		return nil
+	case "feed", "align", "divider":
 		// These are valid command types with flexible properties
 		return nil
 	default:
@@ -130,7 +385,53 @@ func validateCommand(cmd *Command, variables map[string]bool, arrays map[string]
 	}
 }
 
-func validateTextCommand(cmd *Command, variables map[string]bool) error {
+// validateGrouping checks group_by and the group header and footer, which
+// are bound to each group's entries
+func validateGrouping(cmd *Command, variables map[string]bool, scope *bindingScope) error {
+	if cmd.GroupBy == "" {
+		if len(cmd.GroupHeader) > 0 || len(cmd.GroupFooter) > 0 {
+			return fmt.Errorf("group_header and group_footer require group_by")
+		}
+		return nil
+	}
+	
+	if cmd.ArrayBinding == "" {
+		return fmt.Errorf("group_by '%s' used without arrayBinding", cmd.GroupBy)
+	}
+	field := findField(scope.fields, cmd.GroupBy)
+	if field == nil {
+		return fmt.Errorf("unknown field '%s' in group_by", cmd.GroupBy)
+	}
+	if field.ValueType == "array" {
+		return fmt.Errorf("cannot group by array field '%s'", cmd.GroupBy)
+	}
+	
+	for i, headerCmd := range cmd.GroupHeader {
+		if err := validateCommand(&headerCmd, variables, scope); err != nil {
+			return fmt.Errorf("group_header[%d]: %w", i, err)
+		}
+	}
+	for i, footerCmd := range cmd.GroupFooter {
+		if err := validateCommand(&footerCmd, variables, scope); err != nil {
+			return fmt.Errorf("group_footer[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateArrayField checks a field used by arrayField exists in the array
+// the command is bound to
+func validateArrayField(field string, scope *bindingScope) error {
+	if scope.array == "" {
+		return fmt.Errorf("arrayField '%s' used without arrayBinding", field)
+	}
+	if findField(scope.fields, field) == nil {
+		return fmt.Errorf("unknown field '%s' in array '%s'", field, scope.array)
+	}
+	return nil
+}
+
+func validateTextCommand(cmd *Command, variables map[string]bool, scope *bindingScope) error {
 	// Must have exactly one of: value, dynamicValue, or arrayField
 	count := 0
 	if cmd.Value != "" {
@@ -144,16 +445,36 @@ func validateTextCommand(cmd *Command, variables map[string]bool) error {
 	}
 	if cmd.ArrayField != "" {
 		count++
-		if cmd.ArrayBinding == "" {
-			return fmt.Errorf("arrayField '%s' used without arrayBinding", cmd.ArrayField)
+		if err := validateArrayField(cmd.ArrayField, scope); err != nil {
+			return err
 		}
 	}
+	if cmd.Expression != "" {
+		count++
+	}
+	
+	if len(cmd.Spans) > 0 {
+		count++
+	}
 	
 	if count == 0 {
-		return fmt.Errorf("text command must have value, dynamicValue, or arrayField")
+		return fmt.Errorf("text command must have value, dynamicValue, arrayField, expression, or spans")
 	}
 	if count > 1 {
-		return fmt.Errorf("text command cannot have multiple of: value, dynamicValue, arrayField")
+		return fmt.Errorf("text command cannot have multiple of: value, dynamicValue, arrayField, expression, spans")
+	}
+	
+	for i := range cmd.Spans {
+		if err := validateSpan(&cmd.Spans[i], variables, scope); err != nil {
+			return fmt.Errorf("spans[%d]: %w", i, err)
+		}
+	}
+	
+	if cmd.LineSpacing < 0 {
+		return fmt.Errorf("line_spacing cannot be negative")
+	}
+	if cmd.MaxLines < 0 {
+		return fmt.Errorf("max_lines cannot be negative")
 	}
 	
 	// Validate align if present
@@ -174,7 +495,34 @@ func validateTextCommand(cmd *Command, variables map[string]bool) error {
 	return nil
 }
 
-func validateItemCommand(cmd *Command, variables map[string]bool, arrays map[string]bool) error {
+func validateSpan(span *Span, variables map[string]bool, scope *bindingScope) error {
+	count := 0
+	if span.Value != "" {
+		count++
+	}
+	if span.DynamicValue != "" {
+		count++
+		if !variables[span.DynamicValue] {
+			return fmt.Errorf("unknown variable '%s' in dynamicValue", span.DynamicValue)
+		}
+	}
+	if span.ArrayField != "" {
+		count++
+		if err := validateArrayField(span.ArrayField, scope); err != nil {
+			return err
+		}
+	}
+	if count != 1 {
+		return fmt.Errorf("span must have exactly one of: value, dynamicValue, arrayField")
+	}
+	
+	if span.Size < 0 {
+		return fmt.Errorf("span size cannot be negative")
+	}
+	return nil
+}
+
+func validateItemCommand(cmd *Command, variables map[string]bool, scope *bindingScope) error {
 	if len(cmd.LeftSide) == 0 {
 		return fmt.Errorf("item command requires left_side")
 	}
@@ -184,12 +532,12 @@ func validateItemCommand(cmd *Command, variables map[string]bool, arrays map[str
 	
 	// Validate nested commands
 	for i, leftCmd := range cmd.LeftSide {
-		if err := validateCommand(&leftCmd, variables, arrays); err != nil {
+		if err := validateCommand(&leftCmd, variables, scope); err != nil {
 			return fmt.Errorf("left_side[%d]: %w", i, err)
 		}
 	}
 	for i, rightCmd := range cmd.RightSide {
-		if err := validateCommand(&rightCmd, variables, arrays); err != nil {
+		if err := validateCommand(&rightCmd, variables, scope); err != nil {
 			return fmt.Errorf("right_side[%d]: %w", i, err)
 		}
 	}
@@ -205,42 +553,195 @@ func validateItemCommand(cmd *Command, variables map[string]bool, arrays map[str
 	return nil
 }
 
+func validateIfCommand(cmd *Command, variables map[string]bool, scope *bindingScope) error {
+	if cmd.Condition == "" {
+		return fmt.Errorf("if command requires condition")
+	}
+	if len(cmd.Then) == 0 && len(cmd.Else) == 0 {
+		return fmt.Errorf("if command requires then or else")
+	}
+	
+	for i, thenCmd := range cmd.Then {
+		if err := validateCommand(&thenCmd, variables, scope); err != nil {
+			return fmt.Errorf("then[%d]: %w", i, err)
+		}
+	}
+	for i, elseCmd := range cmd.Else {
+		if err := validateCommand(&elseCmd, variables, scope); err != nil {
+			return fmt.Errorf("else[%d]: %w", i, err)
+		}
+	}
+	
+	return nil
+}
+
+func validateSwitchCommand(cmd *Command, variables map[string]bool, scope *bindingScope) error {
+	if cmd.Expression == "" {
+		return fmt.Errorf("switch command requires expression")
+	}
+	if len(cmd.Cases) == 0 {
+		return fmt.Errorf("switch command requires cases")
+	}
+	
+	values := make(map[string]bool)
+	for i, c := range cmd.Cases {
+		if values[c.Value] {
+			return fmt.Errorf("cases[%d]: duplicate case value '%s'", i, c.Value)
+		}
+		values[c.Value] = true
+		
+		for j, caseCmd := range c.Commands {
+			if err := validateCommand(&caseCmd, variables, scope); err != nil {
+				return fmt.Errorf("cases[%d]: commands[%d]: %w", i, j, err)
+			}
+		}
+	}
+	for i, defaultCmd := range cmd.Default {
+		if err := validateCommand(&defaultCmd, variables, scope); err != nil {
+			return fmt.Errorf("default[%d]: %w", i, err)
+		}
+	}
+	
+	return nil
+}
+
 func validateImageCommand(cmd *Command) error {
-	if cmd.Path == "" && cmd.Base64 == "" {
-		return fmt.Errorf("image command requires either path or base64")
+	sources := 0
+	for _, source := range []string{cmd.Path, cmd.Base64, cmd.URL} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources == 0 {
+		return fmt.Errorf("image command requires path, base64 or url")
+	}
+	if sources > 1 {
+		return fmt.Errorf("image command can only have one of path, base64 and url")
+	}
+	if cmd.URL != "" && !strings.HasPrefix(cmd.URL, "http://") && !strings.HasPrefix(cmd.URL, "https://") {
+		return fmt.Errorf("image url must start with http:// or https://")
+	}
+	switch cmd.Dither {
+	case "", "none", "threshold", "floyd-steinberg", "atkinson", "bayer":
+	default:
+		return fmt.Errorf("invalid dither '%s' (must be none, threshold, floyd-steinberg, atkinson or bayer)", cmd.Dither)
 	}
-	if cmd.Path != "" && cmd.Base64 != "" {
-		return fmt.Errorf("image command cannot have both path and base64")
+	if cmd.Threshold < 0 || cmd.Threshold > 255 {
+		return fmt.Errorf("image threshold must be between 0 and 255")
+	}
+	if cmd.Gamma < 0 || cmd.Gamma > 10 {
+		return fmt.Errorf("image gamma must be between 0 and 10")
+	}
+	if cmd.Contrast < -100 || cmd.Contrast > 100 || cmd.Brightness < -100 || cmd.Brightness > 100 {
+		return fmt.Errorf("image contrast and brightness must be between -100 and 100")
 	}
 	return nil
 }
 
 func validateBarcodeCommand(cmd *Command) error {
-	if cmd.Value == "" {
-		return fmt.Errorf("barcode command requires value")
+	if err := validateCodeValue(cmd); err != nil {
+		return err
 	}
 	
-	// Validate format if present
-	if cmd.Format != "" {
-		validFormats := []string{"EAN13", "EAN8", "CODE39", "CODE128", "UPC_A", "UPC_E", "ITF"}
-		valid := false
-		for _, f := range validFormats {
-			if cmd.Format == f {
-				valid = true
-				break
-			}
+	// Validate format and value, including check digits. A computed value is
+	// only known once the receipt prints.
+	if cmd.Expression == "" {
+		if _, err := NormalizeBarcode(cmd.Format, cmd.Value); err != nil {
+			return err
 		}
-		if !valid {
-			return fmt.Errorf("invalid barcode format '%s'", cmd.Format)
+	}
+	
+	switch cmd.Position {
+	case "", "none", "above", "below", "both":
+	default:
+		return fmt.Errorf("invalid barcode position '%s' (must be above, below, both or none)", cmd.Position)
+	}
+	if cmd.Width < 0 || cmd.Width > 6 {
+		return fmt.Errorf("barcode width must be between 1 and 6 dots per module")
+	}
+	
+	return nil
+}
+
+func validate2DCodeCommand(cmd *Command) error {
+	if err := validateCodeValue(cmd); err != nil {
+		return err
+	}
+	if cmd.Size < 0 || cmd.Size > 16 {
+		return fmt.Errorf("%s size must be between 1 and 16 dots per module", cmd.Type)
+	}
+	
+	switch cmd.Type {
+	case "pdf417":
+		if cmd.ECCLevel < 0 || cmd.ECCLevel > 8 {
+			return fmt.Errorf("invalid pdf417 ecc_level %d (must be 0 to 8)", cmd.ECCLevel)
+		}
+	case "aztec":
+		if cmd.ECCLevel < 0 || cmd.ECCLevel > 90 {
+			return fmt.Errorf("invalid aztec ecc_level %d (must be 0 to 90 percent)", cmd.ECCLevel)
+		}
+	case "datamatrix":
+		if cmd.ECCLevel != 0 {
+			return fmt.Errorf("datamatrix does not support ecc_level")
 		}
 	}
 	
 	return nil
 }
 
-func validateQRCodeCommand(cmd *Command) error {
-	if cmd.Value == "" {
-		return fmt.Errorf("qrcode command requires value")
+// validateCodeValue checks a barcode or 2D code has one of value and expression
+func validateCodeValue(cmd *Command) error {
+	if cmd.Value == "" && cmd.Expression == "" {
+		if cmd.Type == "qrcode" {
+			return fmt.Errorf("qrcode command requires value, expression or payload")
+		}
+		return fmt.Errorf("%s command requires value or expression", cmd.Type)
+	}
+	if cmd.Value != "" && cmd.Expression != "" {
+		return fmt.Errorf("%s command cannot have both value and expression", cmd.Type)
+	}
+	return nil
+}
+
+func validateQRCodeCommand(cmd *Command, variables map[string]bool) error {
+	if cmd.Payload == nil {
+		if err := validateCodeValue(cmd); err != nil {
+			return err
+		}
+	} else if cmd.Value != "" || cmd.Expression != "" {
+		return fmt.Errorf("qrcode command cannot have both a value and payload")
+	}
+	
+	if cmd.Payload != nil {
+		if err := cmd.Payload.checkFields(true); err != nil {
+			return err
+		}
+		for field, variable := range cmd.Payload.DynamicFields {
+			if !variables[variable] {
+				return fmt.Errorf("unknown variable '%s' in payload field '%s'", variable, field)
+			}
+		}
+		if len(cmd.Payload.DynamicFields) == 0 {
+			// Everything is known now, so check it builds
+			if _, err := cmd.Payload.Build(); err != nil {
+				return err
+			}
+		}
+	}
+	
+	if cmd.Size < 0 || cmd.Size > 16 {
+		return fmt.Errorf("qrcode size must be between 1 and 16 dots per module")
+	}
+	if cmd.Width < 0 || cmd.WidthMM < 0 {
+		return fmt.Errorf("qrcode width cannot be negative")
+	}
+	if cmd.Width > 0 && cmd.WidthMM > 0 {
+		return fmt.Errorf("qrcode command cannot have both width and width_mm")
+	}
+	switch cmd.Align {
+	case "", "left", "center", "right":
+	default:
+		return fmt.Errorf("invalid align '%s' (must be left, center, or right)", cmd.Align)
 	}
 	
 	// Validate error correction if present